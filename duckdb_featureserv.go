@@ -15,7 +15,7 @@ package main
 
 /*
 # Running
-Usage: ./duckdb_featureserv [ -test ] [ --database-path /path/to/database.db ]
+Usage: ./duckdb_featureserv [ -test ] [ --database-path /path/to/database.db ] [ --source /path/to/data.parquet ]
 
 Browser: e.g. http://localhost:9000/index.html
 
@@ -55,6 +55,7 @@ var flagHelp bool
 var flagVersion bool
 var flagConfigFilename string
 var flagDuckDBPath string
+var flagSources []string
 
 var flagDisableUi bool
 
@@ -70,6 +71,7 @@ func initCommnandOptions() {
 	getopt.FlagLong(&flagTestModeOn, "test", 't', "Serve mock data for testing")
 	getopt.FlagLong(&flagVersion, "version", 'v', "Output the version information")
 	getopt.FlagLong(&flagDuckDBPath, "database-path", 0, "", "Path to DuckDB database file")
+	getopt.FlagLong(&flagSources, "source", 's', "Data file (or glob) to publish, as PATH[#LAYER]. May be repeated", "PATH[#LAYER]")
 
 	getopt.FlagLong(&flagDisableUi, "disable-ui", 0, "Disable HTML UI routes")
 }
@@ -95,6 +97,10 @@ func main() {
 	if flagDuckDBPath != "" {
 		conf.Configuration.Database.DatabasePath = flagDuckDBPath
 	}
+	// Data sources from the command line are added to any configured
+	for _, spec := range flagSources {
+		conf.Configuration.Sources = append(conf.Configuration.Sources, conf.SourceFromSpec(spec))
+	}
 
 	// Set UI disable flag from command line
 	if flagDisableUi {
@@ -16,6 +16,9 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -27,18 +30,24 @@ const (
 	RootPageName   = "index"
 	TagCollections = "collections"
 	TagItems       = "items"
+	TagQueryables  = "queryables"
 	TagConformance = "conformance"
 	TagAPI         = "api"
 
 	TagFunctions = "functions"
 
+	ParamAggregate  = "aggregate"
 	ParamCrs        = "crs"
 	ParamLimit      = "limit"
 	ParamOffset     = "offset"
+	ParamCursor     = "cursor"
 	ParamBbox       = "bbox"
 	ParamBboxCrs    = "bbox-crs"
+	ParamDatetime   = "datetime"
 	ParamFilter     = "filter"
 	ParamFilterCrs  = "filter-crs"
+	ParamFilterLang = "filter-lang"
+	ParamGeomColumn = "geom-column"
 	ParamGroupBy    = "groupby"
 	ParamOrderBy    = "orderby"
 	ParamPrecision  = "precision"
@@ -46,6 +55,9 @@ const (
 	ParamSortBy     = "sortby"
 	ParamTransform  = "transform"
 
+	FilterLangCQL2Text = "cql2-text"
+	FilterLangCQL2JSON = "cql2-json"
+
 	OrderByDirSep = ":"
 	OrderByDirD   = "d"
 	OrderByDirA   = "a"
@@ -58,6 +70,9 @@ const (
 	RelData        = "data"
 	RelFunctions   = "functions"
 	RelItems       = "items"
+	RelNext        = "next"
+	RelPrev        = "prev"
+	RelQueryables  = "http://www.opengis.net/def/rel/ogc/1.0/queryables"
 
 	TitleFeatuuresGeoJSON = "Features as GeoJSON"
 	TitleDataJSON         = "Data as JSON"
@@ -65,6 +80,9 @@ const (
 	TitleDocument         = "This document"
 	TitleAsJSON           = " as JSON"
 	TitleAsHTML           = " as HTML"
+	TitleNextPage         = "Next page"
+	TitlePrevPage         = "Previous page"
+	TitleQueryables       = "Queryable properties"
 
 	GeoJSONFeatureCollection = "FeatureCollection"
 )
@@ -84,6 +102,18 @@ const (
 	ErrMsgDataWriteError        = "Unable to write data to: %v"
 	ErrMsgNoDataRead            = "No data read from: %v"
 	ErrMsgRequestTimeout        = "Maximum time exceeded.  Request cancelled."
+	ErrMsgQueryTimeout          = "Query timed out reading data from: %v"
+	ErrMsgQueryCancelled        = "Query cancelled reading data from: %v"
+	ErrMsgCursorNotSupported    = "Paging with a cursor is not supported for: %v"
+	ErrMsgCursorMismatch        = "Cursor is for a different sortby: %v"
+	ErrMsgCursorOffset          = "Paging with a cursor cannot be combined with an offset"
+	ErrMsgInvalidSortBy         = "Invalid sortby column: %v.  Sortables are: %v"
+	ErrMsgInvalidGroupBy        = "Invalid groupby column: %v"
+	ErrMsgInvalidAggregate      = "Invalid aggregate: %v.  Aggregate functions are: %v"
+	ErrMsgInvalidAggregateCol   = "Invalid aggregate column: %v"
+	ErrMsgUnsupportedCrs        = "Unsupported CRS: %v.  Supported CRSs are: %v"
+	ErrMsgInvalidBbox           = "Invalid bbox for CRS: %v"
+	ErrMsgInvalidRequestBody    = "Invalid request body: %v"
 )
 
 const (
@@ -92,12 +122,18 @@ const (
 )
 
 var ParamReservedNames = []string{
+	ParamAggregate,
 	ParamCrs,
 	ParamLimit,
 	ParamOffset,
+	ParamCursor,
 	ParamBbox,
 	ParamBboxCrs,
+	ParamDatetime,
 	ParamFilter,
+	ParamFilterCrs,
+	ParamFilterLang,
+	ParamGeomColumn,
 	ParamGroupBy,
 	ParamOrderBy,
 	ParamPrecision,
@@ -126,6 +162,8 @@ type RootInfo struct {
 	Title       string  `json:"title"`
 	Description string  `json:"description"`
 	Links       []*Link `json:"links"`
+	// used for HTML response only
+	Collections []*CollectionInfo `json:"-"`
 }
 
 var RootInfoSchema openapi3.Schema = openapi3.Schema{
@@ -170,13 +208,25 @@ var LinkSchema openapi3.Schema = openapi3.Schema{
 	},
 }
 
+var PropertyItemsSchema openapi3.Schema = openapi3.Schema{
+	Description: "The JSON Schema type of the elements of an array property",
+	Type:        "object",
+	Properties: map[string]*openapi3.SchemaRef{
+		"type":   {Value: &openapi3.Schema{Type: "string"}},
+		"format": {Value: &openapi3.Schema{Type: "string"}},
+		"items":  {Value: &openapi3.Schema{Type: "object"}},
+	},
+}
+
 var PropertySchema openapi3.Schema = openapi3.Schema{
 	Description: "A data property of a collection or function result",
 	Type:        "object",
-	Required:    []string{"name", "type"},
+	Required:    []string{"name"},
 	Properties: map[string]*openapi3.SchemaRef{
 		"name":        {Value: &openapi3.Schema{Type: "string"}},
-		"type":        {Value: &openapi3.Schema{Type: "string"}},
+		"type":        {Value: &openapi3.Schema{Type: "string", Description: "JSON Schema type, absent for arbitrary JSON values"}},
+		"format":      {Value: &openapi3.Schema{Type: "string", Description: "JSON Schema format, such as date-time"}},
+		"items":       {Value: &PropertyItemsSchema},
 		"description": {Value: &openapi3.Schema{Type: "string"}},
 	},
 }
@@ -192,15 +242,41 @@ var ParameterSchema openapi3.Schema = openapi3.Schema{
 	},
 }
 
+// Exception is an OGC API exception response
+type Exception struct {
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+}
+
+// NewException creates an exception for an HTTP status code.
+// The exception code is the status text, without spaces
+func NewException(status int, description string) *Exception {
+	return &Exception{
+		Code:        strings.ReplaceAll(http.StatusText(status), " ", ""),
+		Description: description,
+	}
+}
+
 // Bbox for extent
 type Bbox struct {
 	Crs    string      `json:"crs"`
 	Extent [][]float64 `json:"bbox"`
 }
 
+// TemporalExtent is the time interval of a collection.
+// Unbounded ends are null
+type TemporalExtent struct {
+	Interval [][]*string `json:"interval"`
+	Trs      string      `json:"trs,omitempty"`
+}
+
+// TrsGregorian is the temporal reference system of ISO 8601 times
+const TrsGregorian = "http://www.opengis.net/def/uom/ISO-8601/0/Gregorian"
+
 // Extent OAPIF Extent structure (partial)
 type Extent struct {
-	Spatial *Bbox `json:"spatial"`
+	Spatial  *Bbox           `json:"spatial,omitempty"`
+	Temporal *TemporalExtent `json:"temporal,omitempty"`
 }
 
 // --- @See https://raw.githubusercontent.com/opengeospatial/WFS_FES/master/core/openapi/schemas/bbox.yaml
@@ -225,11 +301,31 @@ var BboxSchema openapi3.Schema = openapi3.Schema{
 	},
 }
 
+var TemporalExtentSchema openapi3.Schema = openapi3.Schema{
+	Type:     "object",
+	Required: []string{"interval"},
+	Properties: map[string]*openapi3.SchemaRef{
+		"interval": {
+			Value: &openapi3.Schema{
+				Type: "array",
+				Items: openapi3.NewSchemaRef("", &openapi3.Schema{
+					Type:     "array",
+					MinItems: 2,
+					MaxItems: openapi3.Uint64Ptr(2),
+					Items:    openapi3.NewSchemaRef("", openapi3.NewDateTimeSchema().WithNullable()),
+				}),
+			},
+		},
+		"trs": {Value: openapi3.NewStringSchema()},
+	},
+}
+
 var ExtentSchema openapi3.Schema = openapi3.Schema{
 	Type:     "object",
 	Required: []string{"extent"},
 	Properties: map[string]*openapi3.SchemaRef{
-		"spatial": {Value: &BboxSchema},
+		"spatial":  {Value: &BboxSchema},
+		"temporal": {Value: &TemporalExtentSchema},
 	},
 }
 
@@ -237,15 +333,20 @@ type NameValMap map[string]string
 
 // RequestParam holds the parameters for a request
 type RequestParam struct {
-	Crs           int
+	Crs           data.Crs
 	Limit         int
 	Offset        int
+	Cursor        *data.Cursor
 	Bbox          *data.Extent
-	BboxCrs       int
+	BboxCrs       data.Crs
+	Datetime      *data.TimeInterval
 	Properties    []string
 	Filter        string
-	FilterCrs     int
+	FilterCrs     data.Crs
+	FilterLang    string
+	GeomColumn    string
 	GroupBy       []string
+	Aggregates    []data.Aggregate
 	SortBy        []data.Sorting
 	Precision     int
 	TransformFuns []data.TransformFunction
@@ -288,10 +389,42 @@ type Parameter struct {
 	Default     string `json:"default,omitempty"`
 }
 
+// Property is a data property, with its JSON Schema type and format.
+// Properties holding arbitrary JSON have no type
 type Property struct {
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	Description string `json:"description"`
+	Name        string         `json:"name"`
+	Type        string         `json:"type,omitempty"`
+	Format      string         `json:"format,omitempty"`
+	Items       *PropertyItems `json:"items,omitempty"`
+	Description string         `json:"description"`
+}
+
+// PropertyItems describes the elements of an array property
+type PropertyItems struct {
+	Type   string         `json:"type,omitempty"`
+	Format string         `json:"format,omitempty"`
+	Items  *PropertyItems `json:"items,omitempty"`
+}
+
+// Partition is a partition key of a partitioned collection, and its available values
+type Partition struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+var PartitionSchema openapi3.Schema = openapi3.Schema{
+	Type:     "object",
+	Required: []string{"name", "values"},
+	Properties: map[string]*openapi3.SchemaRef{
+		"name": {Value: &openapi3.Schema{Type: "string"}},
+		"values": {Value: &openapi3.Schema{
+			Type: "array",
+			Items: &openapi3.SchemaRef{
+				Value: &openapi3.Schema{Type: "string"},
+			},
+		},
+		},
+	},
 }
 
 // CollectionInfo for a collection
@@ -301,10 +434,15 @@ type CollectionInfo struct {
 	Description  string   `json:"description,omitempty"`
 	Extent       *Extent  `json:"extent,omitempty"`
 	Crs          []string `json:"crs,omitempty"`
+	StorageCrs   string   `json:"storageCrs,omitempty"`
 	GeometryType *string  `json:"geometrytype,omitempty"`
+	Keywords     []string `json:"keywords,omitempty"`
+	License      string   `json:"license,omitempty"`
+	Attribution  string   `json:"attribution,omitempty"`
 
 	// these are omitempty so they don't show in summary metadata
-	Properties []*Property `json:"properties,omitempty"`
+	Properties []*Property  `json:"properties,omitempty"`
+	Partitions []*Partition `json:"partitions,omitempty"`
 
 	Links []*Link `json:"links"`
 	// used for HTML response only
@@ -329,12 +467,27 @@ var CollectionInfoSchema openapi3.Schema = openapi3.Schema{
 			},
 		},
 		},
+		"storageCrs":   {Value: &openapi3.Schema{Type: "string"}},
 		"geometrytype": {Value: &openapi3.Schema{Type: "string"}},
+		"keywords": {Value: &openapi3.Schema{
+			Type: "array",
+			Items: &openapi3.SchemaRef{
+				Value: &openapi3.Schema{Type: "string"},
+			},
+		},
+		},
+		"license":     {Value: &openapi3.Schema{Type: "string"}},
+		"attribution": {Value: &openapi3.Schema{Type: "string"}},
 		"properties": {Value: &openapi3.Schema{
 			Type:  "array",
 			Items: &openapi3.SchemaRef{Value: &PropertySchema},
 		},
 		},
+		"partitions": {Value: &openapi3.Schema{
+			Type:  "array",
+			Items: &openapi3.SchemaRef{Value: &PartitionSchema},
+		},
+		},
 		"links": {Value: &openapi3.Schema{
 			Type:  "array",
 			Items: &openapi3.SchemaRef{Value: &LinkSchema},
@@ -343,11 +496,84 @@ var CollectionInfoSchema openapi3.Schema = openapi3.Schema{
 	},
 }
 
+// Queryables is the JSON Schema of the properties of a collection which can be used in filters
+type Queryables struct {
+	Schema               string                `json:"$schema"`
+	ID                   string                `json:"$id"`
+	Type                 string                `json:"type"`
+	Title                string                `json:"title,omitempty"`
+	Description          string                `json:"description,omitempty"`
+	Properties           map[string]*Queryable `json:"properties"`
+	AdditionalProperties bool                  `json:"additionalProperties"`
+	// used for HTML response only, to list the properties in column order
+	Names []string `json:"-"`
+}
+
+// Queryable is the JSON Schema of a queryable property.
+// Geometry properties have a format giving the geometry type, such as geometry-point
+type Queryable struct {
+	Title       string         `json:"title,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Type        string         `json:"type,omitempty"`
+	Format      string         `json:"format,omitempty"`
+	Items       *PropertyItems `json:"items,omitempty"`
+	Role        string         `json:"x-ogc-role,omitempty"`
+}
+
+// QueryablesSchemaURI is the JSON Schema dialect of queryables
+const QueryablesSchemaURI = "https://json-schema.org/draft/2020-12/schema"
+
+// queryableRolePrimaryGeometry is the role of the primary geometry of a collection
+const queryableRolePrimaryGeometry = "primary-geometry"
+
+// queryableGeometryFormats are the queryable formats of geometry types
+var queryableGeometryFormats = map[string]string{
+	"POINT":              "geometry-point",
+	"MULTIPOINT":         "geometry-multipoint",
+	"LINESTRING":         "geometry-linestring",
+	"MULTILINESTRING":    "geometry-multilinestring",
+	"POLYGON":            "geometry-polygon",
+	"MULTIPOLYGON":       "geometry-multipolygon",
+	"GEOMETRYCOLLECTION": "geometry-geometrycollection",
+}
+
+// queryableGeometryFormatAny is the queryable format of geometries of unknown or mixed type
+const queryableGeometryFormatAny = "geometry-any"
+
+var QueryableSchema openapi3.Schema = openapi3.Schema{
+	Type: "object",
+	Properties: map[string]*openapi3.SchemaRef{
+		"title":       {Value: &openapi3.Schema{Type: "string"}},
+		"description": {Value: &openapi3.Schema{Type: "string"}},
+		"type":        {Value: &openapi3.Schema{Type: "string"}},
+		"format":      {Value: &openapi3.Schema{Type: "string"}},
+		"x-ogc-role":  {Value: &openapi3.Schema{Type: "string"}},
+	},
+}
+
+var QueryablesSchema openapi3.Schema = openapi3.Schema{
+	Type:     "object",
+	Required: []string{"$schema", "$id", "type", "properties"},
+	Properties: map[string]*openapi3.SchemaRef{
+		"$schema":     {Value: &openapi3.Schema{Type: "string"}},
+		"$id":         {Value: &openapi3.Schema{Type: "string"}},
+		"type":        {Value: &openapi3.Schema{Type: "string"}},
+		"title":       {Value: &openapi3.Schema{Type: "string"}},
+		"description": {Value: &openapi3.Schema{Type: "string"}},
+		"properties": {Value: &openapi3.Schema{
+			Type:                 "object",
+			AdditionalProperties: &openapi3.SchemaRef{Value: &QueryableSchema},
+		},
+		},
+		"additionalProperties": {Value: &openapi3.Schema{Type: "boolean"}},
+	},
+}
+
 // FeatureCollection info
 type FeatureCollectionRaw struct {
 	Type           string             `json:"type"`
 	Features       []*json.RawMessage `json:"features"`
-	NumberMatched  uint               `json:"numberMatched,omitempty"`
+	NumberMatched  *int64             `json:"numberMatched,omitempty"`
 	NumberReturned uint               `json:"numberReturned"`
 	TimeStamp      string             `json:"timeStamp,omitempty"`
 	Links          []*Link            `json:"links"`
@@ -475,6 +701,17 @@ var conformance = Conformance{
 		"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/oas3",
 		"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson",
 		"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/html",
+		"http://www.opengis.net/spec/ogcapi-features-2/1.0/conf/crs",
+		"http://www.opengis.net/spec/ogcapi-features-3/1.0/conf/queryables",
+		"http://www.opengis.net/spec/ogcapi-features-3/1.0/conf/queryables-query-parameters",
+		"http://www.opengis.net/spec/ogcapi-features-3/1.0/conf/filter",
+		"http://www.opengis.net/spec/ogcapi-features-3/1.0/conf/features-filter",
+		"http://www.opengis.net/spec/cql2/1.0/conf/cql2-text",
+		"http://www.opengis.net/spec/cql2/1.0/conf/cql2-json",
+		"http://www.opengis.net/spec/cql2/1.0/conf/basic-cql2",
+		"http://www.opengis.net/spec/cql2/1.0/conf/advanced-comparison-operators",
+		"http://www.opengis.net/spec/cql2/1.0/conf/basic-spatial-functions",
+		"http://www.opengis.net/spec/cql2/1.0/conf/spatial-functions",
 		"http://www.opengis.net/spec/ogcapi-common-1/1.0/conf/core",
 		"http://www.opengis.net/spec/ogcapi-common-1/1.0/conf/landing-page",
 		"http://www.opengis.net/spec/ogcapi-common-1/1.0/conf/json",
@@ -485,15 +722,118 @@ var conformance = Conformance{
 	},
 }
 
+// CrsURICRS84 is the OGC URI of WGS 84 longitude/latitude
+const CrsURICRS84 = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+
+// crsURIEPSG is the prefix of the OGC URIs of EPSG CRSs
+const crsURIEPSG = "http://www.opengis.net/def/crs/EPSG/0/"
+
+// HeaderContentCrs is the response header giving the CRS of feature geometries
+const HeaderContentCrs = "Content-Crs"
+
+// CrsURI provides the OGC URI for a CRS.
+// WGS 84 in longitude/latitude order is CRS84
+func CrsURI(crs data.Crs) string {
+	if crs.Srid == data.SRID_4326 && !crs.IsLatLon {
+		return CrsURICRS84
+	}
+	return fmt.Sprintf("%s%d", crsURIEPSG, crs.Srid)
+}
+
+// StorageCrs is the CRS of geometries stored with an SRID, in x/y axis order
+func StorageCrs(srid int) data.Crs {
+	if srid <= 0 {
+		srid = data.SRID_4326
+	}
+	return data.Crs{Srid: srid}
+}
+
+// ParseCrs parses a CRS given as an OGC URI, a safe CURIE such as [EPSG:3857],
+// an EPSG code such as EPSG:3857, or an SRID.
+// EPSG CRSs have the axis order of their definition.
+// SRIDs are supported for compatibility, and have x/y axis order
+func ParseCrs(val string) (data.Crs, error) {
+	crsStr := strings.TrimSpace(val)
+	if strings.HasPrefix(crsStr, "[") && strings.HasSuffix(crsStr, "]") {
+		crsStr = crsStr[1 : len(crsStr)-1]
+	}
+	if srid, err := strconv.Atoi(crsStr); err == nil && srid > 0 {
+		return data.Crs{Srid: srid}, nil
+	}
+	crsLow := strings.ToLower(strings.Replace(crsStr, "https://", "http://", 1))
+	if crsLow == strings.ToLower(CrsURICRS84) || crsLow == "ogc:crs84" || crsLow == "crs84" {
+		return data.CRS84, nil
+	}
+	code := ""
+	if strings.HasPrefix(crsLow, strings.ToLower(crsURIEPSG)) {
+		code = crsLow[len(crsURIEPSG):]
+	} else if strings.HasPrefix(crsLow, "epsg:") {
+		code = crsLow[len("epsg:"):]
+	}
+	srid, err := strconv.Atoi(code)
+	if err != nil || srid <= 0 {
+		return data.Crs{}, fmt.Errorf("invalid CRS: %v", val)
+	}
+	return data.Crs{Srid: srid, IsLatLon: data.IsLatLonSrid(srid)}, nil
+}
+
+// SupportedCrs lists the CRSs supported for a collection with a storage SRID:
+// CRS84, EPSG:4326, the storage CRS and the configured CRSs
+func SupportedCrs(storageSrid int) []data.Crs {
+	crsList := []data.Crs{data.CRS84, {Srid: data.SRID_4326, IsLatLon: true}}
+	isListed := map[int]bool{data.SRID_4326: true}
+	for _, srid := range append([]int{StorageCrs(storageSrid).Srid}, conf.Configuration.Server.CrsSrids...) {
+		if srid <= 0 || isListed[srid] {
+			continue
+		}
+		isListed[srid] = true
+		crsList = append(crsList, data.Crs{Srid: srid, IsLatLon: data.IsLatLonSrid(srid)})
+	}
+	return crsList
+}
+
+// crsURIs provides the URIs of a list of CRSs
+func crsURIs(crsList []data.Crs) []string {
+	uris := make([]string, len(crsList))
+	for i, crs := range crsList {
+		uris[i] = CrsURI(crs)
+	}
+	return uris
+}
+
+// toBbox provides the spatial extent of a table, or nil if it has not been computed
 func toBbox(cc *data.Table) *Bbox {
-	// extent bbox is always in 4326 for now
-	crs := "http://www.opengis.net/def/crs/EPSG/0/4326"
+	if cc.Extent == (data.Extent{}) {
+		return nil
+	}
+	// extent bbox is computed in the storage CRS of the table
+	crs := CrsURI(StorageCrs(cc.Srid))
 	return &Bbox{
 		Crs:    crs,
 		Extent: [][]float64{{cc.Extent.Minx, cc.Extent.Miny, cc.Extent.Maxx, cc.Extent.Maxy}},
 	}
 }
 
+// toTemporal provides the temporal extent of a table, if it has one
+func toTemporal(tbl *data.Table) *TemporalExtent {
+	if tbl.TemporalExtent == nil {
+		return nil
+	}
+	return &TemporalExtent{
+		Interval: [][]*string{{formatTime(tbl.TemporalExtent.Start), formatTime(tbl.TemporalExtent.End)}},
+		Trs:      TrsGregorian,
+	}
+}
+
+// formatTime formats a time as RFC 3339 in UTC, or nil for an unbounded time
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339)
+	return &s
+}
+
 func NewLink(href string, rel string, conType string, title string) *Link {
 	return &Link{
 		Href:  href,
@@ -525,30 +865,140 @@ func NewCollectionInfo(tbl *data.Table) *CollectionInfo {
 		Title:       tbl.Title,
 		Description: tbl.Description,
 		Extent: &Extent{
-			Spatial: toBbox(tbl),
+			Spatial:  toBbox(tbl),
+			Temporal: toTemporal(tbl),
 		},
+		Crs:         crsURIs(SupportedCrs(tbl.Srid)),
+		StorageCrs:  CrsURI(StorageCrs(tbl.Srid)),
+		Keywords:    tbl.Keywords,
+		License:     tbl.License,
+		Attribution: tbl.Attribution,
+		Links:       TableLinks(tbl),
 	}
 	return &doc
 }
 
+// TableLinks are the configured links of a table
+func TableLinks(tbl *data.Table) []*Link {
+	var links []*Link
+	for _, link := range tbl.Links {
+		links = append(links, &Link{
+			Href:  link.Href,
+			Rel:   link.Rel,
+			Type:  link.Type,
+			Title: link.Title,
+		})
+	}
+	return links
+}
+
+// TablePartitions are the partition keys and values of a partitioned table
+func TablePartitions(tbl *data.Table) []*Partition {
+	var partitions []*Partition
+	for _, part := range tbl.Partitions {
+		partitions = append(partitions, &Partition{
+			Name:   part.Name,
+			Values: part.Values,
+		})
+	}
+	return partitions
+}
+
 func TableProperties(tbl *data.Table) []*Property {
 	props := make([]*Property, len(tbl.Columns))
 	for i, name := range tbl.Columns {
-		props[i] = &Property{
-			Name:        name,
-			Type:        tbl.JSONTypes[i],
-			Description: tbl.ColDesc[i],
-		}
+		props[i] = newProperty(name, tbl.JSONTypes[i], indexOrBlank(tbl.JSONFormats, i))
+		props[i].Description = tbl.ColDesc[i]
 	}
 	return props
 }
 
+// NewQueryables creates the queryables of a table, identified by their URL
+func NewQueryables(tbl *data.Table, id string) *Queryables {
+	doc := Queryables{
+		Schema:      QueryablesSchemaURI,
+		ID:          id,
+		Type:        "object",
+		Title:       tbl.Title,
+		Description: tbl.Description,
+		Properties:  make(map[string]*Queryable),
+		Names:       tbl.QueryableNames(),
+	}
+	colIndex := make(map[string]int)
+	for i, name := range tbl.Columns {
+		colIndex[name] = i
+	}
+	isGeometry := make(map[string]bool)
+	for _, name := range tbl.GeometryColumns {
+		isGeometry[name] = true
+	}
+	for _, name := range doc.Names {
+		i, isColumn := colIndex[name]
+		if !isColumn || isGeometry[name] || strings.EqualFold(tbl.DbTypes[name], data.DuckDBTypeGeometry) {
+			doc.Properties[name] = newGeometryQueryable(tbl, name)
+			continue
+		}
+		typ, format, items := propertyType(tbl.JSONTypes[i], indexOrBlank(tbl.JSONFormats, i))
+		doc.Properties[name] = &Queryable{
+			Title:       name,
+			Description: indexOrBlank(tbl.ColDesc, i),
+			Type:        typ,
+			Format:      format,
+			Items:       items,
+		}
+	}
+	return &doc
+}
+
+// newGeometryQueryable creates the queryable of a geometry column, with a format for its geometry type.
+// Only the geometry type of the primary geometry column is known
+func newGeometryQueryable(tbl *data.Table, name string) *Queryable {
+	queryable := &Queryable{Title: name, Type: "object", Format: queryableGeometryFormatAny}
+	if name == tbl.GeometryColumn {
+		queryable.Role = queryableRolePrimaryGeometry
+		if format, ok := queryableGeometryFormats[strings.ToUpper(tbl.GeometryType)]; ok {
+			queryable.Format = format
+		}
+	}
+	return queryable
+}
+
+// newProperty creates a property with the JSON Schema type for a data JSON type.
+// Array JSON types such as integer[] have items of the element type
+func newProperty(name string, jsonType string, format string) *Property {
+	typ, format, items := propertyType(jsonType, format)
+	return &Property{
+		Name:   name,
+		Type:   typ,
+		Format: format,
+		Items:  items,
+	}
+}
+
+func propertyType(jsonType string, format string) (string, string, *PropertyItems) {
+	if elemType, ok := strings.CutSuffix(jsonType, "[]"); ok {
+		typ, format, items := propertyType(elemType, format)
+		return "array", "", &PropertyItems{Type: typ, Format: format, Items: items}
+	}
+	if jsonType == data.JSONTypeJSON {
+		return "", format, nil
+	}
+	return jsonType, format, nil
+}
+
+// indexOrBlank provides a list element, or blank if the list is too short
+func indexOrBlank(list []string, i int) string {
+	if i < len(list) {
+		return list[i]
+	}
+	return ""
+}
+
 func NewFeatureCollectionInfo(featureJSON []string) *FeatureCollectionRaw {
 	ts := time.Now().Format(time.RFC3339)
 	doc := FeatureCollectionRaw{
 		Type:           GeoJSONFeatureCollection,
 		Features:       toRaw(featureJSON),
-		NumberMatched:  0,
 		NumberReturned: uint(len(featureJSON)),
 		TimeStamp:      ts,
 	}
@@ -598,11 +1048,8 @@ func FunctionParameters(fn *data.Function) []*Parameter {
 func FunctionProperties(fn *data.Function) []*Property {
 	props := make([]*Property, len(fn.OutNames))
 	for i, name := range fn.OutNames {
-		props[i] = &Property{
-			Name: name,
-			Type: fn.OutJSONTypes[i],
-			// no description available from db catalog
-		}
+		// no description available from db catalog
+		props[i] = newProperty(name, fn.OutJSONTypes[i], indexOrBlank(fn.OutJSONFormats, i))
 	}
 	return props
 }
@@ -628,6 +1075,10 @@ func PathCollectionItems(name string) string {
 	return fmt.Sprintf("%v/%v/%v", TagCollections, name, TagItems)
 }
 
+func PathCollectionQueryables(name string) string {
+	return fmt.Sprintf("%v/%v/%v", TagCollections, name, TagQueryables)
+}
+
 func PathFunction(name string) string {
 	return fmt.Sprintf("%v/%v", TagFunctions, name)
 }
@@ -38,6 +38,9 @@ const (
 	// ContentTypeHTML
 	ContentTypeOpenAPI = "application/vnd.oai.openapi+json;version=3.0"
 
+	// ContentTypeSchemaJSON is the content type of JSON Schema documents, such as queryables
+	ContentTypeSchemaJSON = "application/schema+json"
+
 	// FormatJSON code and extension for JSON
 	FormatJSON = "json"
 
@@ -56,7 +56,7 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 	paramBbox := openapi3.ParameterRef{
 		Value: &openapi3.Parameter{
 			Name:        "bbox",
-			Description: "Bounding box to restrict results to given extent (as minLon,minLat,maxLon,maxLat).",
+			Description: "Bounding box to restrict results to given extent (as minx,miny,maxx,maxy or minx,miny,minz,maxx,maxy,maxz, in the bbox-crs).  A minimum longitude greater than the maximum crosses the antimeridian.",
 			In:          "query",
 			Required:    false,
 			Explode:     openapi3.BoolPtr(false),
@@ -65,8 +65,8 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 				Value: &openapi3.Schema{
 					Type:     "array",
 					MinItems: 4,
-					MaxItems: openapi3.Uint64Ptr(4),
-					Items:    openapi3.NewSchemaRef("", openapi3.NewFloat64Schema().WithMin(-180).WithMax(180)),
+					MaxItems: openapi3.Uint64Ptr(6),
+					Items:    openapi3.NewSchemaRef("", openapi3.NewFloat64Schema()),
 				},
 			},
 			AllowEmptyValue: false,
@@ -75,14 +75,14 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 	paramBboxCrs := openapi3.ParameterRef{
 		Value: &openapi3.Parameter{
 			Name:        "bbox-crs",
-			Description: "SRID for coordinate reference system of bbox parameter.",
+			Description: "CRS of the bbox parameter, as a CRS URI (default CRS84).",
 			In:          "query",
 			Required:    false,
 			Schema: &openapi3.SchemaRef{
 				Value: &openapi3.Schema{
-					Type:    "integer",
-					Min:     openapi3.Float64Ptr(1),
-					Default: 4326,
+					Type:    "string",
+					Format:  "uri",
+					Default: CrsURICRS84,
 				},
 			},
 			AllowEmptyValue: false,
@@ -101,19 +101,41 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 	paramFilterCrs := openapi3.ParameterRef{
 		Value: &openapi3.Parameter{
 			Name:        "filter-crs",
-			Description: "SRID for filter geometry literals.",
+			Description: "CRS of filter geometry literals, as a CRS URI (default CRS84).",
 			In:          "query",
 			Required:    false,
 			Schema: &openapi3.SchemaRef{
 				Value: &openapi3.Schema{
-					Type:    "integer",
-					Min:     openapi3.Float64Ptr(1),
-					Default: 4326,
+					Type:    "string",
+					Format:  "uri",
+					Default: CrsURICRS84,
 				},
 			},
 			AllowEmptyValue: false,
 		},
 	}
+	paramFilterLang := openapi3.ParameterRef{
+		Value: &openapi3.Parameter{
+			Name:        "filter-lang",
+			Description: "Language of the filter: CQL2 text (the default) or CQL2-JSON.",
+			In:          "query",
+			Required:    false,
+			Schema: &openapi3.SchemaRef{
+				Value: openapi3.NewStringSchema().WithEnum(FilterLangCQL2Text, FilterLangCQL2JSON),
+			},
+			AllowEmptyValue: false,
+		},
+	}
+	requestBodyFilter := openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().
+			WithDescription("Filter for the features, as in the query parameters. A filter object is CQL2-JSON").
+			WithJSONSchema(openapi3.NewObjectSchema().
+				WithProperty("filter", &openapi3.Schema{
+					Description: "CQL2 text, or a CQL2-JSON object",
+				}).
+				WithProperty("filter-lang", openapi3.NewStringSchema().WithEnum(FilterLangCQL2Text, FilterLangCQL2JSON)).
+				WithProperty("filter-crs", openapi3.NewStringSchema().WithFormat("uri"))),
+	}
 	paramProperties := openapi3.ParameterRef{
 		Value: &openapi3.Parameter{
 			Name:        "properties",
@@ -151,17 +173,38 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 			AllowEmptyValue: false,
 		},
 	}
+	paramDatetime := openapi3.ParameterRef{
+		Value: &openapi3.Parameter{
+			Name:            "datetime",
+			Description:     "Date-time instant or interval to restrict results to (as instant, start/end, ../end or start/..). A date is the whole day.",
+			In:              "query",
+			Required:        false,
+			Example:         "2020-01-01T00:00:00Z/2020-06-30T00:00:00Z",
+			Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+			AllowEmptyValue: false,
+		},
+	}
+	paramGeomColumn := openapi3.ParameterRef{
+		Value: &openapi3.Parameter{
+			Name:            "geom-column",
+			Description:     "Geometry column to output and filter, for collections with more than one geometry column. Defaults to the primary geometry column.",
+			In:              "query",
+			Required:        false,
+			Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+			AllowEmptyValue: false,
+		},
+	}
 	paramCrs := openapi3.ParameterRef{
 		Value: &openapi3.Parameter{
 			Name:        "crs",
-			Description: "SRID for coordinate reference system of output features.",
+			Description: "CRS of output features, as a CRS URI (default CRS84). The CRS is given in the Content-Crs response header.",
 			In:          "query",
 			Required:    false,
 			Schema: &openapi3.SchemaRef{
 				Value: &openapi3.Schema{
-					Type:    "integer",
-					Min:     openapi3.Float64Ptr(1),
-					Default: 4326,
+					Type:    "string",
+					Format:  "uri",
+					Default: CrsURICRS84,
 				},
 			},
 			AllowEmptyValue: false,
@@ -201,10 +244,40 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 			AllowEmptyValue: false,
 		},
 	}
+	paramCursor := openapi3.ParameterRef{
+		Value: &openapi3.Parameter{
+			Name:            "cursor",
+			Description:     "Position after which features are returned, as provided in the next link of a previous page. Cannot be combined with offset.",
+			In:              "query",
+			Required:        false,
+			Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+			AllowEmptyValue: false,
+		},
+	}
 	paramSortBy := openapi3.ParameterRef{
 		Value: &openapi3.Parameter{
 			Name:            "sortby",
-			Description:     "Column to sort by.",
+			Description:     "Columns to sort by, each prefixed by + (ascending, the default) or - (descending). Geometry columns are sorted by area(col) or length(col).",
+			In:              "query",
+			Required:        false,
+			Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+			AllowEmptyValue: false,
+		},
+	}
+	paramGroupBy := openapi3.ParameterRef{
+		Value: &openapi3.Parameter{
+			Name:            "groupby",
+			Description:     "Columns to group features by. A feature is returned for each group, with the collected geometries of the group.",
+			In:              "query",
+			Required:        false,
+			Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+			AllowEmptyValue: true,
+		},
+	}
+	paramAggregate := openapi3.ParameterRef{
+		Value: &openapi3.Parameter{
+			Name:            "aggregate",
+			Description:     "Aggregate values computed for each group, such as count(*),sum(pop),avg(area). Functions are count, sum, avg, min and max.",
 			In:              "query",
 			Required:        false,
 			Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
@@ -318,14 +391,20 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 						&paramCollectionID,
 						&paramBbox,
 						&paramBboxCrs,
+						&paramDatetime,
 						&paramFilter,
 						&paramFilterCrs,
+						&paramFilterLang,
+						&paramGeomColumn,
 						&paramTransform,
 						&paramProperties,
+						&paramGroupBy,
+						&paramAggregate,
 						&paramSortBy,
 						&paramCrs,
 						&paramLimit,
 						&paramOffset,
+						&paramCursor,
 						/* TODO
 						&openapi3.ParameterRef{
 							Value: &openapi3.Parameter{
@@ -355,6 +434,42 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 						},
 					},
 				},
+				Post: &openapi3.Operation{
+					OperationID: "postCollectionFeatures",
+					Description: "Provides features matching a filter given in the request body",
+					Parameters: openapi3.Parameters{
+						&paramCollectionID,
+						&paramLimit,
+						&paramOffset,
+						&paramCursor,
+					},
+					RequestBody: &requestBodyFilter,
+					Responses: openapi3.Responses{
+						"200": &openapi3.ResponseRef{
+							Value: &openapi3.Response{
+								Description: "GeoJSON Feature Collection document containing data for features",
+							},
+						},
+					},
+				},
+			},
+			apiBase + "collections/{collectionId}/queryables": &openapi3.PathItem{
+				Summary:     "Queryable properties of collection",
+				Description: "Provides a JSON Schema of the properties of the specified collection which can be used in filters",
+				Get: &openapi3.Operation{
+					OperationID: "getCollectionQueryables",
+					Parameters: openapi3.Parameters{
+						&paramCollectionID},
+					Responses: openapi3.Responses{
+						"200": &openapi3.ResponseRef{
+							Value: &openapi3.Response{
+								Content: openapi3.NewContentWithJSONSchemaRef(
+									&openapi3.SchemaRef{Value: &QueryablesSchema}),
+								Description: "JSON Schema of the queryable properties of the specified collection",
+							},
+						},
+					},
+				},
 			},
 			apiBase + "collections/{collectionId}/items/{featureId}": &openapi3.PathItem{
 				Summary:     "Single feature data from collection",
@@ -373,6 +488,7 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 								AllowEmptyValue: false,
 							},
 						},
+						&paramGeomColumn,
 						&paramProperties,
 						&paramTransform,
 						&paramCrs,
@@ -442,8 +558,11 @@ func GetOpenAPIContent(urlBase string) *openapi3.Swagger {
 						&paramBboxCrs,
 						&paramFilter,
 						&paramFilterCrs,
+						&paramFilterLang,
 						&paramTransform,
 						&paramProperties,
+						&paramGroupBy,
+						&paramAggregate,
 						&paramSortBy,
 						&paramCrs,
 						&paramLimit,
@@ -39,13 +39,26 @@ func setDefaultConfig() {
 	viper.SetDefault("Server.ReadTimeoutSec", 5)
 	viper.SetDefault("Server.WriteTimeoutSec", 30)
 	viper.SetDefault("Server.DisableUi", false)
+	viper.SetDefault("Server.CrsSrids", []int{3857})
 
 	viper.SetDefault("Database.TableIncludes", []string{})
 	viper.SetDefault("Database.TableExcludes", []string{})
 	viper.SetDefault("Database.FunctionIncludes", []string{"postgisftw"})
+	viper.SetDefault("Database.DefaultSrid", 4326)
+	viper.SetDefault("Database.CatalogRefreshIntervalSec", 60)
+	viper.SetDefault("Database.ExtentCacheFile", "")
+	viper.SetDefault("Database.MaxOpenConns", 0)
+	viper.SetDefault("Database.MaxIdleConns", 2)
+	viper.SetDefault("Database.Threads", 0)
+	viper.SetDefault("Database.MemoryLimit", "")
+	viper.SetDefault("Database.TempDirectory", "")
+	viper.SetDefault("Database.ReadOnly", false)
+	viper.SetDefault("Database.MaxResultRows", 0)
+	viper.SetDefault("Database.QueryTimeoutSec", 0)
 
 	viper.SetDefault("Paging.LimitDefault", 10)
 	viper.SetDefault("Paging.LimitMax", 1000)
+	viper.SetDefault("Paging.NumberMatched", NumberMatchedExact)
 
 	viper.SetDefault("Metadata.Title", "duckdb_featureserv")
 	viper.SetDefault("Metadata.Description", "DuckDB Feature Server with Spatial Extension")
@@ -59,12 +72,14 @@ func setDefaultConfig() {
 
 // Config for system
 type Config struct {
-	Server   Server
-	Paging   Paging
-	Metadata Metadata
-	Database Database
-	Website  Website
-	DuckDB   DuckDB
+	Server      Server
+	Paging      Paging
+	Metadata    Metadata
+	Database    Database
+	Website     Website
+	DuckDB      DuckDB
+	Collections map[string]Collection
+	Sources     []Source
 }
 
 // Server config
@@ -83,20 +98,114 @@ type Server struct {
 	WriteTimeoutSec          int
 	DisableUi                bool
 	TransformFunctions       []string
+	// CrsSrids are the EPSG SRIDs of the CRSs supported for output and filtering,
+	// in addition to CRS84, EPSG:4326 and the CRS of each collection
+	CrsSrids []int
 }
 
 // Paging config
 type Paging struct {
 	LimitDefault int
 	LimitMax     int
+	// NumberMatched is how the number of features matching a query is computed
+	// (exact, estimated or none)
+	NumberMatched string
 }
 
+// Values for the NumberMatched settings
+const (
+	NumberMatchedExact     = "exact"
+	NumberMatchedEstimated = "estimated"
+	NumberMatchedNone      = "none"
+)
+
 // Database config
 type Database struct {
 	DatabasePath     string
 	TableIncludes    []string
 	TableExcludes    []string
 	FunctionIncludes []string
+	// DefaultSrid is used for geometry columns with no detectable SRID
+	DefaultSrid int
+	// CatalogRefreshIntervalSec is how often the catalog is checked for schema changes.
+	// Zero disables refreshing
+	CatalogRefreshIntervalSec int
+	// ExtentCacheFile persists the computed collection extents.
+	// The default is the database path with the suffix .extents.json
+	ExtentCacheFile string
+	// MaxOpenConns and MaxIdleConns bound the connection pool. Zero MaxOpenConns is unlimited
+	MaxOpenConns int
+	MaxIdleConns int
+	// Threads, MemoryLimit and TempDirectory are DuckDB resource settings,
+	// which bound the whole DuckDB instance rather than each connection.
+	// Blank or zero values use the DuckDB defaults
+	Threads       int
+	MemoryLimit   string
+	TempDirectory string
+	// ReadOnly opens the database file in read-only access mode
+	ReadOnly bool
+	// MaxResultRows is the maximum number of rows a single query returns,
+	// applied as the LIMIT of feature and function queries. Zero is unlimited
+	MaxResultRows int
+	// QueryTimeoutSec is the maximum time a query may run. Zero is unlimited,
+	// although queries are still cancelled when the request times out
+	QueryTimeoutSec int
+}
+
+// Collection config, for settings specific to a single collection
+// It is keyed by collection ID
+type Collection struct {
+	// Srid is used if the SRID cannot be detected from the data source
+	Srid int
+	// IdColumn is the feature ID column, used if the table has no primary key or unique constraint
+	IdColumn string
+	// TemporalColumn is the time (or start time) of features, used if it is not the first date or timestamp column.
+	// TemporalEndColumn is the end time, for features with a time interval
+	TemporalColumn    string
+	TemporalEndColumn string
+	// QueryTimeoutSec overrides the global query timeout for the collection
+	QueryTimeoutSec int
+	// NumberMatched overrides the global method for computing the number of matched features
+	NumberMatched string
+	// Queryables restricts the columns which can be used in filters. By default all columns can be
+	Queryables []string
+
+	// Metadata overriding or extending that read from the database
+	Title       string
+	Description string
+	Keywords    []string
+	License     string
+	Attribution string
+	Links       []CollectionLink
+	// Columns provides descriptions for columns, keyed by column name
+	Columns map[string]string
+}
+
+// Source config, for a data file (or files) published as a collection
+// without needing to be loaded into a database
+type Source struct {
+	// Name is the collection table name. Defaults to the layer or file name
+	Name string
+	// Path is a file path, URL, glob or directory of Parquet files.
+	// Parquet files are read with read_parquet, other formats with ST_Read
+	Path string
+	// Layer is the layer to read from a multi-layer file such as a GeoPackage
+	Layer string
+	// GeometryColumn is the geometry column, if it cannot be detected
+	GeometryColumn string
+	// IdColumn is the feature ID column
+	IdColumn string
+	// HivePartitioning reads Parquet files with hive partitioning.
+	// It is enabled for directories and for paths containing key=value directories
+	HivePartitioning bool
+}
+
+// CollectionLink is a link to a resource related to a collection
+type CollectionLink struct {
+	Href  string
+	Rel   string
+	Type  string
+	Title string
 }
 
 // Metadata config
@@ -116,6 +225,35 @@ type DuckDB struct {
 	ApiKey           string
 }
 
+// CollectionConfig returns the configuration for a collection ID, if any.
+// IDs are matched case-insensitively, since Viper lowercases config keys
+func (conf *Config) CollectionConfig(id string) (Collection, bool) {
+	coll, ok := conf.Collections[strings.ToLower(id)]
+	return coll, ok
+}
+
+// NumberMatched returns how the number of matched features is computed for a collection.
+// Unrecognized values are treated as exact
+func (conf *Config) NumberMatched(id string) string {
+	mode := conf.Paging.NumberMatched
+	if coll, ok := conf.CollectionConfig(id); ok && coll.NumberMatched != "" {
+		mode = coll.NumberMatched
+	}
+	switch strings.ToLower(mode) {
+	case NumberMatchedEstimated:
+		return NumberMatchedEstimated
+	case NumberMatchedNone:
+		return NumberMatchedNone
+	}
+	return NumberMatchedExact
+}
+
+// SourceFromSpec creates a data source from a specification of the form PATH[#LAYER]
+func SourceFromSpec(spec string) Source {
+	path, layer, _ := strings.Cut(spec, "#")
+	return Source{Path: path, Layer: layer}
+}
+
 // IsHTTPSEnabled tests whether HTTPS is enabled
 func (conf *Config) IsTLSEnabled() bool {
 	return conf.Server.TlsServerCertificateFile != "" && conf.Server.TlsServerPrivateKeyFile != ""
@@ -162,6 +300,13 @@ func InitConfig(configFilename string, isDebug bool) {
 	if errUnM != nil {
 		log.Fatal(fmt.Errorf("fatal error decoding config file: %v", errUnM))
 	}
+	// Collection IDs contain dots, which Viper treats as key separators.
+	// Decoding the section directly keeps the IDs intact
+	Configuration.Collections = make(map[string]Collection)
+	errUnM = viper.UnmarshalKey("Collections", &Configuration.Collections)
+	if errUnM != nil {
+		log.Fatal(fmt.Errorf("fatal error decoding Collections config: %v", errUnM))
+	}
 
 	// Read environment variable database configuration
 	// It takes precedence over config file (if any)
@@ -192,8 +337,22 @@ func DumpConfig() {
 		basemapURL = "*** NO URL PROVIDED ***"
 	}
 	log.Debugf("  BasemapUrl = %v", basemapURL)
+	log.Debugf("  NumberMatched = %v", Configuration.Paging.NumberMatched)
 	log.Debugf("  TableIncludes = %v", Configuration.Database.TableIncludes)
 	log.Debugf("  TableExcludes = %v", Configuration.Database.TableExcludes)
 	log.Debugf("  FunctionIncludes = %v", Configuration.Database.FunctionIncludes)
+	log.Debugf("  CatalogRefreshIntervalSec = %v", Configuration.Database.CatalogRefreshIntervalSec)
+	log.Debugf("  DefaultSrid = %v", Configuration.Database.DefaultSrid)
+	log.Debugf("  ExtentCacheFile = %v", Configuration.Database.ExtentCacheFile)
+	log.Debugf("  MaxOpenConns = %v", Configuration.Database.MaxOpenConns)
+	log.Debugf("  MaxIdleConns = %v", Configuration.Database.MaxIdleConns)
+	log.Debugf("  Threads = %v", Configuration.Database.Threads)
+	log.Debugf("  MemoryLimit = %v", Configuration.Database.MemoryLimit)
+	log.Debugf("  TempDirectory = %v", Configuration.Database.TempDirectory)
+	log.Debugf("  ReadOnly = %v", Configuration.Database.ReadOnly)
+	log.Debugf("  MaxResultRows = %v", Configuration.Database.MaxResultRows)
+	log.Debugf("  QueryTimeoutSec = %v", Configuration.Database.QueryTimeoutSec)
+	log.Debugf("  Sources = %v", Configuration.Sources)
 	log.Debugf("  TransformFunctions = %v", Configuration.Server.TransformFunctions)
+	log.Debugf("  CrsSrids = %v", Configuration.Server.CrsSrids)
 }
@@ -438,6 +438,123 @@ ApiKey = "file_key"
 	equals(t, "file_key", Configuration.DuckDB.ApiKey, "ApiKey from config")
 }
 
+// TestCollectionsConfigFromFile tests that per-collection sections keep dotted collection IDs
+func TestCollectionsConfigFromFile(t *testing.T) {
+	clearConfigEnvVars()
+	defer clearConfigEnvVars()
+
+	configContent := `
+[Database]
+DefaultSrid = 3857
+
+[Paging]
+NumberMatched = "estimated"
+
+[Collections."db.main.Parcels"]
+Srid = 2193
+NumberMatched = "None"
+IdColumn = "parcel_id"
+Title = "Land Parcels"
+Description = "Cadastral parcels"
+Keywords = [ "cadastre", "parcels" ]
+License = "CC-BY-4.0"
+Attribution = "Land Information"
+
+[[Collections."db.main.Parcels".Links]]
+Href = "https://example.com/parcels"
+Rel = "describedby"
+Title = "About parcels"
+
+[Collections."db.main.Parcels".Columns]
+Appellation = "Legal description"
+
+[Collections.roads]
+Srid = 27700
+`
+
+	tempDir, err := os.MkdirTemp("", "duckdb_featureserv_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	configFile := filepath.Join(tempDir, "test_config.toml")
+	err = os.WriteFile(configFile, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Reset()
+	InitConfig(configFile, false)
+
+	equals(t, 3857, Configuration.Database.DefaultSrid, "DefaultSrid from config")
+
+	coll, ok := Configuration.CollectionConfig("db.main.parcels")
+	equals(t, true, ok, "dotted collection ID found")
+	equals(t, 2193, coll.Srid, "dotted collection Srid")
+	equals(t, "parcel_id", coll.IdColumn, "dotted collection IdColumn")
+	equals(t, "Land Parcels", coll.Title, "collection Title")
+	equals(t, "Cadastral parcels", coll.Description, "collection Description")
+	equals(t, []string{"cadastre", "parcels"}, coll.Keywords, "collection Keywords")
+	equals(t, "CC-BY-4.0", coll.License, "collection License")
+	equals(t, "Land Information", coll.Attribution, "collection Attribution")
+	equals(t, []CollectionLink{{Href: "https://example.com/parcels", Rel: "describedby", Title: "About parcels"}}, coll.Links, "collection Links")
+	equals(t, "Legal description", coll.Columns["appellation"], "column description")
+
+	coll, ok = Configuration.CollectionConfig("ROADS")
+	equals(t, true, ok, "collection ID found case-insensitively")
+	equals(t, 27700, coll.Srid, "collection Srid")
+
+	_, ok = Configuration.CollectionConfig("db")
+	equals(t, false, ok, "ID prefix is not a collection")
+
+	equals(t, NumberMatchedNone, Configuration.NumberMatched("db.main.parcels"), "collection NumberMatched")
+	equals(t, NumberMatchedEstimated, Configuration.NumberMatched("roads"), "global NumberMatched")
+}
+
+// TestSourcesConfigFromFile tests reading data file sources
+func TestSourcesConfigFromFile(t *testing.T) {
+	clearConfigEnvVars()
+	defer clearConfigEnvVars()
+
+	configContent := `
+[[Sources]]
+Path = "data/points/*.parquet"
+IdColumn = "fid"
+
+[[Sources]]
+Name = "lines"
+Path = "data/lines.gpkg"
+Layer = "ws_line"
+GeometryColumn = "geom"
+`
+
+	tempDir, err := os.MkdirTemp("", "duckdb_featureserv_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	configFile := filepath.Join(tempDir, "test_config.toml")
+	err = os.WriteFile(configFile, []byte(configContent), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Reset()
+	InitConfig(configFile, false)
+
+	equals(t, 2, len(Configuration.Sources), "number of sources")
+	equals(t, Source{Path: "data/points/*.parquet", IdColumn: "fid"}, Configuration.Sources[0], "glob source")
+	equals(t, Source{Name: "lines", Path: "data/lines.gpkg", Layer: "ws_line", GeometryColumn: "geom"},
+		Configuration.Sources[1], "layer source")
+}
+
+func TestSourceFromSpec(t *testing.T) {
+	equals(t, Source{Path: "data/*.parquet"}, SourceFromSpec("data/*.parquet"), "path only")
+	equals(t, Source{Path: "data/ws.gpkg", Layer: "ws_line"}, SourceFromSpec("data/ws.gpkg#ws_line"), "path and layer")
+}
+
 // Helper function to clear all configuration-related environment variables
 func clearConfigEnvVars() {
 	envVars := []string{
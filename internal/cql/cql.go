@@ -21,9 +21,13 @@ import (
 
 	"github.com/antlr/antlr4/runtime/Go/antlr"
 	log "github.com/sirupsen/logrus"
+	"github.com/tobilg/duckdb_featureserv/internal/data"
 )
 
-func TranspileToSQL(cqlStr string, filterSRID int, sourceSRID int) (string, error) {
+// TranspileToSQL converts a CQL filter to a SQL condition.
+// Geometry literals in the filter CRS are transformed to the source SRID.
+// If queryables is not nil, the filter may only use the properties it lists
+func TranspileToSQL(cqlStr string, filterCrs data.Crs, sourceSRID int, queryables []string) (string, error) {
 	if len(cqlStr) < 1 {
 		return "", nil
 	}
@@ -45,7 +49,8 @@ func TranspileToSQL(cqlStr string, filterSRID int, sourceSRID int) (string, erro
 
 	tree := parser.CqlFilter()
 	//-- parse the CQL expression
-	listener := NewCqlListener(filterSRID, sourceSRID)
+	listener := NewCqlListener(filterCrs, sourceSRID)
+	listener.setQueryables(queryables)
 	antlr.ParseTreeWalkerDefault.Walk(listener, tree)
 
 	if parseErrors.errorCount > 0 {
@@ -54,6 +59,9 @@ func TranspileToSQL(cqlStr string, filterSRID int, sourceSRID int) (string, erro
 		err := fmt.Errorf("CQL syntax error: %s", msg)
 		return "", err
 	}
+	if listener.nonQueryable != "" {
+		return "", fmt.Errorf("CQL filter property is not queryable: %s", listener.nonQueryable)
+	}
 	return listener.GetSQL(), nil
 }
 
@@ -113,18 +121,22 @@ func (l *CqlErrorListener) ReportContextSensitivity(recognizer antlr.Parser, dfa
 
 type cqlListener struct {
 	*BaseCQLParserListener
-	// SRID for filter CRS
-	filterSRID int
+	// filter CRS
+	filterCrs data.Crs
 	// SRID for source CRS
 	sourceSRID int
+	// lowercase names of the properties which can be used, or nil if any can be
+	queryables map[string]bool
+	// the first property used which is not queryable
+	nonQueryable string
 
 	// final result SQL
 	sql string
 }
 
-func NewCqlListener(filterSRID int, sourceSRID int) *cqlListener {
+func NewCqlListener(filterCrs data.Crs, sourceSRID int) *cqlListener {
 	this := new(cqlListener)
-	this.filterSRID = filterSRID
+	this.filterCrs = filterCrs
 	this.sourceSRID = sourceSRID
 	return this
 }
@@ -132,6 +144,32 @@ func (l *cqlListener) GetSQL() string {
 	return l.sql
 }
 
+func (l *cqlListener) setQueryables(names []string) {
+	if names == nil {
+		return
+	}
+	l.queryables = make(map[string]bool)
+	for _, name := range names {
+		l.queryables[strings.ToLower(name)] = true
+	}
+}
+
+// propertyName provides the SQL for a property name, recording it if it is not queryable.
+// Names are matched case-insensitively, as DuckDB identifiers are
+func (l *cqlListener) propertyName(ctx antlr.ParserRuleContext) string {
+	return l.checkedName(getText(ctx))
+}
+
+// checkedName provides the SQL for a property name (which may be quoted),
+// recording it if it is not queryable
+func (l *cqlListener) checkedName(name string) string {
+	isQueryable := l.queryables == nil || l.queryables[strings.ToLower(strings.Trim(name, "\""))]
+	if !isQueryable && l.nonQueryable == "" {
+		l.nonQueryable = name
+	}
+	return quotedName(name)
+}
+
 func (l *cqlListener) sqlGeometryLiteral(wkt string) string {
 	// DuckDB spatial uses ST_GeomFromText without SRID prefix
 	sql := fmt.Sprintf("ST_GeomFromText('%s')", wkt)
@@ -143,11 +181,24 @@ func (l *cqlListener) sqlEnvelopeLiteral(xmin string, ymin string, xmax string,
 	return fmt.Sprintf("ST_MakeEnvelope(%s::DOUBLE,%s::DOUBLE,%s::DOUBLE,%s::DOUBLE)", xmin, ymin, xmax, ymax)
 }
 
+// sqlTransformCrs transforms a geometry literal from the filter CRS to the source CRS.
+// Literals in latitude/longitude axis order are flipped to x/y order first.
+// DuckDB geometries have no SRID, so both CRSs are given explicitly
 func (l *cqlListener) sqlTransformCrs(sql string) string {
-	if l.sourceSRID == l.filterSRID {
+	if l.filterCrs.IsLatLon {
+		sql = fmt.Sprintf("ST_FlipCoordinates(%s)", sql)
+	}
+	filterSRID, sourceSRID := l.filterCrs.Srid, l.sourceSRID
+	if filterSRID <= 0 {
+		filterSRID = data.SRID_4326
+	}
+	if sourceSRID <= 0 {
+		sourceSRID = data.SRID_4326
+	}
+	if sourceSRID == filterSRID {
 		return sql
 	}
-	return fmt.Sprintf("ST_Transform(%s,%d)", sql, l.sourceSRID)
+	return fmt.Sprintf("ST_Transform(%s,'EPSG:%d','EPSG:%d',true)", sql, filterSRID, sourceSRID)
 }
 
 // helper function to avoid nil pointer problems
@@ -302,7 +353,7 @@ func (l *cqlListener) ExitBinaryComparisonPredicate(ctx *BinaryComparisonPredica
 }
 
 func (l *cqlListener) ExitLiteralName(ctx *LiteralNameContext) {
-	sql := quotedName(getText(ctx.PropertyName()))
+	sql := l.propertyName(ctx.PropertyName())
 	ctx.SetSql(sql)
 }
 
@@ -346,7 +397,7 @@ func (l *cqlListener) ExitScalarExpr(ctx *ScalarExprContext) {
 
 func (l *cqlListener) ExitIsLikePredicate(ctx *IsLikePredicateContext) {
 	var sb strings.Builder
-	sb.WriteString(quotedName(getText(ctx.PropertyName())))
+	sb.WriteString(l.propertyName(ctx.PropertyName()))
 	if ctx.NOT() != nil {
 		sb.WriteString(" NOT")
 	}
@@ -372,7 +423,7 @@ func (l *cqlListener) ExitIsBetweenPredicate(ctx *IsBetweenPredicateContext) {
 }
 
 func (l *cqlListener) ExitIsNullPredicate(ctx *IsNullPredicateContext) {
-	prop := quotedName(getText(ctx.PropertyName()))
+	prop := l.propertyName(ctx.PropertyName())
 	not := ""
 	if ctx.NOT() != nil {
 		not = " NOT"
@@ -383,7 +434,7 @@ func (l *cqlListener) ExitIsNullPredicate(ctx *IsNullPredicateContext) {
 
 func (l *cqlListener) ExitIsInListPredicate(ctx *IsInListPredicateContext) {
 	var sb strings.Builder
-	sb.WriteString(quotedName(getText(ctx.PropertyName())))
+	sb.WriteString(l.propertyName(ctx.PropertyName()))
 	if ctx.NOT() != nil {
 		sb.WriteString(" NOT")
 	}
@@ -445,7 +496,7 @@ func (l *cqlListener) ExitDistancePredicate(ctx *DistancePredicateContext) {
 func (l *cqlListener) ExitGeomExpression(ctx *GeomExpressionContext) {
 	var sb strings.Builder
 	if ctx.PropertyName() != nil {
-		sb.WriteString(quotedName(getText(ctx.PropertyName())))
+		sb.WriteString(l.propertyName(ctx.PropertyName()))
 	} else {
 		sb.WriteString(sqlFor(ctx.GeomLiteral()))
 	}
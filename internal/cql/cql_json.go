@@ -0,0 +1,540 @@
+package cql
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/tobilg/duckdb_featureserv/internal/data"
+)
+
+// TranspileJSONToSQL converts a CQL2-JSON filter to a SQL condition.
+// It supports the same predicates as the CQL2 text parser, and produces the same SQL for them.
+// Geometry literals in the filter CRS are transformed to the source SRID.
+// If queryables is not nil, the filter may only use the properties it lists
+func TranspileJSONToSQL(jsonStr string, filterCrs data.Crs, sourceSRID int, queryables []string) (string, error) {
+	if len(strings.TrimSpace(jsonStr)) < 1 {
+		return "", nil
+	}
+	//-- numbers are kept as text, so they appear in the SQL as written
+	decoder := json.NewDecoder(strings.NewReader(jsonStr))
+	decoder.UseNumber()
+	var filter interface{}
+	if err := decoder.Decode(&filter); err != nil {
+		return "", fmt.Errorf("CQL2-JSON syntax error: %v", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return "", fmt.Errorf("CQL2-JSON syntax error: unexpected content after filter")
+	}
+
+	transpiler := jsonTranspiler{NewCqlListener(filterCrs, sourceSRID)}
+	transpiler.setQueryables(queryables)
+	sql, err := transpiler.boolExpr(filter)
+	if err != nil {
+		return "", err
+	}
+	if transpiler.nonQueryable != "" {
+		return "", fmt.Errorf("CQL filter property is not queryable: %s", transpiler.nonQueryable)
+	}
+	return sql, nil
+}
+
+// jsonTranspiler generates SQL for a decoded CQL2-JSON expression.
+// It uses the SQL literals and property checks of the CQL text listener
+type jsonTranspiler struct {
+	*cqlListener
+}
+
+// operators which are negated by adding NOT to the predicate, as in CQL text
+var jsonNegatableOps = map[string]bool{
+	"like":    true,
+	"between": true,
+	"in":      true,
+	"isnull":  true,
+}
+
+var jsonComparisonOps = map[string]bool{
+	"=":  true,
+	"<>": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+}
+
+// precedence of the arithmetic operators, used to parenthesize nested expressions
+var jsonArithmeticOps = map[string]int{
+	"+": 1,
+	"-": 1,
+	"*": 2,
+	"/": 2,
+	"%": 2,
+	"^": 3,
+}
+
+// GeoJSON geometry types, with the nesting depth of their coordinate arrays
+var jsonGeometryDepth = map[string]int{
+	"POINT":           0,
+	"LINESTRING":      1,
+	"MULTIPOINT":      1,
+	"POLYGON":         2,
+	"MULTILINESTRING": 2,
+	"MULTIPOLYGON":    3,
+}
+
+var reTemporalLiteral = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:\d{2})?)?$`)
+
+func jsonError(format string, args ...interface{}) error {
+	return fmt.Errorf("CQL2-JSON error: "+format, args...)
+}
+
+// jsonText provides a node as JSON, for error messages
+func jsonText(node interface{}) string {
+	text, err := json.Marshal(node)
+	if err != nil {
+		return fmt.Sprintf("%v", node)
+	}
+	return string(text)
+}
+
+// jsonOp provides the lowercase operator and the arguments of an operation node
+func jsonOp(node interface{}) (string, []interface{}, bool) {
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return "", nil, false
+	}
+	op, ok := obj["op"].(string)
+	if !ok {
+		return "", nil, false
+	}
+	args, _ := obj["args"].([]interface{})
+	return strings.ToLower(op), args, true
+}
+
+// jsonMember provides the value of a single-member object node with the given key
+func jsonMember(node interface{}, key string) (interface{}, bool) {
+	obj, ok := node.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		return nil, false
+	}
+	val, ok := obj[key]
+	return val, ok
+}
+
+func checkArgCount(op string, args []interface{}, count int) error {
+	if len(args) != count {
+		return jsonError("operator %s requires %d arguments", op, count)
+	}
+	return nil
+}
+
+func (t *jsonTranspiler) boolExpr(node interface{}) (string, error) {
+	if val, ok := node.(bool); ok {
+		return boolLiteral(val), nil
+	}
+	op, args, ok := jsonOp(node)
+	if !ok {
+		return "", jsonError("expected a boolean expression: %s", jsonText(node))
+	}
+	switch op {
+	case "and", "or":
+		if len(args) < 2 {
+			return "", jsonError("operator %s requires at least 2 arguments", op)
+		}
+		terms := make([]string, len(args))
+		for i, arg := range args {
+			term, err := t.boolTerm(arg, op)
+			if err != nil {
+				return "", err
+			}
+			terms[i] = term
+		}
+		return strings.Join(terms, " "+strings.ToUpper(op)+" "), nil
+	case "not":
+		if err := checkArgCount(op, args, 1); err != nil {
+			return "", err
+		}
+		if argOp, argArgs, ok := jsonOp(args[0]); ok && jsonNegatableOps[argOp] {
+			return t.predicate(argOp, argArgs, true)
+		}
+		term, err := t.boolTerm(args[0], op)
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + term, nil
+	}
+	return t.predicate(op, args, false)
+}
+
+// boolTerm provides the SQL for an argument of a boolean operator,
+// parenthesized if it is an OR in an AND, or an AND or OR in a NOT
+func (t *jsonTranspiler) boolTerm(node interface{}, parentOp string) (string, error) {
+	sql, err := t.boolExpr(node)
+	if err != nil {
+		return "", err
+	}
+	op, _, _ := jsonOp(node)
+	isParen := op == "or" && parentOp != "or" || op == "and" && parentOp == "not"
+	if isParen {
+		return "(" + sql + ")", nil
+	}
+	return sql, nil
+}
+
+func (t *jsonTranspiler) predicate(op string, args []interface{}, isNot bool) (string, error) {
+	not := ""
+	if isNot {
+		not = " NOT"
+	}
+	switch {
+	case jsonComparisonOps[op]:
+		if err := checkArgCount(op, args, 2); err != nil {
+			return "", err
+		}
+		return t.binaryExpr(op, args)
+	case op == "like":
+		return t.likePredicate(args, not)
+	case op == "between":
+		if err := checkArgCount(op, args, 3); err != nil {
+			return "", err
+		}
+		exprs, err := t.scalarList(args)
+		if err != nil {
+			return "", err
+		}
+		return " " + exprs[0] + not + " BETWEEN " + exprs[1] + " AND " + exprs[2], nil
+	case op == "in":
+		return t.inPredicate(args, not)
+	case op == "isnull":
+		if err := checkArgCount(op, args, 1); err != nil {
+			return "", err
+		}
+		prop, err := t.property(args[0])
+		if err != nil {
+			return "", err
+		}
+		return " " + prop + " IS" + not + " NULL", nil
+	}
+	return t.spatialPredicate(op, args)
+}
+
+func (t *jsonTranspiler) likePredicate(args []interface{}, not string) (string, error) {
+	if err := checkArgCount("like", args, 2); err != nil {
+		return "", err
+	}
+	//-- a case-insensitive match is expressed by applying CASEI to both arguments
+	propArg, isCaseiProp := casei(args[0])
+	patternArg, isCaseiPattern := casei(args[1])
+	if isCaseiProp != isCaseiPattern {
+		return "", jsonError("CASEI must be applied to both arguments of like")
+	}
+	prop, err := t.property(propArg)
+	if err != nil {
+		return "", err
+	}
+	pattern, ok := patternArg.(string)
+	if !ok {
+		return "", jsonError("like pattern must be a string: %s", jsonText(patternArg))
+	}
+	op := " LIKE "
+	if isCaseiProp {
+		op = " ILIKE "
+	}
+	return prop + not + op + stringLiteral(pattern), nil
+}
+
+// casei provides the argument of a CASEI function node
+func casei(node interface{}) (interface{}, bool) {
+	op, args, ok := jsonOp(node)
+	if !ok || op != "casei" || len(args) != 1 {
+		return node, false
+	}
+	return args[0], true
+}
+
+func (t *jsonTranspiler) inPredicate(args []interface{}, not string) (string, error) {
+	if err := checkArgCount("in", args, 2); err != nil {
+		return "", err
+	}
+	prop, err := t.property(args[0])
+	if err != nil {
+		return "", err
+	}
+	list, ok := args[1].([]interface{})
+	if !ok || len(list) == 0 {
+		return "", jsonError("in requires a list of values: %s", jsonText(args[1]))
+	}
+	//-- as in CQL text, the list is all numbers or all strings
+	vals := make([]string, len(list))
+	_, isNumList := list[0].(json.Number)
+	for i, item := range list {
+		switch val := item.(type) {
+		case json.Number:
+			ok = isNumList
+			vals[i] = val.String()
+		case string:
+			ok = !isNumList
+			vals[i] = stringLiteral(val)
+		default:
+			ok = false
+		}
+		if !ok {
+			return "", jsonError("in list values must be all numbers or all strings: %s", jsonText(list))
+		}
+	}
+	return prop + not + " IN (" + strings.Join(vals, ",") + ") ", nil
+}
+
+func (t *jsonTranspiler) spatialPredicate(op string, args []interface{}) (string, error) {
+	//-- spatial operators are prefixed in CQL2
+	fun, ok := pgFunctionForCql[strings.TrimPrefix(op, "s_")]
+	if !ok {
+		return "", jsonError("unsupported operator: %s", op)
+	}
+	argCount := 2
+	if fun == "ST_DWithin" {
+		argCount = 3
+	}
+	if err := checkArgCount(op, args, argCount); err != nil {
+		return "", err
+	}
+	geoms := make([]string, 2)
+	for i := range geoms {
+		geom, err := t.geomExpr(args[i])
+		if err != nil {
+			return "", err
+		}
+		geoms[i] = geom
+	}
+	if argCount == 3 {
+		dist, ok := args[2].(json.Number)
+		if !ok {
+			return "", jsonError("distance must be a number: %s", jsonText(args[2]))
+		}
+		geoms = append(geoms, dist.String())
+	}
+	return fun + "(" + strings.Join(geoms, ",") + ")", nil
+}
+
+func (t *jsonTranspiler) binaryExpr(op string, args []interface{}) (string, error) {
+	exprs, err := t.scalarList(args)
+	if err != nil {
+		return "", err
+	}
+	return exprs[0] + " " + op + " " + exprs[1], nil
+}
+
+func (t *jsonTranspiler) scalarList(args []interface{}) ([]string, error) {
+	exprs := make([]string, len(args))
+	for i, arg := range args {
+		expr, err := t.scalarExpr(arg)
+		if err != nil {
+			return nil, err
+		}
+		exprs[i] = expr
+	}
+	return exprs, nil
+}
+
+func (t *jsonTranspiler) scalarExpr(node interface{}) (string, error) {
+	switch val := node.(type) {
+	case string:
+		return stringLiteral(val), nil
+	case json.Number:
+		return val.String(), nil
+	case bool:
+		return boolLiteral(val), nil
+	}
+	if op, args, ok := jsonOp(node); ok {
+		return t.arithmeticExpr(op, args)
+	}
+	if _, ok := jsonMember(node, "property"); ok {
+		return t.property(node)
+	}
+	if sql, ok, err := temporalLiteral(node); ok {
+		return sql, err
+	}
+	return "", jsonError("unsupported value: %s", jsonText(node))
+}
+
+func (t *jsonTranspiler) arithmeticExpr(op string, args []interface{}) (string, error) {
+	prec, ok := jsonArithmeticOps[op]
+	if !ok {
+		return "", jsonError("unsupported operator in expression: %s", op)
+	}
+	if err := checkArgCount(op, args, 2); err != nil {
+		return "", err
+	}
+	exprs, err := t.scalarList(args)
+	if err != nil {
+		return "", err
+	}
+	//-- parenthesize operands which would otherwise bind differently
+	for i, arg := range args {
+		argOp, _, _ := jsonOp(arg)
+		if argPrec, ok := jsonArithmeticOps[argOp]; ok && (argPrec < prec || i > 0 && argPrec == prec) {
+			exprs[i] = "(" + exprs[i] + ")"
+		}
+	}
+	return exprs[0] + " " + op + " " + exprs[1], nil
+}
+
+func (t *jsonTranspiler) property(node interface{}) (string, error) {
+	val, _ := jsonMember(node, "property")
+	name, ok := val.(string)
+	if !ok || name == "" || strings.Contains(name, "\"") {
+		return "", jsonError("expected a property: %s", jsonText(node))
+	}
+	return t.checkedName(name), nil
+}
+
+func (t *jsonTranspiler) geomExpr(node interface{}) (string, error) {
+	if _, ok := jsonMember(node, "property"); ok {
+		return t.property(node)
+	}
+	if bbox, ok := jsonMember(node, "bbox"); ok {
+		return t.envelope(bbox)
+	}
+	wkt, err := geometryWKT(node)
+	if err != nil {
+		return "", err
+	}
+	return t.sqlTransformCrs(t.sqlGeometryLiteral(wkt)), nil
+}
+
+func (t *jsonTranspiler) envelope(node interface{}) (string, error) {
+	nums, ok := node.([]interface{})
+	if !ok || len(nums) != 4 && len(nums) != 6 {
+		return "", jsonError("bbox requires 4 or 6 numbers: %s", jsonText(node))
+	}
+	//-- only the 2D extent is used
+	if len(nums) == 6 {
+		nums = []interface{}{nums[0], nums[1], nums[3], nums[4]}
+	}
+	ords, err := ordinates(nums)
+	if err != nil {
+		return "", err
+	}
+	sql := t.sqlEnvelopeLiteral(ords[0], ords[1], ords[2], ords[3])
+	return t.sqlTransformCrs(sql), nil
+}
+
+// geometryWKT converts a GeoJSON geometry to WKT in the form CQL text literals have
+func geometryWKT(node interface{}) (string, error) {
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return "", jsonError("expected a geometry: %s", jsonText(node))
+	}
+	geomType, _ := obj["type"].(string)
+	geomType = strings.ToUpper(geomType)
+	if geomType == "GEOMETRYCOLLECTION" {
+		geoms, ok := obj["geometries"].([]interface{})
+		if !ok || len(geoms) == 0 {
+			return "", jsonError("invalid geometry collection: %s", jsonText(node))
+		}
+		wkts := make([]string, len(geoms))
+		for i, geom := range geoms {
+			wkt, err := geometryWKT(geom)
+			if err != nil {
+				return "", err
+			}
+			wkts[i] = wkt
+		}
+		return geomType + "(" + strings.Join(wkts, ",") + ")", nil
+	}
+	depth, ok := jsonGeometryDepth[geomType]
+	if !ok {
+		return "", jsonError("expected a geometry: %s", jsonText(node))
+	}
+	coords, err := coordinatesWKT(obj["coordinates"], depth, geomType == "MULTIPOINT")
+	if err != nil {
+		return "", err
+	}
+	return geomType + "(" + coords + ")", nil
+}
+
+// coordinatesWKT converts GeoJSON coordinates nested to the given depth to WKT.
+// Nested lists are parenthesized, as are the points of a MultiPoint
+func coordinatesWKT(node interface{}, depth int, isMultiPoint bool) (string, error) {
+	list, ok := node.([]interface{})
+	if !ok || len(list) == 0 {
+		return "", jsonError("invalid coordinates: %s", jsonText(node))
+	}
+	if depth == 0 {
+		if len(list) < 2 || len(list) > 4 {
+			return "", jsonError("invalid position: %s", jsonText(node))
+		}
+		ords, err := ordinates(list)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(ords, " "), nil
+	}
+	parts := make([]string, len(list))
+	for i, item := range list {
+		part, err := coordinatesWKT(item, depth-1, false)
+		if err != nil {
+			return "", err
+		}
+		if depth > 1 || isMultiPoint {
+			part = "(" + part + ")"
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func ordinates(nums []interface{}) ([]string, error) {
+	ords := make([]string, len(nums))
+	for i, num := range nums {
+		ord, ok := num.(json.Number)
+		if !ok {
+			return nil, jsonError("invalid coordinate: %s", jsonText(num))
+		}
+		ords[i] = ord.String()
+	}
+	return ords, nil
+}
+
+// temporalLiteral provides the SQL for a date or timestamp node, if the node is one
+func temporalLiteral(node interface{}) (string, bool, error) {
+	val, ok := jsonMember(node, "timestamp")
+	if !ok {
+		val, ok = jsonMember(node, "date")
+	}
+	if !ok {
+		return "", false, nil
+	}
+	text, _ := val.(string)
+	text = strings.ToUpper(text)
+	if !reTemporalLiteral.MatchString(text) {
+		return "", true, jsonError("invalid temporal value: %s", jsonText(node))
+	}
+	return fmt.Sprintf("timestamp '%s'", text), true, nil
+}
+
+func stringLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func boolLiteral(val bool) string {
+	if val {
+		return "TRUE"
+	}
+	return "FALSE"
+}
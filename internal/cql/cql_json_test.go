@@ -0,0 +1,181 @@
+package cql
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tobilg/duckdb_featureserv/internal/data"
+)
+
+func TestJSONComparisonPredicate(t *testing.T) {
+	checkJSON(t, "", "")
+	checkJSON(t, `{"op":">","args":[{"property":"id"},{"property":"tt"}]}`, "id > tt")
+	checkJSON(t, `{"op":">=","args":[{"property":"id"},1]}`, "id >= 1")
+	checkJSON(t, `{"op":"<","args":[{"property":"id"},1]}`, "id < 1")
+	checkJSON(t, `{"op":"<=","args":[{"property":"id"},1]}`, "id <= 1")
+	checkJSON(t, `{"op":"=","args":[{"property":"id"},-1.2345]}`, "id = -1.2345")
+	checkJSON(t, `{"op":"<>","args":[{"property":"id"},"foo"]}`, "id <> 'foo'")
+	checkJSON(t, `{"op":">","args":[{"property":"p"},1.0E+1]}`, "p > 1.0E+1")
+	checkJSON(t, `{"op":"=","args":[{"property":"ns:Prop_Name$"},1]}`, `"ns:Prop_Name$" = 1`)
+	checkJSON(t, `{"op":"=","args":[{"property":"name"},"O'Brien"]}`, "name = 'O''Brien'")
+}
+
+func TestJSONLikePredicate(t *testing.T) {
+	checkJSON(t, `{"op":"like","args":[{"property":"id"},"foo"]}`, "id LIKE 'foo'")
+	checkJSON(t, `{"op":"not","args":[{"op":"like","args":[{"property":"id"},"foo"]}]}`, "id NOT LIKE 'foo'")
+	checkJSON(t, `{"op":"like","args":[{"op":"casei","args":[{"property":"id"}]},{"op":"casei","args":["%Ca%"]}]}`,
+		"id ILIKE '%Ca%'")
+}
+
+func TestJSONBetweenPredicate(t *testing.T) {
+	checkJSON(t, `{"op":"between","args":[{"property":"id"},1,2]}`, "id BETWEEN 1 and 2")
+	checkJSON(t, `{"op":"not","args":[{"op":"between","args":[{"property":"id"},1,2]}]}`, "id NOT BETWEEN 1 and 2")
+}
+
+func TestJSONInPredicate(t *testing.T) {
+	checkJSON(t, `{"op":"in","args":[{"property":"id"},[1,2,3]]}`, "id IN (1,2,3)")
+	checkJSON(t, `{"op":"not","args":[{"op":"in","args":[{"property":"id"},[1,2,3]]}]}`, "id NOT IN (1,2,3)")
+	checkJSON(t, `{"op":"in","args":[{"property":"id"},["a","b","c"]]}`, "id IN ('a','b','c')")
+}
+
+func TestJSONNullPredicate(t *testing.T) {
+	checkJSON(t, `{"op":"isNull","args":[{"property":"id"}]}`, "id IS NULL")
+	checkJSON(t, `{"op":"not","args":[{"op":"isNull","args":[{"property":"id"}]}]}`, "id IS NOT NULL")
+}
+
+func TestJSONSpatialPredicate(t *testing.T) {
+	point := `{"type":"Point","coordinates":[0,0]}`
+	for _, op := range []string{"crosses", "contains", "disjoint", "equals", "intersects", "overlaps", "touches", "within"} {
+		checkJSON(t, `{"op":"s_`+op+`","args":[{"property":"geom"},`+point+`]}`, op+"(geom, POINT(0 0))")
+	}
+	checkJSON(t, `{"op":"s_dwithin","args":[{"property":"geom"},`+point+`,100]}`, "Dwithin(geom, POINT(0 0), 100)")
+}
+
+func TestJSONArithmetic(t *testing.T) {
+	checkJSON(t, `{"op":">","args":[{"property":"p"},{"op":"+","args":[1,{"property":"x"}]}]}`, "p > 1 + x")
+	checkJSON(t, `{"op":">","args":[{"property":"p"},{"op":"+","args":[{"op":"*","args":[2,3]},{"property":"x"}]}]}`,
+		"p > 2 * 3 + x")
+	checkJSON(t, `{"op":">","args":[{"property":"p"},{"op":"*","args":[2,{"op":"+","args":[3,{"property":"x"}]}]}]}`,
+		"p > 2 * (3 + x)")
+	checkJSON(t, `{"op":">","args":[{"property":"p"},{"op":"/","args":[{"op":"+","args":[{"property":"y"},5]},{"op":"-","args":[3,{"property":"x"}]}]}]}`,
+		"p > (y + 5) / (3 - x)")
+	checkJSON(t, `{"op":"=","args":[{"property":"p"},{"op":"%","args":[{"property":"x"},10]}]}`, "p = x % 10")
+}
+
+func TestJSONGeometryLiteral(t *testing.T) {
+	checkJSON(t, `{"op":"s_equals","args":[{"property":"geom"},{"type":"LineString","coordinates":[[0,0],[1,1]]}]}`,
+		"equals(geom, LINESTRING(0 0, 1 1))")
+	checkJSON(t, `{"op":"s_equals","args":[{"property":"geom"},{"type":"Polygon","coordinates":[[[0,0],[0,9],[9,0],[0,0]],[[1,1],[1,8],[8,1],[1,1]]]}]}`,
+		"equals(geom, POLYGON((0 0, 0 9, 9 0, 0 0),(1 1, 1 8, 8 1, 1 1)))")
+	checkJSON(t, `{"op":"s_equals","args":[{"property":"geom"},{"type":"MultiPoint","coordinates":[[0,0],[0,9]]}]}`,
+		"equals(geom, MULTIPOINT((0 0), (0 9)))")
+	checkJSON(t, `{"op":"s_equals","args":[{"property":"geom"},{"type":"MultiLineString","coordinates":[[[0,0],[1,1]],[[1,1],[2,2]]]}]}`,
+		"equals(geom, MULTILINESTRING((0 0, 1 1),(1 1, 2 2)))")
+	checkJSON(t, `{"op":"s_equals","args":[{"property":"geom"},{"type":"MultiPolygon","coordinates":[[[[1,4],[4,1],[1,1],[1,4]]],[[[1,9],[4,9],[1,6],[1,9]]]]}]}`,
+		"equals(geom, MULTIPOLYGON(((1 4, 4 1, 1 1, 1 4)), ((1 9, 4 9, 1 6, 1 9))))")
+	checkJSON(t, `{"op":"s_equals","args":[{"property":"geom"},{"type":"GeometryCollection","geometries":[`+
+		`{"type":"Polygon","coordinates":[[[1,4],[4,1],[1,1],[1,4]]]},{"type":"LineString","coordinates":[[3,3],[5,5]]},{"type":"Point","coordinates":[1,5]}]}]}`,
+		"equals(geom, GEOMETRYCOLLECTION(POLYGON((1 4, 4 1, 1 1, 1 4)),LINESTRING (3 3, 5 5), POINT (1 5)))")
+	checkJSON(t, `{"op":"s_equals","args":[{"property":"geom"},{"bbox":[1,2,3,4]}]}`, "equals(geom, ENVELOPE(1,2,3,4))")
+	checkJSON(t, `{"op":"s_equals","args":[{"property":"geom"},{"bbox":[1,2,0,3,4,10]}]}`, "equals(geom, ENVELOPE(1,2,3,4))")
+}
+
+func TestJSONGeometryLiteralWithSRID(t *testing.T) {
+	checkJSONWithSRID(t, `{"op":"s_equals","args":[{"property":"geom"},{"type":"Point","coordinates":[45,-75]}]}`,
+		"equals(geom, POINT(45 -75))", data.Crs{Srid: 4326, IsLatLon: true}, 3857)
+	checkJSONWithSRID(t, `{"op":"s_equals","args":[{"property":"geom"},{"bbox":[1,2,3,4]}]}`,
+		"equals(geom, ENVELOPE(1,2,3,4))", data.Crs{Srid: 1111}, 2222)
+}
+
+func TestJSONBooleanExpression(t *testing.T) {
+	x1 := `{"op":"=","args":[{"property":"x"},1]}`
+	x2 := `{"op":"=","args":[{"property":"x"},2]}`
+	y4 := `{"op":"<","args":[{"property":"y"},4]}`
+	checkJSON(t, `{"op":"and","args":[{"op":">","args":[{"property":"x"},1]},{"op":"<","args":[{"property":"x"},9]}]}`,
+		"x > 1 AND x < 9")
+	checkJSON(t, `{"op":"or","args":[`+x1+`,`+x2+`]}`, "x = 1 OR x = 2")
+	checkJSON(t, `{"op":"and","args":[{"op":"or","args":[`+x1+`,`+x2+`]},`+y4+`]}`, "(x = 1 OR x = 2) AND y < 4")
+	checkJSON(t, `{"op":"or","args":[{"op":"and","args":[`+x1+`,`+y4+`,`+x2+`]},`+x1+`]}`,
+		"x = 1 AND y < 4 AND x = 2 OR x = 1")
+	checkJSON(t, `{"op":"or","args":[`+x1+`,{"op":"not","args":[{"op":"and","args":[`+x2+`,`+y4+`]}]}]}`,
+		"x = 1 OR NOT (x = 2 AND y < 4)")
+	checkJSON(t, `{"op":"not","args":[{"op":"not","args":[{"op":"isNull","args":[{"property":"x"}]}]}]}`,
+		"NOT x IS NOT NULL")
+	checkJSON(t, `{"op":"or","args":[{"op":"not","args":[true]},false]}`, "NOT TRUE OR FALSE")
+}
+
+func TestJSONTemporal(t *testing.T) {
+	checkJSON(t, `{"op":"between","args":[{"property":"p"},{"date":"1991-01-01"},{"timestamp":"2000-12-31T01:59:59"}]}`,
+		"p BETWEEN 1991-01-01 AND 2000-12-31T01:59:59")
+	checkJSON(t, `{"op":">","args":[{"date":"1991-01-01"},{"property":"p"}]}`, "1991-01-01 > p")
+	checkJSON(t, `{"op":">","args":[{"property":"p"},{"timestamp":"1991-01-01T01:23:45.678Z"}]}`,
+		"p > 1991-01-01T01:23:45.678Z")
+}
+
+func TestJSONErrors(t *testing.T) {
+	checkJSONError(t, `{"op":"=","args":[{"property":"x"},1]`)
+	checkJSONError(t, `{"op":"=","args":[{"property":"x"},1]} x`)
+	checkJSONError(t, `"x = 1"`)
+	checkJSONError(t, `{"op":"=","args":[{"property":"x"}]}`)
+	checkJSONError(t, `{"op":"==","args":[{"property":"x"},1]}`)
+	checkJSONError(t, `{"op":"and","args":[{"op":"=","args":[{"property":"x"},1]}]}`)
+	checkJSONError(t, `{"op":"like","args":[{"property":"x"},1]}`)
+	checkJSONError(t, `{"op":"like","args":[{"op":"casei","args":[{"property":"x"}]},"a"]}`)
+	checkJSONError(t, `{"op":"in","args":[{"property":"x"},[1,"a"]]}`)
+	checkJSONError(t, `{"op":"isNull","args":[1]}`)
+	checkJSONError(t, `{"op":"=","args":[{"property":"x\" OR 1=1 --"},1]}`)
+	checkJSONError(t, `{"op":"s_intersects","args":[{"property":"geom"},{"type":"Point","coordinates":[0]}]}`)
+	checkJSONError(t, `{"op":"s_intersects","args":[{"property":"geom"},{"type":"Point","coordinates":["0","0"]}]}`)
+	checkJSONError(t, `{"op":"s_intersects","args":[{"property":"geom"},{"type":"Circle","coordinates":[0,0]}]}`)
+	checkJSONError(t, `{"op":"s_intersects","args":[{"property":"geom"},{"bbox":[1,2,3]}]}`)
+	checkJSONError(t, `{"op":">","args":[{"property":"p"},{"timestamp":"2000-01-01' OR 1=1 --"}]}`)
+	checkJSONError(t, `{"op":"t_before","args":[{"property":"p"},{"date":"2000-01-01"}]}`)
+}
+
+func TestJSONQueryables(t *testing.T) {
+	queryables := []string{"geom", "Name", "pop"}
+	sql, err := TranspileJSONToSQL(`{"op":"and","args":[{"op":"=","args":[{"property":"name"},"a"]},`+
+		`{"op":"s_intersects","args":[{"property":"geom"},{"type":"Point","coordinates":[1,2]}]}]}`, data.CRS84, 4326, queryables)
+	equals(t, nil, err, "queryable properties")
+	equals(t, `"name" = 'a' AND ST_Intersects("geom",ST_GeomFromText('POINT(1 2)'))`, sql, "queryable properties")
+
+	_, err = TranspileJSONToSQL(`{"op":"isNull","args":[{"property":"secret"}]}`, data.CRS84, 4326, queryables)
+	equals(t, "CQL filter property is not queryable: secret", fmt.Sprintf("%v", err), "non-queryable property")
+}
+
+// checkJSON checks that a CQL2-JSON filter produces the same SQL as the equivalent CQL2 text
+func checkJSON(t *testing.T, jsonStr string, cqlStr string) {
+	checkJSONWithSRID(t, jsonStr, cqlStr, data.CRS84, 4326)
+}
+
+func checkJSONWithSRID(t *testing.T, jsonStr string, cqlStr string, filterCrs data.Crs, sourceSRID int) {
+	expected, err := TranspileToSQL(cqlStr, filterCrs, sourceSRID, nil)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		t.FailNow()
+	}
+	actual, err := TranspileJSONToSQL(jsonStr, filterCrs, sourceSRID, nil)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		t.FailNow()
+	}
+	equals(t, expected, actual, jsonStr)
+}
+
+func checkJSONError(t *testing.T, jsonStr string) {
+	_, err := TranspileJSONToSQL(jsonStr, data.CRS84, 4326, nil)
+	isError(t, err, jsonStr)
+}
@@ -20,6 +20,8 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/tobilg/duckdb_featureserv/internal/data"
 )
 
 func TestDebug(t *testing.T) {
@@ -122,10 +124,14 @@ func TestGeometryLiteral(t *testing.T) {
 }
 
 func TestGeometryLiteralWithSRID(t *testing.T) {
-	checkCQLWithSRID(t, "equals(geom, POINT(0 0))", 1111, 2222,
-		"ST_Equals(\"geom\",ST_Transform(ST_GeomFromText('POINT(0 0)'),2222))")
-	checkCQLWithSRID(t, "equals(geom, ENVELOPE(1,2,3,4))", 1111, 2222,
-		"ST_Equals(\"geom\",ST_Transform(ST_MakeEnvelope(1::DOUBLE,2::DOUBLE,3::DOUBLE,4::DOUBLE),2222))")
+	checkCQLWithSRID(t, "equals(geom, POINT(0 0))", data.Crs{Srid: 1111}, 2222,
+		"ST_Equals(\"geom\",ST_Transform(ST_GeomFromText('POINT(0 0)'),'EPSG:1111','EPSG:2222',true))")
+	checkCQLWithSRID(t, "equals(geom, ENVELOPE(1,2,3,4))", data.Crs{Srid: 1111}, 2222,
+		"ST_Equals(\"geom\",ST_Transform(ST_MakeEnvelope(1::DOUBLE,2::DOUBLE,3::DOUBLE,4::DOUBLE),'EPSG:1111','EPSG:2222',true))")
+	checkCQLWithSRID(t, "equals(geom, POINT(45 -75))", data.Crs{Srid: 4326, IsLatLon: true}, 4326,
+		"ST_Equals(\"geom\",ST_FlipCoordinates(ST_GeomFromText('POINT(45 -75)')))")
+	checkCQLWithSRID(t, "equals(geom, POINT(45 -75))", data.Crs{Srid: 4326, IsLatLon: true}, 3857,
+		"ST_Equals(\"geom\",ST_Transform(ST_FlipCoordinates(ST_GeomFromText('POINT(45 -75)')),'EPSG:4326','EPSG:3857',true))")
 }
 
 func TestBooleanExpression(t *testing.T) {
@@ -168,8 +174,20 @@ func TestSyntaxErrors(t *testing.T) {
 	checkCQLError(t, "p > 2000-01-01T01")
 }
 
+func TestQueryables(t *testing.T) {
+	queryables := []string{"geom", "Name", "pop"}
+	sql, err := TranspileToSQL(`name = 'a' AND "pop" > 10 AND INTERSECTS(geom, POINT(1 2))`, data.CRS84, 4326, queryables)
+	equals(t, nil, err, "queryable properties")
+	equals(t, true, strings.Contains(sql, `"name" = 'a'`), sql)
+
+	_, err = TranspileToSQL("name = 'a' AND secret IS NULL", data.CRS84, 4326, queryables)
+	equals(t, "CQL filter property is not queryable: secret", fmt.Sprintf("%v", err), "non-queryable property")
+	_, err = TranspileToSQL("id IN (1,2)", data.CRS84, 4326, []string{})
+	isError(t, err, "no queryables")
+}
+
 func checkCQL(t *testing.T, cqlStr string, sql string) {
-	actual, err := TranspileToSQL(cqlStr, 4326, 4326)
+	actual, err := TranspileToSQL(cqlStr, data.CRS84, 4326, nil)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		t.FailNow()
@@ -178,8 +196,8 @@ func checkCQL(t *testing.T, cqlStr string, sql string) {
 	equals(t, sql, actual, "")
 }
 
-func checkCQLWithSRID(t *testing.T, cqlStr string, filterSRID int, sourceSRID int, sql string) {
-	actual, err := TranspileToSQL(cqlStr, filterSRID, sourceSRID)
+func checkCQLWithSRID(t *testing.T, cqlStr string, filterCrs data.Crs, sourceSRID int, sql string) {
+	actual, err := TranspileToSQL(cqlStr, filterCrs, sourceSRID, nil)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		t.FailNow()
@@ -189,7 +207,7 @@ func checkCQLWithSRID(t *testing.T, cqlStr string, filterSRID int, sourceSRID in
 }
 
 func checkCQLError(t *testing.T, cqlStr string) {
-	_, err := TranspileToSQL(cqlStr, 4326, 4326)
+	_, err := TranspileToSQL(cqlStr, data.CRS84, 4326, nil)
 	isError(t, err, "")
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 )
 
 /*
@@ -26,6 +27,41 @@ const (
 	SRID_UNKNOWN = -1
 )
 
+// Crs is a coordinate reference system, identified by an EPSG SRID.
+// Coordinates are in x/y (longitude/latitude) order,
+// unless IsLatLon is set for the latitude/longitude axis order of EPSG geographic CRSs
+type Crs struct {
+	Srid     int
+	IsLatLon bool
+}
+
+// CRS84 is WGS 84 longitude/latitude, the default CRS of feature data
+var CRS84 = Crs{Srid: SRID_4326}
+
+// latLonSrids are EPSG geographic CRSs whose axis order is latitude/longitude
+var latLonSrids = map[int]bool{
+	4326: true, // WGS 84
+	4258: true, // ETRS89
+	4269: true, // NAD83
+	4283: true, // GDA94
+	4167: true, // NZGD2000
+	4612: true, // JGD2000
+}
+
+// IsLatLonSrid tests whether the EPSG definition of a CRS has latitude/longitude axis order
+func IsLatLonSrid(srid int) bool {
+	return latLonSrids[srid]
+}
+
+// IsGeographic tests whether a CRS has longitude/latitude coordinates, in either axis order
+func (crs Crs) IsGeographic() bool {
+	return IsLatLonSrid(crs.Srid)
+}
+
+// RowIDColumn is the DuckDB pseudo-column used as the feature ID
+// of tables which have no key column
+const RowIDColumn = "rowid"
+
 // Catalog tbd
 type Catalog interface {
 	SetIncludeExclude(includeList []string, excludeList []string)
@@ -36,12 +72,15 @@ type Catalog interface {
 	// It returns nil if the table does not exist
 	TableByName(name string) (*Table, error)
 
-	// TableReload reloads volatile table data
-	TableReload(name string)
-
-	// TableFeatures returns an array of the JSON for the features in a table
+	// TableFeatures returns an array of the JSON for the features in a table,
+	// and the cursor positioned after the last feature, if the features can be paged with cursors.
 	// It returns nil if the table does not exist
-	TableFeatures(ctx context.Context, name string, param *QueryParam) ([]string, error)
+	TableFeatures(ctx context.Context, name string, param *QueryParam) ([]string, *Cursor, error)
+
+	// TableFeatureCount returns the number of features in a table matching the query filters,
+	// ignoring the limit and offset.  The count may be estimated, as configured for the table.
+	// It returns -1 if the table does not exist or counts are disabled for it
+	TableFeatureCount(ctx context.Context, name string, param *QueryParam) (int64, error)
 
 	// TableFeature returns the JSON text for a table feature with given id
 	// It returns an empty string if the table or feature does not exist
@@ -69,56 +108,279 @@ type TransformFunction struct {
 type Sorting struct {
 	Name   string
 	IsDesc bool // false = ASC (default), true = DESC
+	// Measure is a geometry measure to sort by, such as area.
+	// If set, Name is the geometry column measured
+	Measure string
+}
+
+// Geometry measures which features can be sorted by
+const (
+	SortMeasureArea   = "area"
+	SortMeasureLength = "length"
+)
+
+// SortMeasures lists the geometry measures which features can be sorted by
+var SortMeasures = []string{SortMeasureArea, SortMeasureLength}
+
+// String provides the sort specification form of a sorting, such as -name or area(geom)
+func (sort Sorting) String() string {
+	spec := sort.Name
+	if sort.Measure != "" {
+		spec = sort.Measure + "(" + sort.Name + ")"
+	}
+	if sort.IsDesc {
+		return "-" + spec
+	}
+	return spec
+}
+
+// Aggregate is an aggregate function of a column, computed for each group of features.
+// The count of features has the column *
+type Aggregate struct {
+	Function string
+	Column   string
 }
 
+// Aggregate functions which can be computed for groups of features
+const (
+	AggregateCount = "count"
+	AggregateSum   = "sum"
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+)
+
+// AggregateAll is the column of an aggregate of all features, as in count(*)
+const AggregateAll = "*"
+
+// AggregateFunctions lists the aggregate functions which can be computed for groups of features
+var AggregateFunctions = []string{AggregateCount, AggregateSum, AggregateAvg, AggregateMin, AggregateMax}
+
+// Name is the property name of an aggregate value, such as count or sum_pop
+func (agg Aggregate) Name() string {
+	if agg.Column == AggregateAll {
+		return agg.Function
+	}
+	return agg.Function + "_" + agg.Column
+}
+
+// String provides the parameter form of an aggregate, such as sum(pop)
+func (agg Aggregate) String() string {
+	return agg.Function + "(" + agg.Column + ")"
+}
+
+// PropertyFilter is a condition on the value of a property.
+// Values holds the list of values of an IN condition,
+// or the lower and upper bounds of a range, which are blank if the range is open.
+// The values are cast to DbType, the type of the property, if it is a scalar type
 type PropertyFilter struct {
-	Name  string
-	Value string
+	Name   string
+	Op     string
+	Value  string
+	Values []string
+	DbType string
 }
 
+// Property filter operators.  A blank operator is equality
+const (
+	FilterOpEq      = "="
+	FilterOpIn      = "IN"
+	FilterOpRange   = "BETWEEN"
+	FilterOpLike    = "LIKE"
+	FilterOpIsNull  = "IS NULL"
+	FilterOpNotNull = "IS NOT NULL"
+)
+
+// FilterWildcard matches any characters in the value of a LIKE property filter
+const FilterWildcard = "*"
+
 // QueryParam holds the optional parameters for a data query
 type QueryParam struct {
-	Crs       int
+	Crs       Crs
 	Limit     int
 	Offset    int
 	Bbox      *Extent
-	BboxCrs   int
+	BboxCrs   Crs
 	FilterSql string
 	Filter    []*PropertyFilter
+	// Datetime restricts features to those whose temporal property intersects it
+	Datetime *TimeInterval
+	// GeometryColumn is the geometry column to output and filter.
+	// If empty the table primary geometry column is used
+	GeometryColumn string
 	// Columns is the list of columns to return
-	Columns       []string
-	GroupBy       []string
+	Columns []string
+	// GroupBy is the list of columns features are grouped by.
+	// If it is empty but not nil, all features form one group
+	GroupBy []string
+	// Aggregates are the aggregate values computed for each group
+	Aggregates    []Aggregate
 	SortBy        []Sorting
 	Precision     int
 	TransformFuns []TransformFunction
+	// Cursor is the position after which features are returned, for keyset paging
+	Cursor *Cursor
+}
+
+// IsGrouped tests whether a query returns a feature for each group of features
+func (param *QueryParam) IsGrouped() bool {
+	return param.GroupBy != nil
+}
+
+// PropertyNames lists the properties of the features a query returns:
+// the columns followed by the aggregate values
+func (param *QueryParam) PropertyNames() []string {
+	if len(param.Aggregates) == 0 {
+		return param.Columns
+	}
+	return append(append([]string{}, param.Columns...), aggregateNames(param.Aggregates)...)
+}
+
+// aggregateNames lists the property names of aggregate values
+func aggregateNames(aggs []Aggregate) []string {
+	names := make([]string, len(aggs))
+	for i, agg := range aggs {
+		names[i] = agg.Name()
+	}
+	return names
 }
 
 // Table holds metadata for table/view objects
 type Table struct {
 	ID             string
+	Catalog        string
 	Schema         string
 	Table          string
 	Title          string
 	Description    string
 	GeometryType   string
 	GeometryColumn string
-	IDColumn       string
-	Srid           int
-	Extent         Extent
-	Columns        []string
-	DbTypes        map[string]string
-	JSONTypes      []string
-	ColDesc        []string
+	// GeometryColumns lists all geometry columns, starting with the primary one
+	GeometryColumns []string
+	IDColumn        string
+	// Srid is the SRID of the primary geometry column
+	Srid int
+	// GeometrySrids are the SRIDs of the geometry columns
+	GeometrySrids map[string]int
+	Extent        Extent
+	Columns       []string
+	DbTypes       map[string]string
+	JSONTypes     []string
+	// JSONFormats are the JSON Schema formats of string columns, such as date-time
+	JSONFormats []string
+	ColDesc     []string
+	Keywords    []string
+	License     string
+	Attribution string
+	Links       []Link
+	// TemporalColumn is the column holding the time (or start time) of features.
+	// TemporalEndColumn is the end time column, for features with a time interval
+	TemporalColumn    string
+	TemporalEndColumn string
+	// TemporalExtent is the time interval spanned by the features, if known
+	TemporalExtent *TimeInterval
+	// Partitions are the hive partition keys and values of a partitioned Parquet dataset
+	Partitions []Partition
+	// Queryables are the columns which can be used in filters, if restricted by configuration.
+	// If nil, all columns are queryable
+	Queryables []string
+	// source is the data file scanned by a view, if any
+	source *sourceFile
+	// extentVersion is the data version the extents were computed for
+	extentVersion string
 }
 
-// Extent of a table
+// GeometrySrid is the SRID of a geometry column.
+// If the SRIDs of the columns are not known the SRID of the primary column is used
+func (tbl *Table) GeometrySrid(col string) int {
+	if srid, ok := tbl.GeometrySrids[col]; ok {
+		return srid
+	}
+	return tbl.Srid
+}
+
+// QueryableNames are the names of the columns which can be used in filters.
+// Unless restricted by configuration these are the geometry columns and the property columns
+func (tbl *Table) QueryableNames() []string {
+	if tbl.Queryables != nil {
+		return tbl.Queryables
+	}
+	return tbl.allColumns()
+}
+
+// allColumns are the geometry columns followed by the other columns of a table
+func (tbl *Table) allColumns() []string {
+	var names []string
+	isAdded := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !isAdded[name] {
+			names = append(names, name)
+			isAdded[name] = true
+		}
+	}
+	add(tbl.GeometryColumn)
+	for _, name := range tbl.GeometryColumns {
+		add(name)
+	}
+	for _, name := range tbl.Columns {
+		add(name)
+	}
+	return names
+}
+
+// TimeInterval is a time instant or interval.
+// A nil Start or End is unbounded. An instant has equal Start and End
+type TimeInterval struct {
+	Start *time.Time
+	End   *time.Time
+}
+
+// IsInstant tests whether the interval is a single instant
+func (ti *TimeInterval) IsInstant() bool {
+	return ti.Start != nil && ti.End != nil && ti.Start.Equal(*ti.End)
+}
+
+// Partition is a hive partition key and its values
+type Partition struct {
+	Name   string
+	Values []string
+}
+
+// Link is a link to a resource related to a table
+type Link struct {
+	Href  string
+	Rel   string
+	Type  string
+	Title string
+}
+
+// Extent of a table, or a bbox.
+// A bbox may also have a Z range, if HasZ is set
 type Extent struct {
 	Minx, Miny, Maxx, Maxy float64
+	HasZ                   bool
+	Minz, Maxz             float64
+}
+
+// XY provides an extent in a CRS with its coordinates in x/y (longitude/latitude) order
+func (ext Extent) XY(crs Crs) Extent {
+	if crs.IsLatLon {
+		ext.Minx, ext.Miny, ext.Maxx, ext.Maxy = ext.Miny, ext.Minx, ext.Maxy, ext.Maxx
+	}
+	return ext
+}
+
+// CrossesAntimeridian tests whether an extent in a geographic CRS crosses the antimeridian,
+// which is indicated by a minimum longitude greater than the maximum
+func (ext Extent) CrossesAntimeridian(crs Crs) bool {
+	xy := ext.XY(crs)
+	return crs.IsGeographic() && xy.Minx > xy.Maxx
 }
 
 // Function tbd
 type Function struct {
 	ID             string
+	Catalog        string
 	Schema         string
 	Name           string
 	Description    string
@@ -130,6 +392,7 @@ type Function struct {
 	OutNames       []string
 	OutDbTypes     []string
 	OutJSONTypes   []string
+	OutJSONFormats []string
 	Types          map[string]string
 	GeometryColumn string
 	IDColumn       string
@@ -137,7 +400,7 @@ type Function struct {
 
 func (fun *Function) IsGeometryFunction() bool {
 	for _, typ := range fun.OutDbTypes {
-		if typ == "geometry" {
+		if strings.EqualFold(typ, DuckDBTypeGeometry) {
 			return true
 		}
 	}
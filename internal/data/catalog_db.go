@@ -16,13 +16,20 @@ package data
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/marcboeker/go-duckdb/v2"
+	"github.com/marcboeker/go-duckdb/v2"
 	log "github.com/sirupsen/logrus"
 	"github.com/tobilg/duckdb_featureserv/internal/conf"
 )
@@ -31,50 +38,64 @@ import (
 const (
 	JSONTypeString       = "string"
 	JSONTypeNumber       = "number"
+	JSONTypeInteger      = "integer"
 	JSONTypeBoolean      = "boolean"
+	JSONTypeObject       = "object"
 	JSONTypeJSON         = "json"
 	JSONTypeBooleanArray = "boolean[]"
 	JSONTypeStringArray  = "string[]"
 	JSONTypeNumberArray  = "number[]"
 
+	JSONFormatDate     = "date"
+	JSONFormatDateTime = "date-time"
+	JSONFormatTime     = "time"
+	JSONFormatUUID     = "uuid"
+	JSONFormatDuration = "duration"
+	JSONFormatByte     = "byte"
+
 	DuckDBTypeBool     = "BOOLEAN"
 	DuckDBTypeNumeric  = "DOUBLE"
 	DuckDBTypeJSON     = "JSON"
 	DuckDBTypeGeometry = "GEOMETRY"
 	DuckDBTypeText     = "VARCHAR"
+	// DuckDBTypeAny is the type of untyped macro parameters
+	DuckDBTypeAny = "ANY"
 )
 
 type catalogDB struct {
 	dbconn        *sql.DB
 	tableIncludes map[string]string
 	tableExcludes map[string]string
-	tables        []*Table
-	tableMap      map[string]*Table
-	functions     []*Function
-	functionMap   map[string]*Function
+	// snapshot is the current catalog.  It is replaced atomically when reloaded,
+	// so requests always see a consistent catalog without locking
+	snapshot atomic.Pointer[catalogSnapshot]
+	// loadMutex serializes loading the catalog
+	loadMutex   sync.Mutex
+	refreshOnce sync.Once
+	stopRefresh chan struct{}
+	// extents caches the table extents, which are computed in the background.
+	// extentMutex serializes updating them
+	extents     *extentCache
+	extentMutex sync.Mutex
 }
 
-var isStartup bool
-var isFunctionsLoaded bool
-var instanceDB catalogDB
+var instanceDB *catalogDB
 
 const fmtQueryStats = "Database query result: %v rows in %v"
 
-func init() {
-	isStartup = true
-}
-
 // CatDBInstance tbd
 func CatDBInstance() Catalog {
 	// TODO: make a singleton
 	instanceDB = newCatalogDB()
-	return &instanceDB
+	return instanceDB
 }
 
-func newCatalogDB() catalogDB {
+func newCatalogDB() *catalogDB {
 	conn := dbConnect()
-	cat := catalogDB{
-		dbconn: conn,
+	cat := &catalogDB{
+		dbconn:      conn,
+		stopRefresh: make(chan struct{}),
+		extents:     newExtentCache(extentCachePath()),
 	}
 	return cat
 }
@@ -82,15 +103,22 @@ func newCatalogDB() catalogDB {
 func dbConnect() *sql.DB {
 	dbPath := conf.Configuration.Database.DatabasePath
 
-	// disallow blank config for safety
+	// a blank path is only allowed when serving data file sources,
+	// which are read into an in-memory database
 	if dbPath == "" {
-		log.Fatal("Blank DuckDB path is disallowed for security reasons")
+		if len(conf.Configuration.Sources) == 0 {
+			log.Fatal("Blank DuckDB path is disallowed unless data sources are configured")
+		}
+		log.Info("No DuckDB path configured, using an in-memory database")
 	}
 
-	db, err := sql.Open("duckdb", dbPath)
+	connector, err := duckdb.NewConnector(dbDSN(conf.Configuration.Database), dbConnectionInit(conf.Configuration.Database))
 	if err != nil {
 		log.Fatal(err)
 	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(conf.Configuration.Database.MaxOpenConns)
+	db.SetMaxIdleConns(conf.Configuration.Database.MaxIdleConns)
 
 	// Test the connection
 	err = db.Ping()
@@ -104,6 +132,8 @@ func dbConnect() *sql.DB {
 		log.Warnf("Failed to load spatial extension: %v", err)
 	}
 
+	registerSources(db, conf.Configuration.Sources)
+
 	// Load httpserver extension if enabled
 	if conf.Configuration.DuckDB.EnableHttpServer {
 		// Install and load the httpserver extension from community repository
@@ -145,6 +175,38 @@ func dbConnect() *sql.DB {
 	return db
 }
 
+// dbDSN provides the DuckDB data source name for the configured database.
+// Read-only access mode must be set when the database is opened,
+// and is not supported for an in-memory database
+func dbDSN(dbConf conf.Database) string {
+	if !dbConf.ReadOnly {
+		return dbConf.DatabasePath
+	}
+	if dbConf.DatabasePath == "" || dbConf.DatabasePath == ":memory:" {
+		log.Warn("Read-only access mode is not supported for an in-memory database")
+		return dbConf.DatabasePath
+	}
+	log.Info("Opening database in read-only access mode")
+	return dbConf.DatabasePath + "?access_mode=read_only"
+}
+
+// dbConnectionInit provides the hook which initializes each new pooled connection,
+// applying the configured resource settings.
+// These are settings of the DuckDB instance, shared by all connections,
+// so they are simply re-applied by each new connection.
+// The result row budget is not applied here, but as the LIMIT of each query (see ResultLimit)
+func dbConnectionInit(dbConf conf.Database) func(execer driver.ExecerContext) error {
+	stmts := sqlConnectionSettings(dbConf)
+	return func(execer driver.ExecerContext) error {
+		for _, stmt := range stmts {
+			if _, err := execer.ExecContext(context.Background(), stmt, nil); err != nil {
+				return fmt.Errorf("error applying setting %q: %v", stmt, err)
+			}
+		}
+		return nil
+	}
+}
+
 func (cat *catalogDB) SetIncludeExclude(includeList []string, excludeList []string) {
 	//-- include schemas / tables
 	cat.tableIncludes = make(map[string]string)
@@ -161,27 +223,14 @@ func (cat *catalogDB) SetIncludeExclude(includeList []string, excludeList []stri
 }
 
 func (cat *catalogDB) Close() {
+	if cat.stopRefresh != nil {
+		close(cat.stopRefresh)
+	}
 	cat.dbconn.Close()
 }
 
 func (cat *catalogDB) Tables() ([]*Table, error) {
-	cat.refreshTables(true)
-	return cat.tables, nil
-}
-
-func (cat *catalogDB) TableReload(name string) {
-	tbl, ok := cat.tableMap[name]
-	if !ok {
-		return
-	}
-	// load extent (which may change over time
-	sqlExtentEst := sqlExtentEstimated(tbl)
-	isExtentLoaded := cat.loadExtent(sqlExtentEst, tbl)
-	if !isExtentLoaded {
-		log.Debugf("Can't get estimated extent for %s", name)
-		sqlExtentExact := sqlExtentExact(tbl)
-		cat.loadExtent(sqlExtentExact, tbl)
-	}
+	return cat.current().tables, nil
 }
 
 func (cat *catalogDB) loadExtent(sql string, tbl *Table) bool {
@@ -209,41 +258,72 @@ func (cat *catalogDB) loadExtent(sql string, tbl *Table) bool {
 }
 
 func (cat *catalogDB) TableByName(name string) (*Table, error) {
-	cat.refreshTables(false)
-	tbl, ok := cat.tableMap[name]
+	tbl, ok := cat.current().tableMap[name]
 	if !ok {
 		return nil, nil
 	}
 	return tbl, nil
 }
 
-func (cat *catalogDB) TableFeatures(ctx context.Context, name string, param *QueryParam) ([]string, error) {
+func (cat *catalogDB) TableFeatures(ctx context.Context, name string, param *QueryParam) ([]string, *Cursor, error) {
 	tbl, err := cat.TableByName(name)
 	if err != nil || tbl == nil {
-		return nil, err
+		return nil, nil, err
 	}
-	cols := param.Columns
+	cols := param.PropertyNames()
 	sql, argValues := sqlFeatures(tbl, param)
 	log.Debug("Features query: " + sql)
-	idColIndex := indexOfName(cols, tbl.IDColumn)
+	idColIndex := featureIDIndex(tbl, param.Columns, param.IsGrouped())
+	keyCount := len(cursorKeyExprs(tbl, param))
+
+	ctx, cancel := withQueryTimeout(ctx, tbl.ID)
+	defer cancel()
+	features, keys, err := readFeaturesWithKeys(ctx, cat.dbconn, sql, argValues, idColIndex, cols, keyCount)
+	var next *Cursor
+	if keys != nil {
+		next = NewCursor(param.SortBy, keys)
+	}
+	return features, next, err
+}
 
-	features, err := readFeaturesWithArgs(ctx, cat.dbconn, sql, argValues, idColIndex, cols)
-	return features, err
+func (cat *catalogDB) TableFeatureCount(ctx context.Context, name string, param *QueryParam) (int64, error) {
+	tbl, err := cat.TableByName(name)
+	if err != nil || tbl == nil {
+		return -1, err
+	}
+	mode := conf.Configuration.NumberMatched(tbl.ID)
+	if mode == conf.NumberMatchedNone {
+		return -1, nil
+	}
+	sql, argValues := sqlFeaturesCount(tbl, param, mode == conf.NumberMatchedEstimated)
+	log.Debug("Features count query: " + sql)
+
+	ctx, cancel := withQueryTimeout(ctx, tbl.ID)
+	defer cancel()
+	var count int64
+	err = cat.dbconn.QueryRowContext(ctx, sql, argValues...).Scan(&count)
+	if err != nil {
+		log.Warnf("Error running Features count query: %v", err)
+		return -1, err
+	}
+	return count, nil
 }
 
 func (cat *catalogDB) TableFeature(ctx context.Context, name string, id string, param *QueryParam) (string, error) {
 	tbl, err := cat.TableByName(name)
-	if err != nil {
+	if err != nil || tbl == nil {
 		return "", err
 	}
 	cols := param.Columns
 	sql := sqlFeature(tbl, param)
 	log.Debug("Feature query: " + sql)
-	idColIndex := indexOfName(cols, tbl.IDColumn)
+	idColIndex := featureIDIndex(tbl, cols, false)
 
 	//--- Add a SQL arg for the feature ID
 	argValues := make([]interface{}, 0)
 	argValues = append(argValues, id)
+	ctx, cancel := withQueryTimeout(ctx, tbl.ID)
+	defer cancel()
 	features, err := readFeaturesWithArgs(ctx, cat.dbconn, sql, argValues, idColIndex, cols)
 
 	if len(features) == 0 {
@@ -252,17 +332,17 @@ func (cat *catalogDB) TableFeature(ctx context.Context, name string, id string,
 	return features[0], nil
 }
 
-func (cat *catalogDB) refreshTables(force bool) {
-	// TODO: refresh on timed basis?
-	if force || isStartup {
-		cat.loadTables()
-		isStartup = false
+// featureIDIndex is the index of the feature ID in the query result columns.
+// The ID column is selected after the property columns, unless grouping.
+// Groups have an ID only if the ID column is a group column
+func featureIDIndex(tbl *Table, cols []string, isGrouped bool) int {
+	if tbl.IDColumn == "" {
+		return -1
 	}
-}
-
-func (cat *catalogDB) loadTables() {
-	cat.tableMap = cat.readTables(cat.dbconn)
-	cat.tables = tablesSorted(cat.tableMap)
+	if isGrouped {
+		return indexOfName(cols, tbl.IDColumn)
+	}
+	return len(cols)
 }
 
 func tablesSorted(tableMap map[string]*Table) []*Table {
@@ -277,19 +357,28 @@ func tablesSorted(tableMap map[string]*Table) []*Table {
 	return lsort
 }
 
-func (cat *catalogDB) readTables(db *sql.DB) map[string]*Table {
+// tablesQuery discovers the tables to publish.
+// It is a variable so that tests can discover tables without the spatial extension
+var tablesQuery = sqlTables
+
+// readTables reads the tables with geometry columns.
+// It fails if any table cannot be read, which may happen if the schema changes while loading
+func (cat *catalogDB) readTables(db *sql.DB) (map[string]*Table, error) {
 	// Discover all tables with geometry columns
 	log.Info("Discovering all tables with geometry columns")
-	rows, err := db.Query(sqlTables)
+	rows, err := db.Query(tablesQuery)
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer rows.Close()
 
 	tables := make(map[string]*Table)
 	for rows.Next() {
-		tbl := scanTable(cat.dbconn, rows)
+		tbl, err := scanTable(cat.dbconn, rows)
+		if err != nil {
+			return nil, err
+		}
 		if cat.isIncluded(tbl) {
 			tables[tbl.ID] = tbl
 			log.Infof("Added table collection: %s (geometry column: %s)", tbl.ID, tbl.GeometryColumn)
@@ -297,14 +386,14 @@ func (cat *catalogDB) readTables(db *sql.DB) map[string]*Table {
 	}
 	// Check for errors from iterating over rows.
 	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	if len(tables) == 0 {
 		log.Warn("No tables with geometry columns found in database")
 	}
 
-	return tables
+	return tables, nil
 }
 
 func (cat *catalogDB) isIncluded(tbl *Table) bool {
@@ -320,34 +409,63 @@ func (cat *catalogDB) isIncluded(tbl *Table) bool {
 	return isIncluded && !isExcluded
 }
 
+// isMatchSchemaTable tests whether a table matches an entry in a name list.
+// Entries can be a schema, a catalog-qualified schema,
+// a schema-qualified table or a table ID
 func isMatchSchemaTable(tbl *Table, list map[string]string) bool {
-	schemaLow := strings.ToLower(tbl.Schema)
-	if _, ok := list[schemaLow]; ok {
-		return true
+	names := []string{
+		tbl.Schema,
+		tbl.Schema + "." + tbl.Table,
+		tbl.ID,
 	}
-	idLow := strings.ToLower(tbl.ID)
-	if _, ok := list[idLow]; ok {
-		return true
+	if tbl.Catalog != "" {
+		names = append(names, tbl.Catalog+"."+tbl.Schema)
+	}
+	for _, name := range names {
+		if _, ok := list[strings.ToLower(name)]; ok {
+			return true
+		}
 	}
 	return false
 }
 
-func scanTable(db *sql.DB, rows *sql.Rows) *Table {
+func scanTable(db *sql.DB, rows *sql.Rows) (*Table, error) {
 	var (
-		id, schema, table, description, geometryCol string
-		srid                                        int
-		geometryType, idColumn                      string
-		propsStr                                    string
+		id, catalog, schema, table, description string
+		geometryColList                         interface{}
+		srid                                    int
+		geometryType, propsStr, sourceSQL       string
+		isView                                  bool
 	)
 
-	err := rows.Scan(&id, &schema, &table, &description, &geometryCol,
-		&srid, &geometryType, &idColumn, &propsStr)
+	err := rows.Scan(&id, &catalog, &schema, &table, &description, &geometryColList,
+		&srid, &geometryType, &isView, &propsStr, &sourceSQL)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("unable to read table catalog: %v", err)
+	}
+	geometryCols := toStringArray(geometryColList)
+	if len(geometryCols) == 0 {
+		return nil, fmt.Errorf("unable to read geometry columns of table %s", id)
+	}
+	geometryCol := geometryCols[0]
+
+	src := viewSourceFile(sourceSQL)
+	srids := make(map[string]int, len(geometryCols))
+	for _, col := range geometryCols {
+		srids[col] = srid
+		if srid <= 0 {
+			srids[col] = resolveSrid(db, id, col, src)
+		}
 	}
 
 	// For DuckDB, we'll get column information through a separate query
-	columns, datatypes, jsontypes, colDesc := getTableColumns(db, table)
+	columns, datatypes, jsontypes, colDesc, err := getTableColumns(db, catalog, schema, table, geometryCol)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read columns of table %s: %v", id, err)
+	}
+	datatypes[geometryCol] = DuckDBTypeGeometry
+	idColumn := resolveIDColumn(db, id, catalog, schema, table, isView, columns)
+	temporalCol, temporalEndCol := resolveTemporalColumns(id, columns, datatypes)
 
 	// Synthesize a title for now
 	title := id
@@ -356,35 +474,108 @@ func scanTable(db *sql.DB, rows *sql.Rows) *Table {
 		description = fmt.Sprintf("Data for table %v", id)
 	}
 
-	return &Table{
-		ID:             id,
-		Schema:         schema,
-		Table:          table,
-		Title:          title,
-		Description:    description,
-		GeometryColumn: geometryCol,
-		Srid:           srid,
-		GeometryType:   geometryType,
-		IDColumn:       idColumn,
-		Columns:        columns,
-		DbTypes:        datatypes,
-		JSONTypes:      jsontypes,
-		ColDesc:        colDesc,
+	tbl := &Table{
+		ID:                id,
+		Catalog:           catalog,
+		Schema:            schema,
+		Table:             table,
+		Title:             title,
+		Description:       description,
+		GeometryColumn:    geometryCol,
+		GeometryColumns:   geometryCols,
+		Srid:              srids[geometryCol],
+		GeometrySrids:     srids,
+		GeometryType:      geometryType,
+		IDColumn:          idColumn,
+		TemporalColumn:    temporalCol,
+		TemporalEndColumn: temporalEndCol,
+		Columns:           columns,
+		DbTypes:           datatypes,
+		JSONTypes:         jsontypes,
+		JSONFormats:       toJSONFormats(columns, datatypes),
+		ColDesc:           colDesc,
+	}
+	if src != nil {
+		tbl.source = src
+		if src.HivePartitioned {
+			tbl.Partitions = loadPartitions(db, tbl)
+		}
 	}
+	applyCollectionConfig(tbl)
+	return tbl, nil
 }
 
-func getTableColumns(db *sql.DB, tableName string) ([]string, map[string]string, []string, []string) {
-	query := `SELECT column_name, data_type 
-	          FROM information_schema.columns 
-	          WHERE table_name = ? 
-	          AND column_name != 'geom'
-	          ORDER BY ordinal_position`
+// loadPartitions reads the partitions of a partitioned table.
+// Errors are logged, since partitions are informational only
+func loadPartitions(db *sql.DB, tbl *Table) []Partition {
+	partitions, err := readPartitions(db, tbl.source.Path)
+	if err != nil {
+		log.Warnf("Error reading partitions of %s: %v", tbl.ID, err)
+		return nil
+	}
+	return partitions
+}
 
-	rows, err := db.Query(query, tableName)
+// applyCollectionConfig merges the configured collection metadata into a table
+func applyCollectionConfig(tbl *Table) {
+	coll, ok := conf.Configuration.CollectionConfig(tbl.ID)
+	if !ok {
+		return
+	}
+	if coll.Title != "" {
+		tbl.Title = coll.Title
+	}
+	if coll.Description != "" {
+		tbl.Description = coll.Description
+	}
+	tbl.Keywords = coll.Keywords
+	tbl.License = coll.License
+	tbl.Attribution = coll.Attribution
+	for _, link := range coll.Links {
+		tbl.Links = append(tbl.Links, Link{
+			Href:  link.Href,
+			Rel:   link.Rel,
+			Type:  link.Type,
+			Title: link.Title,
+		})
+	}
+	// column names are matched case-insensitively, since Viper lowercases config keys
+	for i, col := range tbl.Columns {
+		if desc, ok := coll.Columns[strings.ToLower(col)]; ok {
+			tbl.ColDesc[i] = desc
+		}
+	}
+	if len(coll.Queryables) > 0 {
+		tbl.Queryables = resolveQueryables(tbl, coll.Queryables)
+	}
+}
+
+// resolveQueryables provides the table columns for the configured queryable names, in table column order.
+// Names are matched case-insensitively, and names which are not columns are ignored
+func resolveQueryables(tbl *Table, names []string) []string {
+	isConfigured := make(map[string]bool)
+	for _, name := range names {
+		isConfigured[strings.ToLower(name)] = true
+	}
+	queryables := []string{}
+	for _, col := range tbl.allColumns() {
+		if isConfigured[strings.ToLower(col)] {
+			queryables = append(queryables, col)
+			delete(isConfigured, strings.ToLower(col))
+		}
+	}
+	for name := range isConfigured {
+		log.Warnf("Queryable %s is not a column of %s", name, tbl.ID)
+	}
+	return queryables
+}
+
+// getTableColumns reads the non-geometry columns of a table, with their types and descriptions.
+// It fails if the table no longer exists
+func getTableColumns(db *sql.DB, catalog string, schema string, tableName string, geometryCol string) ([]string, map[string]string, []string, []string, error) {
+	rows, err := db.Query(sqlTableColumns, catalog, schema, tableName)
 	if err != nil {
-		log.Warnf("Error getting columns for table %s: %v", tableName, err)
-		// Return minimal fallback
-		return []string{"id"}, map[string]string{"id": "INTEGER"}, []string{"number"}, []string{"Identifier column"}
+		return nil, nil, nil, nil, err
 	}
 	defer rows.Close()
 
@@ -393,18 +584,32 @@ func getTableColumns(db *sql.DB, tableName string) ([]string, map[string]string,
 	var jsontypes []string
 	var colDesc []string
 
+	isFound := false
 	for rows.Next() {
-		var columnName, dataType string
-		err := rows.Scan(&columnName, &dataType)
+		var columnName, dataType, comment string
+		err := rows.Scan(&columnName, &dataType, &comment)
 		if err != nil {
-			log.Warnf("Error scanning column info: %v", err)
+			return nil, nil, nil, nil, err
+		}
+		isFound = true
+		if columnName == geometryCol {
 			continue
 		}
 
 		columns = append(columns, columnName)
 		datatypes[columnName] = dataType
 		jsontypes = append(jsontypes, toJSONTypeFromDuckDB(dataType))
-		colDesc = append(colDesc, fmt.Sprintf("Column %s of type %s", columnName, dataType))
+		// use the column comment as the description, if provided
+		if comment == "" {
+			comment = fmt.Sprintf("Column %s of type %s", columnName, dataType)
+		}
+		colDesc = append(colDesc, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if !isFound {
+		return nil, nil, nil, nil, fmt.Errorf("table not found")
 	}
 
 	// Ensure we have at least one column
@@ -416,7 +621,45 @@ func getTableColumns(db *sql.DB, tableName string) ([]string, map[string]string,
 	}
 
 	log.Debugf("Table %s columns: %v", tableName, columns)
-	return columns, datatypes, jsontypes, colDesc
+	return columns, datatypes, jsontypes, colDesc, nil
+}
+
+// resolveIDColumn determines the column used as the feature ID.
+// It is resolved in order from:
+// a single-column primary key, a single-column unique constraint,
+// the collection or data source configuration, and finally the rowid of base tables.
+// Views have no constraints or rowid, so may have no ID column
+func resolveIDColumn(db *sql.DB, id string, catalog string, schema string, tableName string, isView bool, columns []string) string {
+	var keyCol string
+	err := db.QueryRow(sqlTableKeys, catalog, schema, tableName).Scan(&keyCol)
+	if err == nil {
+		return keyCol
+	}
+	if err != sql.ErrNoRows {
+		log.Warnf("Error getting key constraints for table %s: %v", id, err)
+	}
+	if idCol := configuredIDColumn(id); idCol != "" {
+		if indexOfName(columns, idCol) >= 0 {
+			return idCol
+		}
+		log.Warnf("Configured ID column %s not found in table %s", idCol, id)
+	}
+	if !isView {
+		return RowIDColumn
+	}
+	log.Debugf("No ID column for view %s", id)
+	return ""
+}
+
+// configuredIDColumn provides the ID column configured for a collection or a data source
+func configuredIDColumn(id string) string {
+	if coll, ok := conf.Configuration.CollectionConfig(id); ok && coll.IdColumn != "" {
+		return coll.IdColumn
+	}
+	if src, ok := sourceConfig(id); ok {
+		return src.IdColumn
+	}
+	return ""
 }
 
 //=================================================
@@ -426,55 +669,86 @@ func readFeatures(ctx context.Context, db *sql.DB, sql string, idColIndex int, p
 	return readFeaturesWithArgs(ctx, db, sql, nil, idColIndex, propCols)
 }
 
+// withQueryTimeout bounds a query by the timeout configured for a collection, or globally.
+// When the context ends the driver interrupts the running DuckDB query,
+// and the query returns the context error
+func withQueryTimeout(ctx context.Context, id string) (context.Context, context.CancelFunc) {
+	timeoutSec := conf.Configuration.Database.QueryTimeoutSec
+	if coll, ok := conf.Configuration.CollectionConfig(id); ok && coll.QueryTimeoutSec > 0 {
+		timeoutSec = coll.QueryTimeoutSec
+	}
+	if timeoutSec <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(timeoutSec)*time.Second)
+}
+
 //nolint:unused
 func readFeaturesWithArgs(ctx context.Context, db *sql.DB, sql string, args []interface{}, idColIndex int, propCols []string) ([]string, error) {
+	data, _, err := readFeaturesWithKeys(ctx, db, sql, args, idColIndex, propCols, 0)
+	return data, err
+}
+
+// readFeaturesWithKeys reads features from a query whose last keyCount columns are cursor keys.
+// It returns the keys of the last feature, if any
+func readFeaturesWithKeys(ctx context.Context, db *sql.DB, sql string, args []interface{}, idColIndex int, propCols []string, keyCount int) ([]string, []interface{}, error) {
 	start := time.Now()
 	rows, err := db.QueryContext(ctx, sql, args...)
 	if err != nil {
 		log.Warnf("Error running Features query: %v", err)
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	data, err := scanFeatures(ctx, rows, idColIndex, propCols)
+	data, keys, err := scanFeatures(ctx, rows, idColIndex, propCols, keyCount)
 	if err != nil {
-		return data, err
+		return data, nil, err
 	}
 	log.Debugf(fmtQueryStats, len(data), time.Since(start))
-	return data, nil
+	return data, keys, nil
 }
 
-func scanFeatures(ctx context.Context, rows *sql.Rows, idColIndex int, propCols []string) ([]string, error) {
+func scanFeatures(ctx context.Context, rows *sql.Rows, idColIndex int, propCols []string, keyCount int) ([]string, []interface{}, error) {
 	// init features array to empty (not nil)
 	var features []string = []string{}
+	var keys []interface{}
 	for rows.Next() {
-		feature := scanFeature(rows, idColIndex, propCols)
+		// stop reading rows as soon as the request is cancelled
+		if err := ctx.Err(); err != nil {
+			return features, nil, err
+		}
+		feature, values := scanFeature(rows, idColIndex, propCols)
 		//log.Println(feature)
 		features = append(features, feature)
+		if keyCount > 0 && len(values) >= keyCount {
+			keys = values[len(values)-keyCount:]
+		}
 	}
-	// context check done outside rows loop,
+	// context check also done outside rows loop,
 	// because a long-running function might not produce any rows before timeout
 	if err := ctx.Err(); err != nil {
 		//log.Debugf("Context error scanning Features: %v", err)
-		return features, err
+		return features, nil, err
 	}
 	// Check for errors from scanning rows.
 	if err := rows.Err(); err != nil {
 		log.Warnf("Error scanning rows for Features: %v", err)
 		// TODO: return nil here ?
-		return features, err
+		return features, nil, err
 	}
-	return features, nil
+	return features, keys, nil
 }
 
-func scanFeature(rows *sql.Rows, idColIndex int, propNames []string) string {
+// scanFeature reads the JSON for a feature from a row.
+// It also returns the row values
+func scanFeature(rows *sql.Rows, idColIndex int, propNames []string) (string, []interface{}) {
 	var id, geom string
 
 	// Get column names to dynamically scan
 	columns, err := rows.Columns()
 	if err != nil {
 		log.Warnf("Error getting columns: %v", err)
-		return ""
+		return "", nil
 	}
 
 	// Create a slice to hold values
@@ -487,7 +761,7 @@ func scanFeature(rows *sql.Rows, idColIndex int, propNames []string) string {
 	err = rows.Scan(valuePtrs...)
 	if err != nil {
 		log.Warnf("Error scanning row for Feature: %v", err)
-		return ""
+		return "", nil
 	}
 
 	//--- geom value is expected to be a GeoJSON string
@@ -522,7 +796,7 @@ func scanFeature(rows *sql.Rows, idColIndex int, propNames []string) string {
 
 	//fmt.Println(geom)
 	props := extractProperties(values, propOffset, propNames)
-	return makeFeatureJSON(id, geom, props)
+	return makeFeatureJSON(id, geom, props), values
 }
 
 func extractProperties(vals []interface{}, propOffset int, propNames []string) map[string]interface{} {
@@ -535,19 +809,56 @@ func extractProperties(vals []interface{}, propOffset int, propNames []string) m
 	return props
 }
 
-// toJSONValue converts DuckDB types to JSON values
+// toJSONValue converts DuckDB values to JSON values.
+// Nested values (LIST, ARRAY, STRUCT and MAP) are converted recursively
 func toJSONValue(value interface{}) interface{} {
 	// Handle NULL values
 	if value == nil {
 		return nil
 	}
 
-	// For DuckDB, most values can be used directly as JSON
-	// since they're already in Go native types
 	switch v := value.(type) {
 	case []byte:
-		// Convert byte arrays to strings
-		return string(v)
+		// binary data is encoded as base64
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		// timestamps are ISO 8601 in UTC
+		return v.UTC().Format(time.RFC3339Nano)
+	case duckdb.Decimal:
+		// decimals are output exactly
+		return json.Number(v.String())
+	case duckdb.Interval:
+		return isoDuration(v)
+	case float64:
+		// JSON has no representation of NaN or infinity
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+		return v
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil
+		}
+		return v
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, elem := range v {
+			list[i] = toJSONValue(elem)
+		}
+		return list
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			obj[key] = toJSONValue(elem)
+		}
+		return obj
+	case duckdb.Map:
+		// JSON object keys must be strings
+		obj := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			obj[fmt.Sprintf("%v", toJSONValue(key))] = toJSONValue(elem)
+		}
+		return obj
 	case sql.NullString:
 		if v.Valid {
 			return v.String
@@ -569,11 +880,39 @@ func toJSONValue(value interface{}) interface{} {
 		}
 		return nil
 	default:
-		// For most Go native types, return as-is
+		// For most Go native types (including *big.Int for HUGEINT), return as-is
 		return value
 	}
 }
 
+// isoDuration formats an interval as an ISO 8601 duration, such as P1M2DT3.5S
+func isoDuration(iv duckdb.Interval) string {
+	dur := "P"
+	if iv.Months != 0 {
+		dur += fmt.Sprintf("%dM", iv.Months)
+	}
+	if iv.Days != 0 {
+		dur += fmt.Sprintf("%dD", iv.Days)
+	}
+	if iv.Micros != 0 || dur == "P" {
+		dur += "T" + strconv.FormatFloat(float64(iv.Micros)/1e6, 'f', -1, 64) + "S"
+	}
+	return dur
+}
+
+// toStringArray converts a DuckDB list value to a string array
+func toStringArray(value interface{}) []string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	strs := make([]string, 0, len(list))
+	for _, v := range list {
+		strs = append(strs, fmt.Sprintf("%v", v))
+	}
+	return strs
+}
+
 func toJSONTypeFromDuckDBArray(duckdbTypes []string) []string {
 	jsonTypes := make([]string, len(duckdbTypes))
 	for i, duckdbType := range duckdbTypes {
@@ -582,36 +921,171 @@ func toJSONTypeFromDuckDBArray(duckdbTypes []string) []string {
 	return jsonTypes
 }
 
+// toJSONTypeFromDuckDB provides the JSON type of the values of a DuckDB type.
+// LIST and ARRAY types are the element type followed by [], such as integer[]
 func toJSONTypeFromDuckDB(duckdbType string) string {
-	//fmt.Printf("toJSONTypeFromDuckDB: %v\n", duckdbType)
-	switch strings.ToUpper(duckdbType) {
-	case "INTEGER", "BIGINT", "SMALLINT", "TINYINT":
-		return JSONTypeNumber
-	case "DOUBLE", "REAL", "DECIMAL", "NUMERIC":
+	if elemType, ok := duckDBElementType(duckdbType); ok {
+		return toJSONTypeFromDuckDB(elemType) + "[]"
+	}
+	switch duckDBBaseType(duckdbType) {
+	case "TINYINT", "SMALLINT", "INTEGER", "BIGINT", "HUGEINT",
+		"UTINYINT", "USMALLINT", "UINTEGER", "UBIGINT", "UHUGEINT", "INT":
+		return JSONTypeInteger
+	case "FLOAT", "REAL", "DOUBLE", "DECIMAL", "NUMERIC":
 		return JSONTypeNumber
-	case "BOOLEAN":
+	case "BOOLEAN", "BOOL":
 		return JSONTypeBoolean
-	case "JSON":
+	case "JSON", "UNION":
+		// values may be of any JSON type
 		return JSONTypeJSON
-	case "VARCHAR", "TEXT", "CHAR":
-		return JSONTypeString
-	case "GEOMETRY":
-		return JSONTypeString // GeoJSON is represented as string
+	case "STRUCT", "MAP", DuckDBTypeGeometry:
+		// geometry is represented as a nested GeoJSON object
+		return JSONTypeObject
 	default:
-		// For arrays and other complex types, default to string
-		if strings.Contains(duckdbType, "[]") {
-			if strings.Contains(duckdbType, "INTEGER") || strings.Contains(duckdbType, "DOUBLE") {
-				return JSONTypeNumberArray
-			}
-			if strings.Contains(duckdbType, "BOOLEAN") {
-				return JSONTypeBooleanArray
-			}
-			return JSONTypeStringArray
-		}
 		return JSONTypeString
 	}
 }
 
+// IsNumericType tests whether values of a DuckDB type are numbers
+func IsNumericType(duckdbType string) bool {
+	jsonType := toJSONTypeFromDuckDB(duckdbType)
+	return jsonType == JSONTypeInteger || jsonType == JSONTypeNumber
+}
+
+// IsIntegerType tests whether values of a DuckDB type are integers
+func IsIntegerType(duckdbType string) bool {
+	return toJSONTypeFromDuckDB(duckdbType) == JSONTypeInteger
+}
+
+// IsBooleanType tests whether values of a DuckDB type are booleans
+func IsBooleanType(duckdbType string) bool {
+	return toJSONTypeFromDuckDB(duckdbType) == JSONTypeBoolean
+}
+
+// integerTypeBits are the sizes of the DuckDB integer types, negative for unsigned types
+var integerTypeBits = map[string]int{
+	"TINYINT":   8,
+	"SMALLINT":  16,
+	"INTEGER":   32,
+	"INT":       32,
+	"BIGINT":    64,
+	"HUGEINT":   128,
+	"UTINYINT":  -8,
+	"USMALLINT": -16,
+	"UINTEGER":  -32,
+	"UBIGINT":   -64,
+	"UHUGEINT":  -128,
+}
+
+// IsIntegerValue tests whether a value is an integer in the range of a DuckDB integer type
+func IsIntegerValue(val string, duckdbType string) bool {
+	bits, ok := integerTypeBits[duckDBBaseType(duckdbType)]
+	num, isInt := new(big.Int).SetString(val, 10)
+	if !ok || !isInt {
+		return false
+	}
+	//-- the range is [0, 2^bits - 1] for unsigned types, and [-2^(bits-1), 2^(bits-1) - 1] for signed types
+	low := big.NewInt(0)
+	if bits < 0 {
+		bits = -bits
+	} else {
+		bits--
+		low.Neg(new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	}
+	high := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	high.Sub(high, big.NewInt(1))
+	return num.Cmp(low) >= 0 && num.Cmp(high) <= 0
+}
+
+// toJSONFormatFromDuckDB provides the JSON Schema format of the string values
+// of a DuckDB type, or blank if there is none
+func toJSONFormatFromDuckDB(duckdbType string) string {
+	if elemType, ok := duckDBElementType(duckdbType); ok {
+		return toJSONFormatFromDuckDB(elemType)
+	}
+	switch typ := duckDBBaseType(duckdbType); {
+	case typ == "DATE":
+		return JSONFormatDate
+	case strings.HasPrefix(typ, "TIMESTAMP"):
+		return JSONFormatDateTime
+	case strings.HasPrefix(typ, "TIME"):
+		return JSONFormatTime
+	case typ == "UUID":
+		return JSONFormatUUID
+	case typ == "INTERVAL":
+		return JSONFormatDuration
+	case isBlobType(typ):
+		return JSONFormatByte
+	}
+	return ""
+}
+
+func toJSONFormatFromDuckDBArray(duckdbTypes []string) []string {
+	formats := make([]string, len(duckdbTypes))
+	for i, duckdbType := range duckdbTypes {
+		formats[i] = toJSONFormatFromDuckDB(duckdbType)
+	}
+	return formats
+}
+
+// toJSONFormats provides the JSON formats of columns
+func toJSONFormats(columns []string, dbTypes map[string]string) []string {
+	formats := make([]string, len(columns))
+	for i, col := range columns {
+		formats[i] = toJSONFormatFromDuckDB(dbTypes[col])
+	}
+	return formats
+}
+
+// duckDBBaseType provides the upper-cased name of a DuckDB type without its parameters,
+// such as DECIMAL for DECIMAL(10,2)
+func duckDBBaseType(duckdbType string) string {
+	typ := strings.ToUpper(strings.TrimSpace(duckdbType))
+	if i := strings.IndexByte(typ, '('); i >= 0 {
+		typ = strings.TrimSpace(typ[:i])
+	}
+	return typ
+}
+
+// duckDBElementType provides the element type of a LIST or ARRAY type,
+// such as INTEGER for INTEGER[] or INTEGER[3]
+func duckDBElementType(duckdbType string) (string, bool) {
+	typ := strings.TrimSpace(duckdbType)
+	if !strings.HasSuffix(typ, "]") {
+		return "", false
+	}
+	i := strings.LastIndexByte(typ, '[')
+	if i <= 0 {
+		return "", false
+	}
+	return typ[:i], true
+}
+
+// isBlobType tests whether a DuckDB base type is binary data
+func isBlobType(baseType string) bool {
+	return baseType == "BLOB" || baseType == "BYTEA" || baseType == "VARBINARY" || baseType == "BINARY"
+}
+
+// isNativeJSONType tests whether values of a DuckDB type are read by the driver
+// as Go values which toJSONValue converts to JSON.
+// Other types are cast to text in queries
+func isNativeJSONType(duckdbType string) bool {
+	if _, ok := duckDBElementType(duckdbType); ok {
+		return true
+	}
+	typ := duckDBBaseType(duckdbType)
+	switch toJSONTypeFromDuckDB(duckdbType) {
+	case JSONTypeInteger, JSONTypeNumber, JSONTypeBoolean, JSONTypeJSON, JSONTypeObject:
+		return typ != DuckDBTypeGeometry
+	}
+	switch typ {
+	case "VARCHAR", "CHAR", "BPCHAR", "TEXT", "STRING", "INTERVAL",
+		"TIMESTAMP", "TIMESTAMP_S", "TIMESTAMP_MS", "TIMESTAMP_NS", "TIMESTAMPTZ", "TIMESTAMP WITH TIME ZONE":
+		return true
+	}
+	return false
+}
+
 type featureData struct {
 	Type  string                 `json:"type"`
 	ID    string                 `json:"id,omitempty"`
@@ -0,0 +1,121 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Cursor is a position in the ordered features of a table, used for keyset paging.
+// It holds the sort key values and ID of the last feature of a page, as text.
+// Since the key values only have meaning for one ordering,
+// the cursor records the sort specification it was created for
+type Cursor struct {
+	SortBy string    `json:"s,omitempty"`
+	Keys   []*string `json:"k"`
+}
+
+// NewCursor creates a cursor for the sort key and ID values of a feature
+func NewCursor(sortBy []Sorting, keys []interface{}) *Cursor {
+	cursor := Cursor{SortBy: sortSpec(sortBy), Keys: make([]*string, len(keys))}
+	for i, key := range keys {
+		if key != nil {
+			keyStr := fmt.Sprintf("%v", key)
+			cursor.Keys[i] = &keyStr
+		}
+	}
+	return &cursor
+}
+
+// ParseCursor decodes a cursor token
+func ParseCursor(token string) (*Cursor, error) {
+	doc, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(doc, &cursor); err != nil {
+		return nil, err
+	}
+	if len(cursor.Keys) == 0 || cursor.Keys[len(cursor.Keys)-1] == nil {
+		return nil, fmt.Errorf("cursor has no feature ID")
+	}
+	return &cursor, nil
+}
+
+// Encode provides the cursor as an opaque URL-safe token
+func (cursor *Cursor) Encode() string {
+	doc, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(doc)
+}
+
+// Matches tests whether the cursor is a position in the given ordering
+func (cursor *Cursor) Matches(sortBy []Sorting) bool {
+	return cursor.SortBy == sortSpec(sortBy) && len(cursor.Keys) == len(sortBy)+1
+}
+
+// sortSpec is a text form of a sort specification, such as name,-date
+func sortSpec(sortBy []Sorting) string {
+	specs := make([]string, len(sortBy))
+	for i, sort := range sortBy {
+		specs[i] = sort.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+// IsKeysetPaging tests whether a query of a table can be paged with cursors.
+// This requires an ID column to order features uniquely, and no grouping
+func IsKeysetPaging(tbl *Table, param *QueryParam) bool {
+	return tbl.IDColumn != "" && !param.IsGrouped()
+}
+
+// cursorKeyExprs are the SQL expressions for the key of a cursor: the sort expressions followed by the ID column.
+// There are none if the query is not paged with cursors
+func cursorKeyExprs(tbl *Table, param *QueryParam) []string {
+	if !IsKeysetPaging(tbl, param) {
+		return nil
+	}
+	exprs := make([]string, 0, len(param.SortBy)+1)
+	for _, sort := range param.SortBy {
+		exprs = append(exprs, sqlSortExpr(sort))
+	}
+	return append(exprs, quoteIdent(tbl.IDColumn))
+}
+
+// cursorKeyTypes are the types cursor key values are cast to, for comparison with the key expressions
+func cursorKeyTypes(tbl *Table, param *QueryParam) []string {
+	types := make([]string, 0, len(param.SortBy)+1)
+	for _, sort := range param.SortBy {
+		if sort.Measure != "" {
+			types = append(types, "DOUBLE")
+		} else {
+			types = append(types, cursorKeyType(tbl, sort.Name))
+		}
+	}
+	return append(types, cursorKeyType(tbl, tbl.IDColumn))
+}
+
+// cursorKeyType is the type a cursor key value is cast to for comparison with a column
+func cursorKeyType(tbl *Table, col string) string {
+	if dbType := tbl.DbTypes[col]; dbType != "" {
+		return dbType
+	}
+	if col == RowIDColumn {
+		return "BIGINT"
+	}
+	return "VARCHAR"
+}
@@ -0,0 +1,318 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+// extentCacheSuffix is appended to the database path to name the default extent cache file
+const extentCacheSuffix = ".extents.json"
+
+// extentCacheEntry holds the extents of a table, computed for a version of its data
+type extentCacheEntry struct {
+	// Version identifies the table data the extents were computed from
+	Version string `json:"version"`
+	// the columns the extents were computed from
+	GeometryColumn    string `json:"geometryColumn"`
+	TemporalColumn    string `json:"temporalColumn,omitempty"`
+	TemporalEndColumn string `json:"temporalEndColumn,omitempty"`
+
+	Extent         *Extent       `json:"extent,omitempty"`
+	TemporalExtent *TimeInterval `json:"temporalExtent,omitempty"`
+	Partitions     []Partition   `json:"partitions,omitempty"`
+	Updated        time.Time     `json:"updated"`
+}
+
+// matches tests whether the entry was computed from the current columns of a table
+func (entry *extentCacheEntry) matches(tbl *Table) bool {
+	return entry.GeometryColumn == tbl.GeometryColumn &&
+		entry.TemporalColumn == tbl.TemporalColumn &&
+		entry.TemporalEndColumn == tbl.TemporalEndColumn
+}
+
+// apply sets the extents of a table from the entry
+func (entry *extentCacheEntry) apply(tbl *Table) {
+	if entry.Extent != nil {
+		tbl.Extent = *entry.Extent
+	}
+	tbl.TemporalExtent = entry.TemporalExtent
+	if tbl.source != nil && tbl.source.HivePartitioned && entry.Partitions != nil {
+		tbl.Partitions = entry.Partitions
+	}
+	tbl.extentVersion = entry.Version
+}
+
+// extentCache holds the computed table extents, keyed by table ID.
+// It is persisted to a file (if any) so extents are available on restart
+type extentCache struct {
+	path    string
+	mutex   sync.Mutex
+	entries map[string]*extentCacheEntry
+}
+
+// newExtentCache creates an extent cache, reading the entries persisted in the cache file
+func newExtentCache(path string) *extentCache {
+	cache := &extentCache{
+		path:    path,
+		entries: make(map[string]*extentCacheEntry),
+	}
+	if path == "" {
+		return cache
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache
+	}
+	if err == nil {
+		err = json.Unmarshal(content, &cache.entries)
+	}
+	if err != nil {
+		log.Warnf("Error reading extent cache %s: %v", path, err)
+		cache.entries = make(map[string]*extentCacheEntry)
+		return cache
+	}
+	log.Infof("Read extents of %v collections from %s", len(cache.entries), path)
+	return cache
+}
+
+// extentCachePath is the configured extent cache file.
+// The default is a file next to the database file.
+// An in-memory database has no default, so extents are not persisted
+func extentCachePath() string {
+	if path := conf.Configuration.Database.ExtentCacheFile; path != "" {
+		return path
+	}
+	if dbPath := conf.Configuration.Database.DatabasePath; dbPath != "" && dbPath != ":memory:" {
+		return dbPath + extentCacheSuffix
+	}
+	return ""
+}
+
+func (cache *extentCache) get(id string) *extentCacheEntry {
+	if cache == nil {
+		return nil
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.entries[id]
+}
+
+func (cache *extentCache) put(id string, entry *extentCacheEntry) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.entries[id] = entry
+}
+
+// applyTo sets the cached extents of tables which have not changed columns.
+// The cached extents may be stale, until they are checked by the next extent update
+func (cache *extentCache) applyTo(tableMap map[string]*Table) {
+	for id, tbl := range tableMap {
+		if entry := cache.get(id); entry != nil && entry.matches(tbl) {
+			entry.apply(tbl)
+		}
+	}
+}
+
+// save writes the cache to the cache file, if any.
+// The file is replaced atomically so readers never see a partial file
+func (cache *extentCache) save() error {
+	if cache == nil || cache.path == "" {
+		return nil
+	}
+	cache.mutex.Lock()
+	content, err := json.MarshalIndent(cache.entries, "", "  ")
+	cache.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cache.path), filepath.Base(cache.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cache.path)
+}
+
+// updateExtents brings the extents of the current catalog tables up to date.
+// The data version of each table is checked, and extents are only recomputed
+// for tables whose data has changed since they were cached.
+// Only one update runs at a time; a concurrent call returns immediately
+func (cat *catalogDB) updateExtents() {
+	if !cat.extentMutex.TryLock() {
+		return
+	}
+	defer cat.extentMutex.Unlock()
+
+	snap := cat.snapshot.Load()
+	if snap == nil {
+		return
+	}
+	start := time.Now()
+	updates := make(map[string]*extentCacheEntry)
+	numComputed := 0
+	for _, tbl := range snap.tables {
+		version, err := cat.readDataVersion(tbl)
+		if err != nil {
+			log.Debugf("Error reading data version of %s: %v", tbl.ID, err)
+			continue
+		}
+		entry := cat.extents.get(tbl.ID)
+		if entry == nil || entry.Version != version || !entry.matches(tbl) {
+			log.Debugf("Computing extents of %s", tbl.ID)
+			entry = cat.computeExtents(tbl, version)
+			cat.extents.put(tbl.ID, entry)
+			numComputed++
+		}
+		if tbl.extentVersion != entry.Version {
+			updates[tbl.ID] = entry
+		}
+	}
+	cat.applyExtents(updates)
+	if numComputed == 0 {
+		return
+	}
+	log.Infof("Computed extents of %v collections in %v", numComputed, time.Since(start))
+	if err := cat.extents.save(); err != nil {
+		log.Warnf("Error writing extent cache: %v", err)
+	}
+}
+
+// computeExtents computes the spatial and temporal extents of a table.
+// The estimated spatial extent is used if available
+func (cat *catalogDB) computeExtents(tbl *Table, version string) *extentCacheEntry {
+	entry := &extentCacheEntry{
+		Version:           version,
+		GeometryColumn:    tbl.GeometryColumn,
+		TemporalColumn:    tbl.TemporalColumn,
+		TemporalEndColumn: tbl.TemporalEndColumn,
+		Updated:           time.Now().UTC(),
+	}
+	computed := *tbl
+	isExtentLoaded := cat.loadExtent(sqlExtentEstimated(&computed), &computed)
+	if !isExtentLoaded {
+		log.Debugf("Can't get estimated extent for %s", tbl.ID)
+		isExtentLoaded = cat.loadExtent(sqlExtentExact(&computed), &computed)
+	}
+	if isExtentLoaded {
+		entry.Extent = &computed.Extent
+	}
+	if tbl.TemporalColumn != "" {
+		entry.TemporalExtent = loadTemporalExtent(cat.dbconn, tbl)
+	}
+	if tbl.source != nil && tbl.source.HivePartitioned {
+		entry.Partitions = loadPartitions(cat.dbconn, tbl)
+	}
+	return entry
+}
+
+// applyExtents sets table extents in the current catalog, by swapping in a new snapshot.
+// Tables whose columns have changed in the meantime are not updated
+func (cat *catalogDB) applyExtents(updates map[string]*extentCacheEntry) {
+	if len(updates) == 0 {
+		return
+	}
+	cat.loadMutex.Lock()
+	defer cat.loadMutex.Unlock()
+
+	cur := cat.snapshot.Load()
+	if cur == nil {
+		return
+	}
+	tableMap := make(map[string]*Table, len(cur.tableMap))
+	for id, tbl := range cur.tableMap {
+		tableMap[id] = tbl
+		if entry, ok := updates[id]; ok && entry.matches(tbl) {
+			// copy the table, since the catalog tables may be in use by other requests
+			updated := *tbl
+			entry.apply(&updated)
+			tableMap[id] = &updated
+		}
+	}
+	next := *cur
+	next.tableMap = tableMap
+	next.tables = tablesSorted(tableMap)
+	cat.snapshot.Store(&next)
+}
+
+// readDataVersion provides a value which changes when the data of a table changes.
+// For local data files this is based on the file sizes and modification times,
+// otherwise it is the number of rows
+func (cat *catalogDB) readDataVersion(tbl *Table) (string, error) {
+	if tbl.source != nil && !isRemotePath(tbl.source.Path) {
+		return readFilesVersion(cat.dbconn, tbl.source.Path)
+	}
+	var count int64
+	err := cat.dbconn.QueryRow(sqlRowCount(tbl)).Scan(&count)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rows:%d", count), nil
+}
+
+// readFilesVersion summarizes the files matching a path or glob
+func readFilesVersion(db *sql.DB, path string) (string, error) {
+	rows, err := db.Query(sqlGlobFiles, path)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var numFiles, size int64
+	var modified time.Time
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			return "", err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		numFiles++
+		size += info.Size()
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("files:%d:%d:%d", numFiles, size, modified.UnixNano()), nil
+}
+
+// isRemotePath tests whether a path is a URL, such as s3:// or https://
+func isRemotePath(path string) bool {
+	return strings.Contains(path, "://")
+}
@@ -0,0 +1,147 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtentCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.duckdb"+extentCacheSuffix)
+	cache := newExtentCache(path)
+	testEquals(t, (*extentCacheEntry)(nil), cache.get("a"), "empty cache")
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.put("a", &extentCacheEntry{
+		Version:        "rows:3",
+		GeometryColumn: "geom",
+		TemporalColumn: "t",
+		Extent:         &Extent{Minx: 1, Miny: 2, Maxx: 3, Maxy: 4},
+		TemporalExtent: &TimeInterval{Start: &start},
+	})
+	if err := cache.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// extents are available from the file on restart
+	reread := newExtentCache(path)
+	entry := reread.get("a")
+	testEquals(t, "rows:3", entry.Version, "version")
+	testEquals(t, Extent{Minx: 1, Miny: 2, Maxx: 3, Maxy: 4}, *entry.Extent, "extent")
+	testEquals(t, true, start.Equal(*entry.TemporalExtent.Start), "temporal extent")
+
+	// cached extents are only applied to tables with the same columns
+	tableMap := map[string]*Table{
+		"a": {ID: "a", GeometryColumn: "geom", TemporalColumn: "t"},
+	}
+	reread.applyTo(tableMap)
+	testEquals(t, 3.0, tableMap["a"].Extent.Maxx, "cached extent applied")
+	testEquals(t, "rows:3", tableMap["a"].extentVersion, "cached version applied")
+	tableMap = map[string]*Table{
+		"a": {ID: "a", GeometryColumn: "shape", TemporalColumn: "t"},
+	}
+	reread.applyTo(tableMap)
+	testEquals(t, Extent{}, tableMap["a"].Extent, "changed columns")
+
+	// an unreadable file is ignored
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testEquals(t, (*extentCacheEntry)(nil), newExtentCache(path).get("a"), "invalid cache file")
+}
+
+func TestReadDataVersion(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cat := &catalogDB{dbconn: db}
+
+	if _, err := db.Exec("CREATE TABLE parcels (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	tbl := &Table{ID: "memory.main.parcels", Table: "parcels"}
+	version, err := cat.readDataVersion(tbl)
+	testEquals(t, nil, err, "error")
+	testEquals(t, "rows:0", version, "empty table")
+	if _, err := db.Exec("INSERT INTO parcels VALUES (1), (2)"); err != nil {
+		t.Fatal(err)
+	}
+	version, _ = cat.readDataVersion(tbl)
+	testEquals(t, "rows:2", version, "rows inserted")
+
+	// data file versions change when files are modified
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.fgb")
+	if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tbl = &Table{ID: "sources.main.a", source: &sourceFile{Kind: sourceKindGDAL, Path: filepath.Join(dir, "*.fgb")}}
+	written, err := cat.readDataVersion(tbl)
+	testEquals(t, nil, err, "error")
+	modified := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	touched, _ := cat.readDataVersion(tbl)
+	testEquals(t, false, written == touched, "modified file")
+	if err := os.WriteFile(filepath.Join(dir, "b.fgb"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	added, _ := cat.readDataVersion(tbl)
+	testEquals(t, false, added == touched, "added file")
+}
+
+func TestUpdateExtents(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE obs (id INTEGER, geom BLOB, t DATE)",
+		"INSERT INTO obs VALUES (1, NULL, '2020-01-01'), (2, NULL, '2020-06-30')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cat := &catalogDB{dbconn: db, extents: newExtentCache("")}
+	tbl := &Table{ID: "obs", Table: "obs", GeometryColumn: "geom", TemporalColumn: "t"}
+	tableMap := map[string]*Table{"obs": tbl}
+	cat.snapshot.Store(&catalogSnapshot{tables: tablesSorted(tableMap), tableMap: tableMap})
+
+	cat.updateExtents()
+	updated := cat.snapshot.Load().tableMap["obs"]
+	testEquals(t, "2020-06-30", updated.TemporalExtent.End.Format(time.DateOnly), "temporal extent")
+	testEquals(t, "rows:2", updated.extentVersion, "extent version")
+	testEquals(t, (*TimeInterval)(nil), tbl.TemporalExtent, "previous snapshot unchanged")
+
+	// unchanged data does not replace the snapshot
+	snap := cat.snapshot.Load()
+	cat.updateExtents()
+	testEquals(t, snap, cat.snapshot.Load(), "snapshot kept")
+
+	if _, err := db.Exec("INSERT INTO obs VALUES (3, NULL, '2021-03-01')"); err != nil {
+		t.Fatal(err)
+	}
+	cat.updateExtents()
+	updated = cat.snapshot.Load().tableMap["obs"]
+	testEquals(t, "2021-03-01", updated.TemporalExtent.End.Format(time.DateOnly), "recomputed temporal extent")
+}
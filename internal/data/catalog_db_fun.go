@@ -16,7 +16,6 @@ package data
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -29,124 +28,153 @@ const FunctionIDColumnName = "id"
 const SchemaPostGISFTW = "postgisftw"
 
 func (cat *catalogDB) Functions() ([]*Function, error) {
-	cat.refreshFunctions(true)
-	return cat.functions, nil
+	return cat.current().functions, nil
 }
 
 func (cat *catalogDB) FunctionByName(name string) (*Function, error) {
-	cat.refreshFunctions(false)
-	fn, ok := cat.functionMap[name]
+	fn, ok := cat.current().functionMap[name]
 	if !ok {
 		return nil, nil
 	}
 	return fn, nil
 }
 
-func (cat *catalogDB) refreshFunctions(force bool) {
-	// TODO: refresh on timed basis?
-	if force || !isFunctionsLoaded {
-		cat.loadFunctions()
-	}
-	isFunctionsLoaded = true
-}
-
-func (cat *catalogDB) loadFunctions() {
-	cat.functions, cat.functionMap = readFunctionDefs(cat.dbconn)
-}
-
-func readFunctionDefs(db *sql.DB) ([]*Function, map[string]*Function) {
+func readFunctionDefs(db *sql.DB) ([]*Function, map[string]*Function, error) {
 	sql := sqlFunctions()
 	log.Debugf("Load function catalog:\n%v", sql)
 	rows, err := db.Query(sql)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
-	var functions []*Function
-	functionMap := make(map[string]*Function)
+	var macros []*Function
 	for rows.Next() {
-		fn := scanFunctionDef(rows)
-		// TODO: for now only show geometry functions
-		//if fn.IsGeometryFunction() {
-		functions = append(functions, fn)
-		functionMap[fn.ID] = fn
-		//}
+		fn, err := scanFunctionDef(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		macros = append(macros, fn)
 	}
 	// Check for errors from iterating over rows.
 	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+		rows.Close()
+		return nil, nil, err
 	}
 	rows.Close()
-	return functions, functionMap
+
+	var functions []*Function
+	functionMap := make(map[string]*Function)
+	for _, fn := range macros {
+		// overloaded macros are not supported, so only the first is used
+		if _, ok := functionMap[fn.ID]; ok {
+			log.Warnf("Skipping overloaded function %v", fn.ID)
+			continue
+		}
+		if !describeFunction(db, fn) {
+			log.Warnf("Skipping function %v: unable to determine its output", fn.ID)
+			continue
+		}
+		functions = append(functions, fn)
+		functionMap[fn.ID] = fn
+	}
+	return functions, functionMap, nil
 }
 
-func scanFunctionDef(rows *sql.Rows) *Function {
+func scanFunctionDef(rows *sql.Rows) (*Function, error) {
 	var (
-		id, schema, name, description                                   string
-		inNamesStr, inTypesStr, inDefaultsStr, outNamesStr, outTypesStr string
+		catalog, schema, name, description string
+		inNamesList, inTypesList           interface{}
 	)
 
-	err := rows.Scan(&id, &schema, &name, &description,
-		&inNamesStr, &inTypesStr, &inDefaultsStr, &outNamesStr, &outTypesStr)
+	err := rows.Scan(&catalog, &schema, &name, &description,
+		&inNamesList, &inTypesList)
 	if err != nil {
-		log.Fatalf("Error reading function catalog: %v", err)
+		return nil, fmt.Errorf("unable to read function catalog: %v", err)
+	}
+	id := schema + "." + name
+
+	inNames := toStringArray(inNamesList)
+	inTypes := make([]string, len(inNames))
+	typeList, _ := inTypesList.([]interface{})
+	for i := range inTypes {
+		// macro parameters are untyped unless declared
+		inTypes[i] = DuckDBTypeAny
+		if i < len(typeList) && typeList[i] != nil {
+			inTypes[i] = fmt.Sprintf("%v", typeList[i])
+		}
 	}
-
-	// Parse JSON arrays from strings
-	inNames := parseJSONStringArray(inNamesStr)
-	inTypes := parseJSONStringArray(inTypesStr)
-	inDefaultsDB := parseJSONStringArray(inDefaultsStr)
-	numNoDefault := len(inNames) - len(inDefaultsDB)
-	inDefaults := extendLeft(inDefaultsDB, len(inNames))
-	outNames := parseJSONStringArray(outNamesStr)
-	outTypes := parseJSONStringArray(outTypesStr)
-	outJSONTypes := toJSONTypeFromDuckDBArray(outTypes)
 
 	inTypeMap := make(map[string]string)
 	addTypes(inTypeMap, inNames, inTypes)
 
-	datatypes := make(map[string]string)
-	addTypes(datatypes, inNames, inTypes)
-	addTypes(datatypes, outNames, outTypes)
-
 	// synthesize a description if none provided
 	if description == "" {
 		description = fmt.Sprintf("The function %v", id)
 	}
 
-	geomCol := geometryColumn(outNames, datatypes)
-
 	funDef := Function{
-		ID:             id,
-		Schema:         schema,
-		Name:           name,
-		Description:    description,
-		InNames:        inNames,
-		InDbTypes:      inTypes,
-		InTypeMap:      inTypeMap,
-		InDefaults:     inDefaults,
-		NumNoDefault:   numNoDefault,
-		OutNames:       outNames,
-		OutDbTypes:     outTypes,
-		OutJSONTypes:   outJSONTypes,
-		Types:          datatypes,
-		GeometryColumn: geomCol,
+		ID:          id,
+		Catalog:     catalog,
+		Schema:      schema,
+		Name:        name,
+		Description: description,
+		InNames:     inNames,
+		InDbTypes:   inTypes,
+		InTypeMap:   inTypeMap,
+		// default values are not available from the catalog
+		InDefaults: make([]string, len(inNames)),
 	}
 	//fmt.Printf("DEBUG: Function definitions: %v\n", funDef)
-	return &funDef
+	return &funDef, nil
 }
 
-// parseJSONStringArray parses a JSON string array like '["a","b","c"]' into []string
-func parseJSONStringArray(jsonStr string) []string {
-	if jsonStr == "" || jsonStr == "[]" {
-		return []string{}
+// describeFunction determines the number of positional parameters of a
+// table macro and its output columns, using DESCRIBE.
+// The catalog does not record which parameters have defaults,
+// so the macro is described with increasing numbers of positional arguments
+// until it can be bound.  Parameters with defaults follow positional ones
+func describeFunction(db *sql.DB, fn *Function) bool {
+	for numPositional := 0; numPositional <= len(fn.InNames); numPositional++ {
+		outNames, outTypes, err := readColumnTypes(db, sqlDescribeFunction(fn, numPositional))
+		if err != nil {
+			log.Debugf("Describing function %v with %v positional arguments: %v", fn.ID, numPositional, err)
+			continue
+		}
+		fn.NumNoDefault = numPositional
+		fn.OutNames = outNames
+		fn.OutDbTypes = outTypes
+		fn.OutJSONTypes = toJSONTypeFromDuckDBArray(outTypes)
+		fn.OutJSONFormats = toJSONFormatFromDuckDBArray(outTypes)
+
+		datatypes := make(map[string]string)
+		addTypes(datatypes, fn.InNames, fn.InDbTypes)
+		addTypes(datatypes, outNames, outTypes)
+		fn.Types = datatypes
+		fn.GeometryColumn = geometryColumn(outNames, datatypes)
+		return true
 	}
-	var result []string
-	err := json.Unmarshal([]byte(jsonStr), &result)
+	return false
+}
+
+// readColumnTypes reads the column names and types output by a DESCRIBE query
+func readColumnTypes(db *sql.DB, query string) ([]string, []string, error) {
+	rows, err := db.Query(query)
 	if err != nil {
-		log.Warnf("Error parsing JSON array '%s': %v", jsonStr, err)
-		return []string{}
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var names, types []string
+	for rows.Next() {
+		var name, typ string
+		var null, key, dflt, extra sql.NullString
+		if err := rows.Scan(&name, &typ, &null, &key, &dflt, &extra); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+		types = append(types, typ)
 	}
-	return result
+	return names, types, rows.Err()
 }
 
 func addTypes(typeMap map[string]string, names []string, types []string) {
@@ -164,22 +192,6 @@ func geometryColumn(names []string, types map[string]string) string {
 	return ""
 }
 
-// toArray is no longer needed - replaced by parseJSONStringArray
-
-// extendLeft extends an array to have given size, with original contents right-aligned
-func extendLeft(arr []string, size int) []string {
-	if size <= len(arr) {
-		return arr
-	}
-	// create array of requested size and right-justify input
-	arr2 := make([]string, size)
-	offset := size - len(arr)
-	for i := 0; i < len(arr); i++ {
-		arr2[i+offset] = arr[i]
-	}
-	return arr2
-}
-
 func (cat *catalogDB) FunctionFeatures(ctx context.Context, name string, args map[string]string, param *QueryParam) ([]string, error) {
 	fn, err := cat.FunctionByName(name)
 	if err != nil || fn == nil {
@@ -195,7 +207,10 @@ func (cat *catalogDB) FunctionFeatures(ctx context.Context, name string, args ma
 	sql, argValues := sqlGeomFunction(fn, args, propCols, param)
 	log.Debugf("Function features query: %v", sql)
 	log.Debugf("Function %v Args: %v", name, argValues)
-	features, err := readFeaturesWithArgs(ctx, cat.dbconn, sql, argValues, idColIndex, propCols)
+	ctx, cancel := withQueryTimeout(ctx, fn.ID)
+	defer cancel()
+	propNames := append(propCols, aggregateNames(param.Aggregates)...)
+	features, err := readFeaturesWithArgs(ctx, cat.dbconn, sql, argValues, idColIndex, propNames)
 	return features, err
 }
 
@@ -212,7 +227,9 @@ func (cat *catalogDB) FunctionData(ctx context.Context, name string, args map[st
 	sql, argValues := sqlFunction(fn, args, propCols, param)
 	log.Debugf("Function data query: %v", sql)
 	log.Debugf("Function %v Args: %v", name, argValues)
-	data, err := readDataWithArgs(ctx, cat.dbconn, propCols, sql, argValues)
+	ctx, cancel := withQueryTimeout(ctx, fn.ID)
+	defer cancel()
+	data, err := readDataWithArgs(ctx, cat.dbconn, param.PropertyNames(), sql, argValues)
 	return data, err
 }
 
@@ -246,31 +263,37 @@ func readDataWithArgs(ctx context.Context, db *sql.DB, propCols []string, sql st
 		return nil, err
 	}
 	defer rows.Close()
-	data := scanData(ctx, rows, propCols)
+	data, err := scanData(ctx, rows, propCols)
+	if err != nil {
+		return data, err
+	}
 	log.Debugf(fmtQueryStats, len(data), time.Since(start))
 	return data, nil
 }
 
-func scanData(ctx context.Context, rows *sql.Rows, propCols []string) []map[string]interface{} {
+func scanData(ctx context.Context, rows *sql.Rows, propCols []string) ([]map[string]interface{}, error) {
 	// init data array to empty (not nil)
 	var data []map[string]interface{} = []map[string]interface{}{}
 	for rows.Next() {
+		// stop reading rows as soon as the request is cancelled
+		if err := ctx.Err(); err != nil {
+			return data, err
+		}
 		obj := scanDataRow(rows, propCols)
 		//log.Println(feature)
 		data = append(data, obj)
 	}
-	// context check done outside rows loop,
+	// context check also done outside rows loop,
 	// because a long-running function might not produce any rows before timeout
 	if err := ctx.Err(); err != nil {
-		//log.Debugf("Context error scanning Features: %v", err)
-		return data
+		return data, err
 	}
 	// Check for errors from iterating over rows.
 	if err := rows.Err(); err != nil {
 		log.Warnf("Error scanning Data rows: %v", err)
 		// TODO: return nil here ?
 	}
-	return data
+	return data, nil
 }
 
 func scanDataRow(rows *sql.Rows, propNames []string) map[string]interface{} {
@@ -0,0 +1,144 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+func openFunctionTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE SCHEMA postgisftw",
+		"CREATE SCHEMA other",
+		`CREATE MACRO postgisftw.series(n, label := 'x') AS TABLE
+			SELECT i AS id, label AS name FROM range(n::BIGINT) t(i)`,
+		"CREATE MACRO postgisftw.constant() AS TABLE SELECT 42 AS answer",
+		"CREATE MACRO other.hidden() AS TABLE SELECT 1 AS one",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestReadFunctionDefs(t *testing.T) {
+	db := openFunctionTestDB(t)
+	defer db.Close()
+
+	saved := conf.Configuration.Database.FunctionIncludes
+	defer func() { conf.Configuration.Database.FunctionIncludes = saved }()
+	conf.Configuration.Database.FunctionIncludes = []string{"postgisftw"}
+
+	functions, functionMap, err := readFunctionDefs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEquals(t, 2, len(functions), "functions in included schema")
+	_, ok := functionMap["other.hidden"]
+	testEquals(t, false, ok, "function in other schema")
+
+	fn := functionMap["postgisftw.series"]
+	testEquals(t, "memory", fn.Catalog, "catalog")
+	testEquals(t, []string{"n", "label"}, fn.InNames, "InNames")
+	testEquals(t, []string{DuckDBTypeAny, DuckDBTypeAny}, fn.InDbTypes, "InDbTypes")
+	testEquals(t, 2, len(fn.InDefaults), "InDefaults")
+	testEquals(t, 1, fn.NumNoDefault, "NumNoDefault")
+	testEquals(t, []string{"id", "name"}, fn.OutNames, "OutNames")
+	testEquals(t, []string{"BIGINT", "VARCHAR"}, fn.OutDbTypes, "OutDbTypes")
+
+	fn = functionMap["postgisftw.constant"]
+	testEquals(t, 0, fn.NumNoDefault, "no parameters")
+	testEquals(t, []string{"answer"}, fn.OutNames, "OutNames")
+}
+
+func TestFunctionData(t *testing.T) {
+	db := openFunctionTestDB(t)
+	defer db.Close()
+
+	saved := conf.Configuration.Database.FunctionIncludes
+	defer func() { conf.Configuration.Database.FunctionIncludes = saved }()
+	conf.Configuration.Database.FunctionIncludes = []string{"postgisftw"}
+
+	_, functionMap, err := readFunctionDefs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := functionMap["postgisftw.series"]
+	cols := []string{"id", "name"}
+	param := &QueryParam{Limit: -1}
+
+	query, args := sqlFunction(fn, map[string]string{"n": "2", "label": "it's"}, cols, param)
+	data, err := readDataWithArgs(context.Background(), db, cols, query, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEquals(t, 2, len(data), "rows for positional argument: "+query)
+	testEquals(t, "it's", data[1]["name"], "named argument")
+
+	query, args = sqlFunction(fn, map[string]string{"n": "3"}, cols, param)
+	data, _ = readDataWithArgs(context.Background(), db, cols, query, args)
+	testEquals(t, 3, len(data), "rows with default: "+query)
+	testEquals(t, "x", data[0]["name"], "default argument")
+}
+
+func TestSqlFunctionArgs(t *testing.T) {
+	fn := &Function{
+		InNames:      []string{"a", "b", "c"},
+		InDbTypes:    []string{DuckDBTypeAny, "INTEGER", DuckDBTypeAny},
+		NumNoDefault: 2,
+	}
+	sql, vals := sqlFunctionArgs(fn, map[string]string{"b": "1", "c": "z"})
+	testEquals(t, `NULL, $1::INTEGER, "c" := $2`, sql, "macro arguments")
+	testEquals(t, []interface{}{"1", "z"}, vals, "argument values")
+}
+
+func TestQueryTimeout(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	saved := conf.Configuration
+	defer func() { conf.Configuration = saved }()
+	conf.Configuration.Database.QueryTimeoutSec = 1
+	conf.Configuration.Collections = map[string]conf.Collection{
+		"memory.main.slow": {QueryTimeoutSec: 30},
+	}
+	ctx, cancel := withQueryTimeout(context.Background(), "memory.main.slow")
+	deadline, _ := ctx.Deadline()
+	cancel()
+	testEquals(t, true, time.Until(deadline) > 20*time.Second, "collection timeout")
+
+	// a long-running query is interrupted when the timeout expires
+	ctx, cancel = withQueryTimeout(context.Background(), "memory.main.other")
+	defer cancel()
+	start := time.Now()
+	_, err = readDataWithArgs(ctx, db, []string{"n"},
+		"SELECT count(*) AS n FROM range(100000000000) a(i), range(10) b(j) WHERE i % 7 = j", nil)
+	testEquals(t, true, errors.Is(err, context.DeadlineExceeded), fmt.Sprintf("timeout error: %v", err))
+	testEquals(t, true, time.Since(start) < 10*time.Second, "query interrupted")
+}
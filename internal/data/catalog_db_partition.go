@@ -0,0 +1,95 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// isHivePath tests whether a path contains hive partition directories (key=value)
+func isHivePath(path string) bool {
+	dirs := strings.Split(slashPath(path), "/")
+	for _, dir := range dirs[:len(dirs)-1] {
+		if strings.Contains(dir, "=") {
+			return true
+		}
+	}
+	return false
+}
+
+// readPartitions reads the hive partition keys and values of a Parquet dataset
+// from the names of the files it contains.
+// This does not read the files, so is cheap enough to do on every metadata request
+func readPartitions(db *sql.DB, path string) ([]Partition, error) {
+	rows, err := db.Query(sqlGlobFiles, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return hivePartitions(files), nil
+}
+
+// hivePartitions extracts the partition keys and their distinct values from file paths.
+// Keys are in path order, and values are sorted
+func hivePartitions(files []string) []Partition {
+	var keys []string
+	values := make(map[string]map[string]bool)
+	for _, file := range files {
+		dirs := strings.Split(slashPath(file), "/")
+		for _, dir := range dirs[:len(dirs)-1] {
+			key, val, ok := strings.Cut(dir, "=")
+			if !ok || key == "" {
+				continue
+			}
+			if unescaped, err := url.PathUnescape(val); err == nil {
+				val = unescaped
+			}
+			if _, ok := values[key]; !ok {
+				keys = append(keys, key)
+				values[key] = make(map[string]bool)
+			}
+			values[key][val] = true
+		}
+	}
+	partitions := make([]Partition, len(keys))
+	for i, key := range keys {
+		vals := make([]string, 0, len(values[key]))
+		for val := range values[key] {
+			vals = append(vals, val)
+		}
+		sort.Strings(vals)
+		partitions[i] = Partition{Name: key, Values: vals}
+	}
+	return partitions
+}
+
+// slashPath normalizes path separators, since DuckDB may list files with either
+func slashPath(path string) string {
+	return strings.ReplaceAll(path, "\\", "/")
+}
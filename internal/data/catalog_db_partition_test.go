@@ -0,0 +1,129 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+// openPartitionTestDB writes a dataset partitioned by region and year,
+// and creates a view over it as for a data source
+func openPartitionTestDB(t *testing.T) (*sql.DB, string) {
+	dir := t.TempDir()
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, isHive := sourceParquetPath(conf.Source{Path: dir})
+	for _, stmt := range []string{
+		fmt.Sprintf(`COPY (SELECT i AS id, 'r' || (i %% 3) AS region, 2020 + (i %% 2) AS year
+			FROM range(30) t(i)) TO %s (FORMAT parquet, PARTITION_BY (region, year))`, quoteLiteral(dir)),
+		"CREATE VIEW trips AS SELECT * FROM " + sqlSourceScan([]string{path}, "", isHive),
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, path
+}
+
+func TestIsHivePath(t *testing.T) {
+	testEquals(t, true, isHivePath("data/region=*/year=*/*.parquet"), "partition directories")
+	testEquals(t, false, isHivePath("data/*/*.parquet"), "plain directories")
+	testEquals(t, false, isHivePath("data/a=b.parquet"), "file name is not a partition")
+}
+
+func TestHivePartitions(t *testing.T) {
+	partitions := hivePartitions([]string{
+		"data/region=south/year=2021/part-0.parquet",
+		"data/region=north/year=2020/part-0.parquet",
+		"data/region=north/year=2021/part-0.parquet",
+		"data/region=new%20north/year=2021/part-0.parquet",
+	})
+	testEquals(t, []Partition{
+		{Name: "region", Values: []string{"new north", "north", "south"}},
+		{Name: "year", Values: []string{"2020", "2021"}},
+	}, partitions, "partitions")
+	testEquals(t, 0, len(hivePartitions([]string{"data/part-0.parquet"})), "unpartitioned")
+}
+
+func TestSourceParquetPath(t *testing.T) {
+	dir := t.TempDir()
+	path, isHive := sourceParquetPath(conf.Source{Path: dir})
+	testEquals(t, filepath.Join(dir, "**", "*.parquet"), path, "directory path")
+	testEquals(t, true, isHive, "directory is hive partitioned")
+
+	_, isHive = sourceParquetPath(conf.Source{Path: "data/region=*/*.parquet"})
+	testEquals(t, true, isHive, "partitioned glob")
+	_, isHive = sourceParquetPath(conf.Source{Path: "data/*.parquet", HivePartitioning: true})
+	testEquals(t, true, isHive, "configured")
+	_, isHive = sourceParquetPath(conf.Source{Path: "data/*.parquet"})
+	testEquals(t, false, isHive, "not partitioned")
+
+	view := sqlSourceView("trips", sqlSourceScan([]string{path}, "", true), "geometry", false)
+	src := viewSourceFile(view)
+	testEquals(t, true, src.HivePartitioned, "view source is partitioned")
+	testEquals(t, path, src.Path, "view source path")
+}
+
+func TestReadPartitions(t *testing.T) {
+	db, path := openPartitionTestDB(t)
+	defer db.Close()
+
+	partitions, err := readPartitions(db, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEquals(t, []Partition{
+		{Name: "region", Values: []string{"r0", "r1", "r2"}},
+		{Name: "year", Values: []string{"2020", "2021"}},
+	}, partitions, "partitions")
+
+	// missing directories have no partitions
+	partitions, err = readPartitions(db, filepath.Join(os.TempDir(), "missing", "**", "*.parquet"))
+	testEquals(t, nil, err, "missing dataset")
+	testEquals(t, 0, len(partitions), "missing dataset partitions")
+}
+
+func TestPartitionPruning(t *testing.T) {
+	db, _ := openPartitionTestDB(t)
+	defer db.Close()
+
+	// partition keys are columns of the collection
+	cols, _, _, _, _ := getTableColumns(db, "memory", "main", "trips", "")
+	testEquals(t, []string{"id", "region", "year"}, cols, "partition keys are properties")
+
+	// property filters are passed to the Parquet reader, which only reads matching files
+	where, args := sqlAttrFilter([]*PropertyFilter{{Name: "region", Value: "r1"}, {Name: "year", Value: "2021"}}, 1)
+	var count int
+	err := db.QueryRow("SELECT count(*) FROM trips WHERE "+where, args...).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEquals(t, 5, count, "filtered rows")
+
+	var planKey, plan string
+	err = db.QueryRow("EXPLAIN ANALYZE SELECT id FROM trips WHERE "+where, args...).Scan(&planKey, &plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEquals(t, true, strings.Contains(plan, "Scanning Files: 1/6"), "partitions pruned:\n"+plan)
+}
@@ -0,0 +1,130 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+// catalogSnapshot is an immutable view of the published tables and functions
+type catalogSnapshot struct {
+	tables      []*Table
+	tableMap    map[string]*Table
+	functions   []*Function
+	functionMap map[string]*Function
+	// signature identifies the database schema the snapshot was loaded from
+	signature string
+}
+
+// current provides the current catalog snapshot.
+// The catalog is loaded on first use, after which it is refreshed in the background
+func (cat *catalogDB) current() *catalogSnapshot {
+	if snap := cat.snapshot.Load(); snap != nil {
+		return snap
+	}
+	cat.loadMutex.Lock()
+	defer cat.loadMutex.Unlock()
+	// another request may have loaded the catalog while waiting
+	if snap := cat.snapshot.Load(); snap != nil {
+		return snap
+	}
+	signature, err := cat.readCatalogSignature()
+	if err != nil {
+		log.Fatalf("Error reading catalog: %v", err)
+	}
+	snap, err := cat.loadSnapshot(signature)
+	if err != nil {
+		log.Fatalf("Error loading catalog: %v", err)
+	}
+	cat.snapshot.Store(snap)
+	cat.refreshOnce.Do(cat.startRefresh)
+	go cat.updateExtents()
+	return snap
+}
+
+// loadSnapshot reads the tables and functions from the database
+func (cat *catalogDB) loadSnapshot(signature string) (*catalogSnapshot, error) {
+	tableMap, err := cat.readTables(cat.dbconn)
+	if err != nil {
+		return nil, err
+	}
+	functions, functionMap, err := readFunctionDefs(cat.dbconn)
+	if err != nil {
+		return nil, err
+	}
+	cat.extents.applyTo(tableMap)
+	return &catalogSnapshot{
+		tables:      tablesSorted(tableMap),
+		tableMap:    tableMap,
+		functions:   functions,
+		functionMap: functionMap,
+		signature:   signature,
+	}, nil
+}
+
+// refresh reloads the catalog if the database schema has changed.
+// If the reload fails the current catalog continues to be used
+func (cat *catalogDB) refresh() {
+	cat.loadMutex.Lock()
+	defer cat.loadMutex.Unlock()
+
+	signature, err := cat.readCatalogSignature()
+	if err != nil {
+		log.Warnf("Error checking catalog for changes: %v", err)
+		return
+	}
+	if cur := cat.snapshot.Load(); cur != nil && cur.signature == signature {
+		log.Debug("Catalog is unchanged")
+		return
+	}
+	log.Info("Database schema has changed, reloading catalog")
+	snap, err := cat.loadSnapshot(signature)
+	if err != nil {
+		log.Warnf("Error reloading catalog: %v", err)
+		return
+	}
+	cat.snapshot.Store(snap)
+}
+
+// startRefresh starts refreshing the catalog and table extents periodically, if configured
+func (cat *catalogDB) startRefresh() {
+	intervalSec := conf.Configuration.Database.CatalogRefreshIntervalSec
+	if intervalSec <= 0 || cat.stopRefresh == nil {
+		return
+	}
+	log.Infof("Checking catalog for changes every %v seconds", intervalSec)
+	go func() {
+		ticker := time.NewTicker(time.Duration(intervalSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-cat.stopRefresh:
+				return
+			case <-ticker.C:
+				cat.refresh()
+				cat.updateExtents()
+			}
+		}
+	}()
+}
+
+// readCatalogSignature computes a signature of the database schema
+func (cat *catalogDB) readCatalogSignature() (string, error) {
+	var signature string
+	err := cat.dbconn.QueryRow(sqlCatalogSignature).Scan(&signature)
+	return signature, err
+}
@@ -0,0 +1,101 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestCatalogSignature(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cat := &catalogDB{dbconn: db}
+
+	readSignature := func() string {
+		signature, err := cat.readCatalogSignature()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+	exec := func(stmt string) {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	empty := readSignature()
+	testEquals(t, empty, readSignature(), "signature is stable")
+
+	exec("CREATE TABLE parcels (id INTEGER, name VARCHAR)")
+	created := readSignature()
+	testEquals(t, false, created == empty, "signature changes on CREATE TABLE")
+
+	exec("INSERT INTO parcels VALUES (1, 'a')")
+	testEquals(t, created, readSignature(), "signature unchanged by data")
+
+	exec("COMMENT ON COLUMN parcels.name IS 'Parcel name'")
+	commented := readSignature()
+	testEquals(t, false, commented == created, "signature changes on COMMENT")
+
+	exec("CREATE MACRO series(n) AS TABLE SELECT i FROM range(n::BIGINT) t(i)")
+	testEquals(t, false, readSignature() == commented, "signature changes on CREATE MACRO")
+}
+
+// TestRefreshTableDropped tests that the current catalog continues to be used
+// if a table is dropped while the catalog is loading
+func TestRefreshTableDropped(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	exec := func(stmt string) {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the spatial extension may not be available, so use BLOB as the geometry type
+	saved := tablesQuery
+	defer func() { tablesQuery = saved }()
+	sqlBlobTables := strings.ReplaceAll(sqlTables, "'GEOMETRY'", "'BLOB'")
+	tablesQuery = sqlBlobTables
+	cat := &catalogDB{dbconn: db, extents: newExtentCache("")}
+
+	exec("CREATE TABLE parcels (id INTEGER, geom BLOB)")
+	cat.refresh()
+	loaded := cat.snapshot.Load()
+	testEquals(t, 1, len(loaded.tables), "# tables loaded")
+
+	// the tables are listed before one is dropped, as happens if it is dropped while loading
+	exec("CREATE TABLE roads (id INTEGER, geom BLOB)")
+	exec("CREATE TABLE listed AS " + sqlBlobTables)
+	exec("DROP TABLE roads")
+	tablesQuery = "SELECT * FROM listed"
+	cat.refresh()
+	testEquals(t, loaded, cat.snapshot.Load(), "current catalog used after failed reload")
+
+	// the next refresh loads the changed catalog
+	tablesQuery = sqlBlobTables
+	cat.refresh()
+	reloaded := cat.snapshot.Load()
+	testEquals(t, 1, len(reloaded.tables), "# tables reloaded")
+	testEquals(t, false, reloaded == loaded, "catalog reloaded")
+}
@@ -0,0 +1,202 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+// SourcesCatalog is the in-memory catalog holding the views over data file sources.
+// Sources are published with IDs of the form sources.main.<name>
+const SourcesCatalog = "sources"
+
+// DuckDBTypeBlob is the type of WKB geometry columns which are not converted on read
+const DuckDBTypeBlob = "BLOB"
+
+// sourceGeometryNames are the usual names of WKB geometry columns
+var sourceGeometryNames = []string{"geometry", "geom", "wkb_geometry", "the_geom"}
+
+// registerSources creates views over the configured data file sources,
+// so they are discovered and published like any other view.
+// A source which cannot be read is logged and skipped
+func registerSources(db *sql.DB, sources []conf.Source) {
+	if len(sources) == 0 {
+		return
+	}
+	if _, err := db.Exec(sqlAttachSources); err != nil {
+		log.Errorf("Unable to create catalog for data sources: %v", err)
+		return
+	}
+	for _, src := range sources {
+		if err := registerSource(db, src); err != nil {
+			log.Errorf("Unable to publish data source %s: %v", src.Path, err)
+		}
+	}
+}
+
+func registerSource(db *sql.DB, src conf.Source) error {
+	path, isHive := sourceParquetPath(src)
+	paths, err := sourcePaths(path)
+	if err != nil {
+		return err
+	}
+	scan := sqlSourceScan(paths, src.Layer, isHive)
+	names, types, err := readColumnTypes(db, sqlDescribeSource(scan))
+	if err != nil {
+		return err
+	}
+	var primaryCol string
+	if isParquetPath(path) {
+		primaryCol = readGeoParquetPrimaryColumn(db, path)
+	}
+	geomCol, isWKB, err := sourceGeometryColumn(src.GeometryColumn, primaryCol, names, types)
+	if err != nil {
+		return err
+	}
+	name := sourceName(src)
+	if _, err := db.Exec(sqlSourceView(name, scan, geomCol, isWKB)); err != nil {
+		return err
+	}
+	log.Infof("Publishing data source %s as %s", src.Path, sourceCollectionID(src))
+	return nil
+}
+
+// sourceParquetPath provides the path to read for a source,
+// and whether it is a hive-partitioned Parquet dataset.
+// A directory is read as all the Parquet files it contains, with hive partitioning
+func sourceParquetPath(src conf.Source) (string, bool) {
+	if info, err := os.Stat(src.Path); err == nil && info.IsDir() {
+		return filepath.Join(src.Path, "**", "*.parquet"), true
+	}
+	isHive := isParquetPath(src.Path) && (src.HivePartitioning || isHivePath(src.Path))
+	return src.Path, isHive
+}
+
+// sourcePaths provides the files to read for a source path.
+// Parquet globs are expanded by DuckDB, so are used as is.
+// URLs are not expanded
+func sourcePaths(path string) ([]string, error) {
+	if isParquetPath(path) || !hasGlob(path) || strings.Contains(path, "://") {
+		return []string{path}, nil
+	}
+	paths, err := filepath.Glob(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match %s", path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// sourceGeometryColumn determines the geometry column of a source,
+// and whether it is WKB which must be converted to GEOMETRY.
+// A configured column is used if present. Otherwise the first GEOMETRY column,
+// the GeoParquet primary column or a WKB column with a usual name is used
+func sourceGeometryColumn(configured string, primaryCol string, names []string, types []string) (string, bool, error) {
+	isWKB := func(i int) bool {
+		return strings.EqualFold(types[i], DuckDBTypeBlob)
+	}
+	if configured != "" {
+		i := indexOfName(names, configured)
+		if i < 0 {
+			return "", false, fmt.Errorf("geometry column %s not found", configured)
+		}
+		if !isWKB(i) && !strings.EqualFold(types[i], DuckDBTypeGeometry) {
+			return "", false, fmt.Errorf("geometry column %s has unsupported type %s", configured, types[i])
+		}
+		return configured, isWKB(i), nil
+	}
+	for i, typ := range types {
+		if strings.EqualFold(typ, DuckDBTypeGeometry) {
+			return names[i], false, nil
+		}
+	}
+	if i := indexOfName(names, primaryCol); primaryCol != "" && i >= 0 && isWKB(i) {
+		return primaryCol, true, nil
+	}
+	for _, geomName := range sourceGeometryNames {
+		for i, name := range names {
+			if strings.EqualFold(name, geomName) && isWKB(i) {
+				return name, true, nil
+			}
+		}
+	}
+	return "", false, fmt.Errorf("no geometry column found")
+}
+
+// readGeoParquetPrimaryColumn reads the primary geometry column from GeoParquet metadata, if any
+func readGeoParquetPrimaryColumn(db *sql.DB, path string) string {
+	var metaJSON string
+	if err := db.QueryRow(sqlGeoParquetMeta, path).Scan(&metaJSON); err != nil {
+		return ""
+	}
+	var meta geoParquetMeta
+	if err := json.Unmarshal([]byte(metaJSON), &meta); err != nil {
+		return ""
+	}
+	return meta.PrimaryColumn
+}
+
+// sourceName provides the table name of a source.
+// If not configured it is the layer name, or the file name without extension.
+// For a glob the name of the directory containing the files is used
+func sourceName(src conf.Source) string {
+	if src.Name != "" {
+		return src.Name
+	}
+	if src.Layer != "" {
+		return src.Layer
+	}
+	path := strings.TrimRight(src.Path, "/")
+	base := filepath.Base(path)
+	for hasGlob(base) {
+		path = filepath.Dir(path)
+		base = filepath.Base(path)
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// sourceCollectionID provides the collection ID of a source
+func sourceCollectionID(src conf.Source) string {
+	return SourcesCatalog + ".main." + sourceName(src)
+}
+
+// sourceConfig finds the source published as a collection, if any
+func sourceConfig(id string) (conf.Source, bool) {
+	for _, src := range conf.Configuration.Sources {
+		if strings.EqualFold(sourceCollectionID(src), id) {
+			return src, true
+		}
+	}
+	return conf.Source{}, false
+}
+
+func isParquetPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".parquet")
+}
+
+func hasGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
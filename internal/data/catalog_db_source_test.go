@@ -0,0 +1,145 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+func TestSourceName(t *testing.T) {
+	testEquals(t, "points", sourceName(conf.Source{Name: "points", Path: "data/ws_point.parquet"}), "configured name")
+	testEquals(t, "ws_line", sourceName(conf.Source{Path: "data/ws.gpkg", Layer: "ws_line"}), "layer name")
+	testEquals(t, "ws_point", sourceName(conf.Source{Path: "data/ws_point.parquet"}), "file name")
+	testEquals(t, "points", sourceName(conf.Source{Path: "data/points/*.parquet"}), "glob directory name")
+	testEquals(t, "points", sourceName(conf.Source{Path: "data/points/*/*.parquet"}), "nested glob directory name")
+	testEquals(t, "sources.main.ws_point", sourceCollectionID(conf.Source{Path: "ws_point.parquet"}), "collection ID")
+}
+
+func TestSourceGeometryColumn(t *testing.T) {
+	names := []string{"id", "shape", "geometry"}
+
+	col, isWKB, err := sourceGeometryColumn("", "", names, []string{"INTEGER", "GEOMETRY", "BLOB"})
+	testEquals(t, nil, err, "error")
+	testEquals(t, "shape", col, "GEOMETRY column preferred")
+	testEquals(t, false, isWKB, "GEOMETRY is not converted")
+
+	col, isWKB, _ = sourceGeometryColumn("", "", names, []string{"INTEGER", "BLOB", "BLOB"})
+	testEquals(t, "geometry", col, "WKB column with usual name")
+	testEquals(t, true, isWKB, "WKB is converted")
+
+	col, _, _ = sourceGeometryColumn("", "shape", names, []string{"INTEGER", "BLOB", "BLOB"})
+	testEquals(t, "shape", col, "GeoParquet primary column")
+
+	col, isWKB, _ = sourceGeometryColumn("shape", "", names, []string{"INTEGER", "BLOB", "GEOMETRY"})
+	testEquals(t, "shape", col, "configured column")
+	testEquals(t, true, isWKB, "configured WKB column is converted")
+
+	_, _, err = sourceGeometryColumn("missing", "", names, []string{"INTEGER", "BLOB", "BLOB"})
+	testEquals(t, true, err != nil, "configured column not found")
+
+	_, _, err = sourceGeometryColumn("id", "", names, []string{"INTEGER", "BLOB", "BLOB"})
+	testEquals(t, true, err != nil, "configured column with unsupported type")
+
+	_, _, err = sourceGeometryColumn("", "", []string{"id", "name"}, []string{"INTEGER", "VARCHAR"})
+	testEquals(t, true, err != nil, "no geometry column")
+}
+
+func TestSqlSourceScan(t *testing.T) {
+	testEquals(t, "read_parquet('data/*.parquet')", sqlSourceScan([]string{"data/*.parquet"}, "", false), "parquet glob")
+	testEquals(t, "ST_Read('it''s.fgb')", sqlSourceScan([]string{"it's.fgb"}, "", false), "quoted path")
+	testEquals(t, "ST_Read('ws.gpkg', layer := 'ws_line')", sqlSourceScan([]string{"ws.gpkg"}, "ws_line", false), "layer")
+	testEquals(t, "(SELECT * FROM ST_Read('a.fgb') UNION ALL BY NAME SELECT * FROM ST_Read('b.fgb'))",
+		sqlSourceScan([]string{"a.fgb", "b.fgb"}, "", false), "multiple files")
+
+	// the view SQL must be recognized as a data file source for SRID detection
+	view := sqlSourceView("ws_point", sqlSourceScan([]string{"ws_point.parquet"}, "", false), "geometry", true)
+	testEquals(t, `CREATE OR REPLACE VIEW "sources".main."ws_point" AS SELECT * REPLACE (ST_GeomFromWKB("geometry") AS "geometry") FROM read_parquet('ws_point.parquet')`,
+		view, "WKB source view")
+	testEquals(t, &sourceFile{Kind: sourceKindParquet, Path: "ws_point.parquet"}, viewSourceFile(view), "view source file")
+	view = sqlSourceView("ws_line", sqlSourceScan([]string{"ws.gpkg"}, "ws_line", false), "geom", false)
+	testEquals(t, &sourceFile{Kind: sourceKindGDAL, Path: "ws.gpkg", Layer: "ws_line"}, viewSourceFile(view), "GDAL view source file")
+}
+
+func TestSourcePaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.fgb", "a.fgb", "c.gpkg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths, err := sourcePaths(filepath.Join(dir, "*.fgb"))
+	testEquals(t, nil, err, "error")
+	testEquals(t, []string{filepath.Join(dir, "a.fgb"), filepath.Join(dir, "b.fgb")}, paths, "expanded glob")
+
+	paths, _ = sourcePaths(filepath.Join(dir, "*.parquet"))
+	testEquals(t, []string{filepath.Join(dir, "*.parquet")}, paths, "parquet glob is not expanded")
+
+	_, err = sourcePaths(filepath.Join(dir, "*.shp"))
+	testEquals(t, true, err != nil, "glob with no matches")
+}
+
+func TestSourceIDColumn(t *testing.T) {
+	saved := conf.Configuration.Sources
+	defer func() { conf.Configuration.Sources = saved }()
+	conf.Configuration.Sources = []conf.Source{{Path: "data/ws_point.parquet", IdColumn: "FID"}}
+
+	testEquals(t, "FID", configuredIDColumn("sources.main.ws_point"), "source ID column")
+	testEquals(t, "", configuredIDColumn("sources.main.other"), "no source")
+}
+
+func TestReadGeoParquetPrimaryColumn(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	testEquals(t, "geometry", readGeoParquetPrimaryColumn(db, "../../jojodata/ws_point.parquet"), "primary column")
+	testEquals(t, "", readGeoParquetPrimaryColumn(db, "../../jojodata/missing.parquet"), "missing file")
+}
+
+func TestRegisterSourcesReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ro.duckdb")
+	db, err := sql.Open("duckdb", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE parcels (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = sql.Open("duckdb", dbDSN(conf.Database{DatabasePath: path, ReadOnly: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// the spatial extension may not be available, so WKB is read as is
+	if _, err := db.Exec("LOAD spatial"); err != nil {
+		if _, err := db.Exec("CREATE TEMP MACRO ST_GeomFromWKB(wkb) AS wkb"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registerSources(db, []conf.Source{{Path: "../../jojodata/ws_point.parquet"}})
+	var count int
+	err = db.QueryRow(`SELECT count(*) FROM "sources".main."ws_point"`).Scan(&count)
+	testEquals(t, nil, err, "source published in read-only database")
+	testEquals(t, true, count > 0, "source rows")
+}
@@ -0,0 +1,214 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+// Source file kinds which can carry CRS metadata
+const (
+	sourceKindParquet = "parquet"
+	sourceKindGDAL    = "gdal"
+)
+
+var (
+	reSourceParquet  = regexp.MustCompile(`(?i)read_parquet\s*\(\s*'([^']+)'`)
+	reSourceGDAL     = regexp.MustCompile(`(?i)st_read\s*\(\s*'([^']+)'`)
+	reSourceGDALLyr  = regexp.MustCompile(`(?i)layer\s*:?=\s*'([^']+)'`)
+	reSourceFileScan = regexp.MustCompile(`(?i)from\s+'([^']+\.parquet)'`)
+	reSourceHive     = regexp.MustCompile(`(?i)hive_partitioning\s*:?=\s*(true|1)`)
+)
+
+// sourceFile is a data file referenced by a view definition
+type sourceFile struct {
+	Kind  string
+	Path  string
+	Layer string
+	// HivePartitioned is set for Parquet datasets read with hive partitioning
+	HivePartitioned bool
+}
+
+// viewSourceFile extracts the data file scanned by a view, if any
+func viewSourceFile(viewSQL string) *sourceFile {
+	if m := reSourceParquet.FindStringSubmatch(viewSQL); m != nil {
+		return &sourceFile{Kind: sourceKindParquet, Path: m[1],
+			HivePartitioned: reSourceHive.MatchString(viewSQL)}
+	}
+	if m := reSourceFileScan.FindStringSubmatch(viewSQL); m != nil {
+		return &sourceFile{Kind: sourceKindParquet, Path: m[1]}
+	}
+	if m := reSourceGDAL.FindStringSubmatch(viewSQL); m != nil {
+		src := &sourceFile{Kind: sourceKindGDAL, Path: m[1]}
+		if lyr := reSourceGDALLyr.FindStringSubmatch(viewSQL); lyr != nil {
+			src.Layer = lyr[1]
+		}
+		return src
+	}
+	return nil
+}
+
+// resolveSrid determines the SRID of a geometry column.
+// It is resolved in order from:
+// GeoParquet metadata, GDAL layer CRS, collection configuration,
+// and finally the configured default SRID
+func resolveSrid(db *sql.DB, id string, geomCol string, src *sourceFile) int {
+	if src != nil {
+		switch src.Kind {
+		case sourceKindParquet:
+			if srid, ok := readGeoParquetSrid(db, src.Path, geomCol); ok {
+				log.Debugf("SRID for %s.%s from GeoParquet metadata: %d", id, geomCol, srid)
+				return srid
+			}
+		case sourceKindGDAL:
+			if srid, ok := readGDALSrid(db, src.Path, src.Layer, geomCol); ok {
+				log.Debugf("SRID for %s.%s from GDAL layer: %d", id, geomCol, srid)
+				return srid
+			}
+		}
+	}
+	if coll, ok := conf.Configuration.CollectionConfig(id); ok && coll.Srid > 0 {
+		return coll.Srid
+	}
+	if conf.Configuration.Database.DefaultSrid > 0 {
+		return conf.Configuration.Database.DefaultSrid
+	}
+	return SRID_4326
+}
+
+// readGeoParquetSrid reads the SRID of a column from the GeoParquet "geo" metadata
+func readGeoParquetSrid(db *sql.DB, path string, geomCol string) (int, bool) {
+	var meta string
+	err := db.QueryRow(sqlGeoParquetMeta, path).Scan(&meta)
+	if err != nil {
+		log.Debugf("No GeoParquet metadata for %s: %v", path, err)
+		return 0, false
+	}
+	return geoParquetSrid(meta, geomCol)
+}
+
+type geoParquetMeta struct {
+	PrimaryColumn string                                `json:"primary_column"`
+	Columns       map[string]map[string]json.RawMessage `json:"columns"`
+}
+
+// geoParquetSrid extracts the SRID of a column from GeoParquet metadata JSON.
+// As per the GeoParquet spec a missing CRS denotes OGC:CRS84,
+// and a null CRS denotes an undefined CRS
+func geoParquetSrid(metaJSON string, geomCol string) (int, bool) {
+	var meta geoParquetMeta
+	if err := json.Unmarshal([]byte(metaJSON), &meta); err != nil {
+		log.Warnf("Invalid GeoParquet metadata: %v", err)
+		return 0, false
+	}
+	col, ok := meta.Columns[geomCol]
+	if !ok {
+		col, ok = meta.Columns[meta.PrimaryColumn]
+	}
+	if !ok {
+		return 0, false
+	}
+	crs, ok := col["crs"]
+	if !ok {
+		return SRID_4326, true
+	}
+	return projJSONSrid(crs)
+}
+
+// projJSONSrid extracts an SRID from a PROJJSON CRS definition
+// or from an authority:code string
+func projJSONSrid(crs json.RawMessage) (int, bool) {
+	var crsStr string
+	if err := json.Unmarshal(crs, &crsStr); err == nil {
+		return authCodeSrid(crsStr)
+	}
+	var def struct {
+		ID *struct {
+			Authority string      `json:"authority"`
+			Code      json.Number `json:"code"`
+		} `json:"id"`
+	}
+	if err := json.Unmarshal(crs, &def); err != nil || def.ID == nil {
+		return 0, false
+	}
+	return authoritySrid(def.ID.Authority, def.ID.Code.String())
+}
+
+// authCodeSrid parses an SRID from a string such as EPSG:2193
+func authCodeSrid(authCode string) (int, bool) {
+	parts := strings.SplitN(authCode, ":", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	return authoritySrid(parts[0], parts[1])
+}
+
+// authoritySrid converts an authority and code to an SRID.
+// OGC CRS84 is treated as EPSG 4326
+func authoritySrid(authority string, code string) (int, bool) {
+	switch strings.ToUpper(authority) {
+	case "EPSG":
+		srid, err := strconv.Atoi(code)
+		if err != nil {
+			return 0, false
+		}
+		return srid, true
+	case "OGC":
+		if strings.EqualFold(code, "CRS84") {
+			return SRID_4326, true
+		}
+	}
+	return 0, false
+}
+
+// readGDALSrid reads the SRID of a layer geometry field using ST_Read_Meta
+func readGDALSrid(db *sql.DB, path string, layer string, geomCol string) (int, bool) {
+	rows, err := db.Query(sqlGdalGeomFields, path)
+	if err != nil {
+		log.Debugf("Unable to read GDAL metadata for %s: %v", path, err)
+		return 0, false
+	}
+	defer rows.Close()
+
+	srid, found := 0, false
+	for rows.Next() {
+		var layerName, fieldName, authName, authCode string
+		if err := rows.Scan(&layerName, &fieldName, &authName, &authCode); err != nil {
+			log.Debugf("Error reading GDAL metadata for %s: %v", path, err)
+			return 0, false
+		}
+		if layer != "" && layerName != layer {
+			continue
+		}
+		fieldSrid, ok := authoritySrid(authName, authCode)
+		if !ok {
+			continue
+		}
+		// a matching field name is preferred, otherwise the first field is used
+		if fieldName == geomCol {
+			return fieldSrid, true
+		}
+		if !found {
+			srid, found = fieldSrid, true
+		}
+	}
+	return srid, found
+}
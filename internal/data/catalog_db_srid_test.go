@@ -0,0 +1,131 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+func TestViewSourceFile(t *testing.T) {
+	src := viewSourceFile("CREATE VIEW pts AS SELECT * FROM read_parquet('data/pts.parquet');")
+	testEquals(t, &sourceFile{Kind: sourceKindParquet, Path: "data/pts.parquet"}, src, "read_parquet")
+
+	src = viewSourceFile("CREATE VIEW pts AS SELECT * FROM 'data/*.parquet';")
+	testEquals(t, &sourceFile{Kind: sourceKindParquet, Path: "data/*.parquet"}, src, "parquet replacement scan")
+
+	src = viewSourceFile("CREATE VIEW ln AS SELECT * FROM ST_Read('data/ws.gpkg', layer='ws_line');")
+	testEquals(t, &sourceFile{Kind: sourceKindGDAL, Path: "data/ws.gpkg", Layer: "ws_line"}, src, "ST_Read with layer")
+
+	src = viewSourceFile("CREATE VIEW v AS SELECT * FROM main.tbl;")
+	testEquals(t, (*sourceFile)(nil), src, "no source file")
+}
+
+func TestGeoParquetSrid(t *testing.T) {
+	meta := `{"primary_column": "geometry", "columns": {"geometry": {"encoding": "WKB",
+		"crs": {"type": "ProjectedCRS", "name": "NZGD2000 / New Zealand Transverse Mercator 2000",
+		"base_crs": {"id": {"authority": "EPSG", "code": 4167}},
+		"id": {"authority": "EPSG", "code": 2193}}}}}`
+	srid, ok := geoParquetSrid(meta, "geometry")
+	testEquals(t, true, ok, "PROJJSON crs found")
+	testEquals(t, 2193, srid, "PROJJSON crs")
+
+	//-- unknown column falls back to primary column
+	srid, ok = geoParquetSrid(meta, "geom")
+	testEquals(t, true, ok, "primary column crs found")
+	testEquals(t, 2193, srid, "primary column crs")
+
+	//-- missing crs is OGC:CRS84
+	srid, ok = geoParquetSrid(`{"primary_column": "geom", "columns": {"geom": {"encoding": "WKB"}}}`, "geom")
+	testEquals(t, true, ok, "default crs found")
+	testEquals(t, SRID_4326, srid, "default crs")
+
+	//-- null crs is undefined
+	_, ok = geoParquetSrid(`{"primary_column": "geom", "columns": {"geom": {"crs": null}}}`, "geom")
+	testEquals(t, false, ok, "null crs")
+
+	srid, ok = geoParquetSrid(`{"primary_column": "geom", "columns": {"geom": {"crs": "EPSG:3857"}}}`, "geom")
+	testEquals(t, true, ok, "string crs found")
+	testEquals(t, 3857, srid, "string crs")
+}
+
+func TestResolveSridFallback(t *testing.T) {
+	originalConfig := conf.Configuration
+	defer func() {
+		conf.Configuration = originalConfig
+	}()
+
+	conf.Configuration = conf.Config{
+		Database: conf.Database{DefaultSrid: 3857},
+		Collections: map[string]conf.Collection{
+			"db.main.parcels": {Srid: 2193},
+		},
+	}
+	testEquals(t, 2193, resolveSrid(nil, "db.main.Parcels", "geom", nil), "collection override")
+	testEquals(t, 3857, resolveSrid(nil, "db.main.roads", "geom", nil), "configured default")
+
+	conf.Configuration.Database.DefaultSrid = 0
+	testEquals(t, SRID_4326, resolveSrid(nil, "db.main.roads", "geom", nil), "built-in default")
+}
+
+func TestReadGeoParquetSrid(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	srid, ok := readGeoParquetSrid(db, "../../jojodata/ws_point.parquet", "geometry")
+	testEquals(t, true, ok, "GeoParquet crs found")
+	testEquals(t, SRID_4326, srid, "GeoParquet crs")
+
+	_, ok = readGeoParquetSrid(db, "../../jojodata/missing.parquet", "geometry")
+	testEquals(t, false, ok, "missing file")
+}
+
+func TestScanTableGeometrySrids(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "parcels.parquet")
+	geo := `{"primary_column": "geom", "columns": {"geom": {"encoding": "WKB"}, "centroid": {"encoding": "WKB", "crs": "EPSG:2193"}}}`
+	for _, stmt := range []string{
+		"COPY (SELECT 1 AS id, ''::BLOB AS geom, ''::BLOB AS centroid) TO " + quoteLiteral(path) +
+			" (FORMAT parquet, KV_METADATA {geo: " + quoteLiteral(geo) + "})",
+		"CREATE VIEW parcels AS SELECT * FROM read_parquet(" + quoteLiteral(path) + ")",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the spatial extension may not be available, so use BLOB as the geometry type
+	rows, err := db.Query(strings.ReplaceAll(sqlTables, "'GEOMETRY'", "'BLOB'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	testEquals(t, true, rows.Next(), "table listed")
+	tbl, err := scanTable(db, rows)
+	testEquals(t, nil, err, "scan error")
+	testEquals(t, map[string]int{"geom": SRID_4326, "centroid": 2193}, tbl.GeometrySrids, "geometry column SRIDs")
+	testEquals(t, SRID_4326, tbl.Srid, "primary geometry SRID")
+}
@@ -0,0 +1,82 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+// IsTemporalType tests whether a DuckDB type is a date or timestamp
+func IsTemporalType(dbType string) bool {
+	typ := strings.ToUpper(dbType)
+	return typ == "DATE" || strings.HasPrefix(typ, "TIMESTAMP")
+}
+
+// isDateType tests whether a DuckDB type is a date without a time
+func isDateType(dbType string) bool {
+	return strings.ToUpper(dbType) == "DATE"
+}
+
+// isTimeZoneType tests whether a DuckDB type is a timestamp with time zone
+func isTimeZoneType(dbType string) bool {
+	typ := strings.ToUpper(dbType)
+	return typ == "TIMESTAMPTZ" || typ == "TIMESTAMP WITH TIME ZONE"
+}
+
+// resolveTemporalColumns determines the columns holding the time of features.
+// The configured columns are used if present,
+// otherwise the first date or timestamp column is used.
+// The end column is empty unless features have a time interval
+func resolveTemporalColumns(id string, columns []string, dbTypes map[string]string) (string, string) {
+	if coll, ok := conf.Configuration.CollectionConfig(id); ok && coll.TemporalColumn != "" {
+		if !IsTemporalType(dbTypes[coll.TemporalColumn]) {
+			log.Warnf("Configured temporal column %s is not a date or timestamp column of %s", coll.TemporalColumn, id)
+			return "", ""
+		}
+		endCol := coll.TemporalEndColumn
+		if endCol != "" && !IsTemporalType(dbTypes[endCol]) {
+			log.Warnf("Configured temporal end column %s is not a date or timestamp column of %s", endCol, id)
+			endCol = ""
+		}
+		return coll.TemporalColumn, endCol
+	}
+	for _, col := range columns {
+		if IsTemporalType(dbTypes[col]) {
+			return col, ""
+		}
+	}
+	return "", ""
+}
+
+// loadTemporalExtent reads the time interval spanned by the features of a table
+func loadTemporalExtent(db *sql.DB, tbl *Table) *TimeInterval {
+	var start, end sql.NullTime
+	err := db.QueryRow(sqlTemporalExtent(tbl)).Scan(&start, &end)
+	if err != nil {
+		log.Debugf("Error reading temporal extent of %s: %v", tbl.ID, err)
+		return nil
+	}
+	extent := &TimeInterval{}
+	if start.Valid {
+		extent.Start = &start.Time
+	}
+	if end.Valid {
+		extent.End = &end.Time
+	}
+	return extent
+}
@@ -0,0 +1,127 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+func TestResolveTemporalColumns(t *testing.T) {
+	cols := []string{"name", "observed", "valid_from", "valid_to"}
+	types := map[string]string{"name": "VARCHAR", "observed": "TIMESTAMP WITH TIME ZONE",
+		"valid_from": "DATE", "valid_to": "DATE"}
+
+	start, end := resolveTemporalColumns("memory.main.obs", cols, types)
+	testEquals(t, "observed", start, "first temporal column")
+	testEquals(t, "", end, "no end column")
+
+	start, _ = resolveTemporalColumns("memory.main.obs", []string{"name"}, types)
+	testEquals(t, "", start, "no temporal column")
+
+	saved := conf.Configuration.Collections
+	defer func() { conf.Configuration.Collections = saved }()
+	conf.Configuration.Collections = map[string]conf.Collection{
+		"memory.main.obs": {TemporalColumn: "valid_from", TemporalEndColumn: "valid_to"},
+		"memory.main.bad": {TemporalColumn: "name"},
+	}
+	start, end = resolveTemporalColumns("memory.main.obs", cols, types)
+	testEquals(t, "valid_from", start, "configured start column")
+	testEquals(t, "valid_to", end, "configured end column")
+
+	start, _ = resolveTemporalColumns("memory.main.bad", cols, types)
+	testEquals(t, "", start, "configured column is not temporal")
+}
+
+func TestSqlDatetimeFilter(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2020, 6, 30, 12, 0, 0, 0, time.UTC)
+	tbl := &Table{TemporalColumn: "t", DbTypes: map[string]string{"t": "TIMESTAMP"}}
+
+	sql, vals := sqlDatetimeFilter(tbl, &TimeInterval{Start: &t1, End: &t1}, 1)
+	testEquals(t, `"t" = $1::TIMESTAMP`, sql, "instant")
+	testEquals(t, []interface{}{"2020-01-01 00:00:00"}, vals, "instant value")
+
+	sql, vals = sqlDatetimeFilter(tbl, &TimeInterval{Start: &t1, End: &t2}, 3)
+	testEquals(t, `"t" <= $3::TIMESTAMP AND "t" >= $4::TIMESTAMP`, sql, "interval")
+	testEquals(t, []interface{}{"2020-06-30 12:00:00", "2020-01-01 00:00:00"}, vals, "interval values")
+
+	sql, _ = sqlDatetimeFilter(tbl, &TimeInterval{End: &t2}, 1)
+	testEquals(t, `"t" <= $1::TIMESTAMP`, sql, "open start")
+
+	tbl = &Table{TemporalColumn: "s", TemporalEndColumn: "e", DbTypes: map[string]string{"s": "TIMESTAMPTZ", "e": "TIMESTAMPTZ"}}
+	sql, vals = sqlDatetimeFilter(tbl, &TimeInterval{Start: &t1, End: &t1}, 1)
+	testEquals(t, `"s" <= $1::TIMESTAMPTZ AND "e" >= $2::TIMESTAMPTZ`, sql, "instant in interval")
+	testEquals(t, "2020-01-01 00:00:00+00", vals[0], "time zone value")
+
+	tbl = &Table{TemporalColumn: "d", DbTypes: map[string]string{"d": "DATE"}}
+	sql, vals = sqlDatetimeFilter(tbl, &TimeInterval{Start: &t2, End: &t2}, 1)
+	testEquals(t, `"d" = $1::DATE`, sql, "instant on date")
+	testEquals(t, []interface{}{"2020-06-30"}, vals, "date value")
+
+	sql, _ = sqlDatetimeFilter(&Table{}, &TimeInterval{Start: &t1, End: &t1}, 1)
+	testEquals(t, "", sql, "no temporal column")
+}
+
+func TestDatetimeQuery(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"SET TimeZone = 'Pacific/Auckland'",
+		`CREATE TABLE obs (id INTEGER, d DATE, ts TIMESTAMP, tz TIMESTAMPTZ)`,
+		`INSERT INTO obs VALUES
+			(1, '2020-01-01', '2020-01-01 10:00:00', '2020-01-01 10:00:00+00'),
+			(2, '2020-03-01', '2020-03-01 00:00:00', '2020-03-01 00:00:00+00'),
+			(3, '2020-06-30', '2020-06-30 23:00:00', '2020-06-30 23:00:00+00')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	types := map[string]string{"d": "DATE", "ts": "TIMESTAMP", "tz": "TIMESTAMP WITH TIME ZONE"}
+	countRows := func(col string, dt *TimeInterval) int {
+		tbl := &Table{TemporalColumn: col, DbTypes: types}
+		where, vals := sqlDatetimeFilter(tbl, dt, 1)
+		var count int
+		if err := db.QueryRow("SELECT count(*) FROM obs"+sqlWhere(where), vals...).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	jan1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	jan1End := jan1.Add(24*time.Hour - time.Microsecond)
+	mar1 := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	ts := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for _, col := range []string{"d", "ts", "tz"} {
+		testEquals(t, 1, countRows(col, &TimeInterval{Start: &jan1, End: &jan1End}), "day of "+col)
+		testEquals(t, 2, countRows(col, &TimeInterval{Start: &jan1, End: &mar1}), "interval of "+col)
+		testEquals(t, 2, countRows(col, &TimeInterval{End: &mar1}), "open start of "+col)
+	}
+	testEquals(t, 1, countRows("ts", &TimeInterval{Start: &ts, End: &ts}), "instant of TIMESTAMP")
+	testEquals(t, 1, countRows("tz", &TimeInterval{Start: &ts, End: &ts}), "instant of TIMESTAMPTZ")
+	testEquals(t, 1, countRows("d", &TimeInterval{Start: &ts, End: &ts}), "instant of DATE")
+	testEquals(t, 2, countRows("d", &TimeInterval{Start: &ts, End: &mar1}), "interval starting during day of DATE")
+	testEquals(t, 2, countRows("ts", &TimeInterval{Start: &ts, End: &mar1}), "interval starting at TIMESTAMP")
+
+	extent := loadTemporalExtent(db, &Table{ID: "obs", Table: "obs", TemporalColumn: "d"})
+	testEquals(t, "2020-01-01", extent.Start.Format(time.DateOnly), "extent start")
+	testEquals(t, "2020-06-30", extent.End.Format(time.DateOnly), "extent end")
+}
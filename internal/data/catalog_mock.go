@@ -16,7 +16,10 @@ package data
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -49,20 +52,34 @@ func newCatalogMock() CatalogMock {
 	jtypes := []string{"string", "number", "string", "number"}
 	colDesc := []string{"Property A", "Property B", "Property C", "Property D"}
 
+	mockTimeStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
 	layerA := &Table{
 		ID:          "mock_a",
 		Title:       "Mock A",
 		Description: "This dataset contains mock data about A (9 points)",
 		Extent:      Extent{Minx: -120, Miny: 40, Maxx: -74, Maxy: 50},
 		Srid:        4326,
-		Columns:     propNames,
-		DbTypes:     types,
-		JSONTypes:   jtypes,
-		ColDesc:     colDesc,
+		// a second geometry column, to allow selecting the geometry column
+		GeometryColumn:  "geom",
+		GeometryColumns: []string{"geom", "centroid"},
+		GeometryType:    "Point",
+		Keywords:        []string{"mock", "points"},
+		TemporalExtent:  &TimeInterval{Start: &mockTimeStart},
+		License:         "CC-BY-4.0",
+		Attribution:     "Mock Data Inc.",
+		Links: []Link{
+			{Href: "http://example.com/mock_a", Rel: "describedby", Type: "text/html", Title: "About Mock A"},
+		},
+		Columns:   propNames,
+		DbTypes:   types,
+		JSONTypes: jtypes,
+		ColDesc:   colDesc,
 	}
 
+	// mock B has a feature ID column, so it is paged with cursors
 	layerB := &Table{
 		ID:          "mock_b",
+		IDColumn:    "id",
 		Title:       "Mock B",
 		Description: "This dataset contains mock data about B (100 points)",
 		Extent:      Extent{Minx: -75, Miny: 45, Maxx: -74, Maxy: 46},
@@ -187,10 +204,6 @@ func (cat *CatalogMock) Tables() ([]*Table, error) {
 	return cat.TableDefs, nil
 }
 
-func (cat *CatalogMock) TableReload(name string) {
-	// no-op for mock data
-}
-
 func (cat *CatalogMock) TableByName(name string) (*Table, error) {
 	for _, lyr := range cat.TableDefs {
 		if lyr.ID == name {
@@ -201,20 +214,37 @@ func (cat *CatalogMock) TableByName(name string) (*Table, error) {
 	return nil, nil
 }
 
-func (cat *CatalogMock) TableFeatures(ctx context.Context, name string, param *QueryParam) ([]string, error) {
+func (cat *CatalogMock) TableFeatures(ctx context.Context, name string, param *QueryParam) ([]string, *Cursor, error) {
 	features, ok := cat.tableData[name]
 	if !ok {
 		// table not found - indicated by nil value returned
-		return nil, nil
+		return nil, nil, nil
 	}
 	featFilt := doFilter(features, param.Filter)
+	// features are in ID order, and sorting is ignored
+	featFilt = doCursor(featFilt, param.Cursor)
 	featuresLim := doLimit(featFilt, param.Limit, param.Offset)
 	// handle empty property list
 	propNames := cat.TableDefs[0].Columns
 	if len(param.Columns) > 0 {
 		propNames = param.Columns
 	}
-	return featuresToJSON(featuresLim, propNames), nil
+	var next *Cursor
+	tbl, _ := cat.TableByName(name)
+	if IsKeysetPaging(tbl, param) && len(featuresLim) > 0 {
+		keys := make([]interface{}, len(param.SortBy)+1)
+		keys[len(param.SortBy)] = featuresLim[len(featuresLim)-1].ID
+		next = NewCursor(param.SortBy, keys)
+	}
+	return featuresToJSON(featuresLim, propNames), next, nil
+}
+
+func (cat *CatalogMock) TableFeatureCount(ctx context.Context, name string, param *QueryParam) (int64, error) {
+	features, ok := cat.tableData[name]
+	if !ok {
+		return -1, nil
+	}
+	return int64(len(doFilter(features, param.Filter))), nil
 }
 
 func (cat *CatalogMock) TableFeature(ctx context.Context, name string, id string, param *QueryParam) (string, error) {
@@ -354,14 +384,70 @@ func doFilter(features []*featureMock, filter []*PropertyFilter) []*featureMock
 func isFilterMatches(feature *featureMock, filter []*PropertyFilter) bool {
 	for _, cond := range filter {
 		val, _ := feature.getProperty(cond.Name)
-		valStr := fmt.Sprintf("%v", val)
-		if cond.Value != valStr {
+		if !isCondMatches(cond, fmt.Sprintf("%v", val)) {
 			return false
 		}
 	}
 	return true
 }
 
+// isCondMatches tests whether a mock property value satisfies a filter condition.
+// Mock property values are never null
+func isCondMatches(cond *PropertyFilter, valStr string) bool {
+	switch cond.Op {
+	case FilterOpIsNull:
+		return false
+	case FilterOpNotNull:
+		return true
+	case FilterOpIn:
+		for _, condVal := range cond.Values {
+			if condVal == valStr {
+				return true
+			}
+		}
+		return false
+	case FilterOpRange:
+		return (cond.Values[0] == "" || compareMock(valStr, cond.Values[0]) >= 0) &&
+			(cond.Values[1] == "" || compareMock(valStr, cond.Values[1]) <= 0)
+	case FilterOpLike:
+		pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(cond.Value), regexp.QuoteMeta(FilterWildcard), ".*") + "$"
+		isMatch, _ := regexp.MatchString(pattern, valStr)
+		return isMatch
+	}
+	return cond.Value == valStr
+}
+
+// compareMock compares mock property values, as numbers if they are numeric
+func compareMock(a string, b string) int {
+	numA, errA := strconv.ParseFloat(a, 64)
+	numB, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case numA < numB:
+		return -1
+	case numA > numB:
+		return 1
+	}
+	return 0
+}
+
+// doCursor provides the features after the cursor feature ID
+func doCursor(features []*featureMock, cursor *Cursor) []*featureMock {
+	if cursor == nil {
+		return features
+	}
+	lastID, _ := strconv.Atoi(*cursor.Keys[len(cursor.Keys)-1])
+	var result []*featureMock
+	for _, feat := range features {
+		if id, _ := strconv.Atoi(feat.ID); id > lastID {
+			result = append(result, feat)
+		}
+	}
+	return result
+}
+
 func doLimit(features []*featureMock, limit int, offset int) []*featureMock {
 	start := 0
 	end := len(features)
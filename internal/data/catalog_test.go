@@ -14,8 +14,16 @@ package data
 */
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/marcboeker/go-duckdb/v2"
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
 )
 
 // TestTableIncludeExcludeLogic tests the table filtering logic
@@ -168,7 +176,43 @@ func TestTableIncludeExcludeLogic(t *testing.T) {
 			},
 			includes:    []string{"main.users"},
 			excludes:    []string{},
-			shouldMatch: false, // Should not match because table ID is "users", not "main.users"
+			shouldMatch: true, // schema-qualified table name matches
+		},
+		{
+			name: "Schema-qualified table in includes, fully qualified table ID",
+			table: &Table{
+				ID:      "db.reports.monthly",
+				Catalog: "db",
+				Schema:  "reports",
+				Table:   "monthly",
+			},
+			includes:    []string{"reports.monthly"},
+			excludes:    []string{},
+			shouldMatch: true,
+		},
+		{
+			name: "Catalog-qualified schema in excludes",
+			table: &Table{
+				ID:      "other.main.users",
+				Catalog: "other",
+				Schema:  "main",
+				Table:   "users",
+			},
+			includes:    []string{},
+			excludes:    []string{"other.main"},
+			shouldMatch: false,
+		},
+		{
+			name: "Same table name in another catalog is not matched",
+			table: &Table{
+				ID:      "db.main.users",
+				Catalog: "db",
+				Schema:  "main",
+				Table:   "users",
+			},
+			includes:    []string{"other.main.users"},
+			excludes:    []string{},
+			shouldMatch: false,
 		},
 	}
 
@@ -609,3 +653,404 @@ func TestTableExcludesOnlyScenarios(t *testing.T) {
 		})
 	}
 }
+
+// TestResolveIDColumn tests the ID column is found from key constraints, config or rowid
+func TestResolveIDColumn(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{
+		"CREATE TABLE with_pk (code VARCHAR UNIQUE, fid INTEGER PRIMARY KEY, name VARCHAR)",
+		"CREATE TABLE with_unique (a INTEGER, b INTEGER, code VARCHAR UNIQUE, UNIQUE (a, b))",
+		"CREATE TABLE no_key (name VARCHAR, parcel_id INTEGER)",
+		"CREATE VIEW no_key_view AS SELECT * FROM no_key",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := conf.Configuration.Collections
+	defer func() { conf.Configuration.Collections = saved }()
+	conf.Configuration.Collections = map[string]conf.Collection{
+		"memory.main.no_key_view": {IdColumn: "parcel_id"},
+	}
+	cols := []string{"name", "parcel_id"}
+
+	testEquals(t, "fid", resolveIDColumn(db, "memory.main.with_pk", "memory", "main", "with_pk", false, nil), "primary key")
+	testEquals(t, "code", resolveIDColumn(db, "memory.main.with_unique", "memory", "main", "with_unique", false, nil), "single-column unique")
+	testEquals(t, RowIDColumn, resolveIDColumn(db, "memory.main.no_key", "memory", "main", "no_key", false, cols), "table rowid")
+	testEquals(t, "parcel_id", resolveIDColumn(db, "memory.main.no_key_view", "memory", "main", "no_key_view", true, cols), "configured column")
+	testEquals(t, "", resolveIDColumn(db, "memory.main.other_view", "memory", "main", "other_view", true, cols), "view without key")
+
+	conf.Configuration.Collections["memory.main.no_key_view"] = conf.Collection{IdColumn: "missing"}
+	testEquals(t, "", resolveIDColumn(db, "memory.main.no_key_view", "memory", "main", "no_key_view", true, cols), "configured column not in view")
+}
+
+func TestFeatureIDIndex(t *testing.T) {
+	tbl := &Table{IDColumn: "fid"}
+	testEquals(t, 2, featureIDIndex(tbl, []string{"name", "fid"}, false), "ID selected after properties")
+	testEquals(t, 1, featureIDIndex(tbl, []string{"name", "fid"}, true), "ID from grouped properties")
+	testEquals(t, -1, featureIDIndex(tbl, []string{"name"}, true), "no ID for groups")
+	testEquals(t, -1, featureIDIndex(&Table{}, []string{"name"}, false), "no ID column")
+}
+
+func TestApplyCollectionConfig(t *testing.T) {
+	saved := conf.Configuration.Collections
+	defer func() { conf.Configuration.Collections = saved }()
+	conf.Configuration.Collections = map[string]conf.Collection{
+		"db.main.parcels": {
+			Title:    "Land Parcels",
+			Keywords: []string{"cadastre"},
+			Links:    []conf.CollectionLink{{Href: "https://example.com/parcels", Rel: "license"}},
+			Columns:  map[string]string{"appellation": "Legal description"},
+		},
+		"db.main.roads": {Queryables: []string{"name", "GEOM", "nosuch"}},
+	}
+
+	tbl := &Table{
+		ID:          "db.main.Parcels",
+		Title:       "db.main.Parcels",
+		Description: "Data for table db.main.Parcels",
+		Columns:     []string{"Appellation", "area"},
+		ColDesc:     []string{"Column Appellation", "Column area"},
+	}
+	applyCollectionConfig(tbl)
+	testEquals(t, "Land Parcels", tbl.Title, "configured title")
+	testEquals(t, "Data for table db.main.Parcels", tbl.Description, "description not configured")
+	testEquals(t, []string{"cadastre"}, tbl.Keywords, "keywords")
+	testEquals(t, []Link{{Href: "https://example.com/parcels", Rel: "license"}}, tbl.Links, "links")
+	testEquals(t, []string{"Legal description", "Column area"}, tbl.ColDesc, "column descriptions")
+	testEquals(t, []string{"Appellation", "area"}, tbl.QueryableNames(), "all columns are queryable")
+
+	tbl = &Table{ID: "db.main.roads", GeometryColumn: "geom", Columns: []string{"name", "lanes"}, ColDesc: []string{"", ""}}
+	applyCollectionConfig(tbl)
+	testEquals(t, []string{"geom", "name"}, tbl.QueryableNames(), "configured queryables")
+}
+
+// TestCatalogComments tests that table and column comments are used as descriptions
+func TestCatalogComments(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{
+		"CREATE TABLE parcels (id INTEGER, name VARCHAR, geom BLOB)",
+		"COMMENT ON TABLE parcels IS 'Land parcels'",
+		"COMMENT ON COLUMN parcels.name IS 'Parcel name'",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the spatial extension may not be available, so use BLOB as the geometry type
+	var description string
+	sqlBlobTables := strings.ReplaceAll(sqlTables, "'GEOMETRY'", "'BLOB'")
+	err = db.QueryRow("SELECT description FROM (" + sqlBlobTables + ") WHERE id = 'memory.main.parcels'").Scan(&description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEquals(t, "Land parcels", description, "table comment")
+
+	columns, _, _, colDesc, err := getTableColumns(db, "memory", "main", "parcels", "geom")
+	testEquals(t, nil, err, "columns error")
+	testEquals(t, []string{"id", "name"}, columns, "columns")
+	testEquals(t, []string{"Column id of type INTEGER", "Parcel name"}, colDesc, "column comments")
+}
+
+func TestDbConnectionSettings(t *testing.T) {
+	dir := t.TempDir()
+	dbConf := conf.Database{Threads: 2, MemoryLimit: "512MB", TempDirectory: dir}
+	connector, err := duckdb.NewConnector("", dbConnectionInit(dbConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	var threads int64
+	var tempDir string
+	err = db.QueryRow("SELECT current_setting('threads'), current_setting('temp_directory')").Scan(&threads, &tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEquals(t, int64(2), threads, "threads")
+	testEquals(t, dir, tempDir, "temp directory")
+}
+
+func TestDbReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ro.duckdb")
+	db, err := sql.Open("duckdb", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE parcels (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	testEquals(t, "", dbDSN(conf.Database{ReadOnly: true}), "in-memory database is not read-only")
+	dsn := dbDSN(conf.Database{DatabasePath: path, ReadOnly: true})
+	db, err = sql.Open("duckdb", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	testEquals(t, nil, db.QueryRow("SELECT count(*) FROM parcels").Scan(&count), "read allowed")
+	_, err = db.Exec("INSERT INTO parcels VALUES (1)")
+	testEquals(t, true, err != nil, "write rejected")
+}
+
+func TestToJSONTypeFromDuckDB(t *testing.T) {
+	tests := []struct {
+		dbType   string
+		jsonType string
+		format   string
+	}{
+		{"INTEGER", JSONTypeInteger, ""},
+		{"HUGEINT", JSONTypeInteger, ""},
+		{"DECIMAL(10,2)", JSONTypeNumber, ""},
+		{"DOUBLE", JSONTypeNumber, ""},
+		{"BOOLEAN", JSONTypeBoolean, ""},
+		{"VARCHAR", JSONTypeString, ""},
+		{"DATE", JSONTypeString, JSONFormatDate},
+		{"TIMESTAMP", JSONTypeString, JSONFormatDateTime},
+		{"TIMESTAMP WITH TIME ZONE", JSONTypeString, JSONFormatDateTime},
+		{"TIME", JSONTypeString, JSONFormatTime},
+		{"UUID", JSONTypeString, JSONFormatUUID},
+		{"INTERVAL", JSONTypeString, JSONFormatDuration},
+		{"BLOB", JSONTypeString, JSONFormatByte},
+		{"ENUM('a', 'b')", JSONTypeString, ""},
+		{"JSON", JSONTypeJSON, ""},
+		{"STRUCT(x INTEGER, y VARCHAR)", JSONTypeObject, ""},
+		{"MAP(VARCHAR, INTEGER)", JSONTypeObject, ""},
+		{"INTEGER[]", "integer[]", ""},
+		{"INTEGER[3]", "integer[]", ""},
+		{"DATE[][]", "string[][]", JSONFormatDate},
+		{"STRUCT(a INTEGER[])[]", "object[]", ""},
+	}
+	for _, tt := range tests {
+		testEquals(t, tt.jsonType, toJSONTypeFromDuckDB(tt.dbType), "JSON type of "+tt.dbType)
+		testEquals(t, tt.format, toJSONFormatFromDuckDB(tt.dbType), "JSON format of "+tt.dbType)
+	}
+}
+
+func TestFeatureJSONTypes(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE typed (i INTEGER, h HUGEINT, d DECIMAL(20,3), f DOUBLE, dt DATE, ts TIMESTAMP,
+			tz TIMESTAMPTZ, tm TIME, u UUID, b BLOB, iv INTERVAL, e ENUM('low', 'high'), j JSON,
+			l INTEGER[], a DOUBLE[2], s STRUCT(x INTEGER, d DATE), m MAP(INTEGER, VARCHAR))`,
+		`INSERT INTO typed VALUES (1, 123456789012345678901234, 12345678901234567.125, 'NaN', '2020-01-31',
+			'2020-01-31 10:20:30.5', '2020-01-31 10:20:30+02', '10:20:30', '6ba7b810-9dad-11d1-80b4-00c04fd430c8',
+			'\xAA\xBB'::BLOB, INTERVAL '1 month 2 days 3.5 seconds', 'high', '{"k": [1, 2]}',
+			[1, 2], [1.5, 2.5], {'x': 1, 'd': '2020-01-31'}, MAP {1: 'one'})`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cols, dbTypes, _, _, _ := getTableColumns(db, "memory", "main", "typed", "")
+	query := "SELECT NULL" + sqlColList(cols, dbTypes, nil, CRS84, true) + " FROM typed"
+	features, err := readFeaturesWithArgs(context.Background(), db, query, nil, -1, cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feature struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(features[0]), &feature); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"i":  `1`,
+		"h":  `123456789012345678901234`,
+		"d":  `12345678901234567.125`,
+		"f":  `null`,
+		"dt": `"2020-01-31"`,
+		"ts": `"2020-01-31T10:20:30.5Z"`,
+		"tz": `"2020-01-31T08:20:30Z"`,
+		"tm": `"10:20:30"`,
+		"u":  `"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`,
+		"b":  `"qrs="`,
+		"iv": `"P1M2DT3.5S"`,
+		"e":  `"high"`,
+		"j":  `{"k":[1,2]}`,
+		"l":  `[1,2]`,
+		"a":  `[1.5,2.5]`,
+		"s":  `{"d":"2020-01-31T00:00:00Z","x":1}`,
+		"m":  `{"1":"one"}`,
+	}
+	for col, val := range expected {
+		testEquals(t, val, string(feature.Properties[col]), "JSON value of "+col)
+	}
+}
+
+func TestTableFeatureCount(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE pts AS SELECT i AS id, (i % 4)::VARCHAR AS cat FROM range(100000) r(i)"); err != nil {
+		t.Fatal(err)
+	}
+	saved := conf.Configuration
+	defer func() { conf.Configuration = saved }()
+	conf.Configuration.Paging.NumberMatched = conf.NumberMatchedExact
+	conf.Configuration.Collections = map[string]conf.Collection{
+		"memory.main.pts": {NumberMatched: conf.NumberMatchedEstimated},
+	}
+
+	cat := &catalogDB{dbconn: db}
+	tbl := &Table{ID: "memory.main.pts", Catalog: "memory", Schema: "main", Table: "pts", IDColumn: "id"}
+	tableMap := map[string]*Table{tbl.ID: tbl}
+	cat.snapshot.Store(&catalogSnapshot{tables: tablesSorted(tableMap), tableMap: tableMap})
+	ctx := context.Background()
+	param := &QueryParam{Limit: 10, Precision: -1}
+
+	count, err := cat.TableFeatureCount(ctx, tbl.ID, param)
+	testEquals(t, nil, err, "count error")
+	testEquals(t, int64(100000), count, "unfiltered count is exact")
+
+	param.Filter = []*PropertyFilter{{Name: "cat", Value: "1"}}
+	count, _ = cat.TableFeatureCount(ctx, tbl.ID, param)
+	testEquals(t, true, count > 15000 && count < 35000, fmt.Sprintf("estimated count %d", count))
+
+	conf.Configuration.Collections = nil
+	count, _ = cat.TableFeatureCount(ctx, tbl.ID, param)
+	testEquals(t, int64(25000), count, "exact count")
+
+	param.GroupBy = []string{"cat"}
+	count, _ = cat.TableFeatureCount(ctx, tbl.ID, param)
+	testEquals(t, int64(1), count, "group count")
+
+	conf.Configuration.Paging.NumberMatched = conf.NumberMatchedNone
+	count, _ = cat.TableFeatureCount(ctx, tbl.ID, param)
+	testEquals(t, int64(-1), count, "count disabled")
+}
+
+func TestTableFeaturesCursor(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		// the spatial extension is not available in tests
+		"CREATE MACRO ST_AsGeoJSON(g) AS g",
+		"CREATE TABLE pts (id INTEGER PRIMARY KEY, geom VARCHAR, grp VARCHAR, t TIMESTAMP)",
+		`INSERT INTO pts SELECT i, NULL, CASE WHEN i % 4 = 0 THEN NULL ELSE (i % 3)::VARCHAR END,
+			TIMESTAMP '2020-01-01' + to_microseconds(i % 5) FROM range(23) r(i)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cat := &catalogDB{dbconn: db}
+	tbl := &Table{ID: "memory.main.pts", Catalog: "memory", Schema: "main", Table: "pts",
+		GeometryColumn: "geom", IDColumn: "id", Columns: []string{"grp", "t"},
+		DbTypes: map[string]string{"id": "INTEGER", "grp": "VARCHAR", "t": "TIMESTAMP"}}
+	tableMap := map[string]*Table{tbl.ID: tbl}
+	cat.snapshot.Store(&catalogSnapshot{tables: tablesSorted(tableMap), tableMap: tableMap})
+
+	readIDs := func(param *QueryParam) []string {
+		var ids []string
+		for page := 0; page < 20; page++ {
+			features, next, err := cat.TableFeatures(context.Background(), tbl.ID, param)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, feature := range features {
+				var doc struct {
+					ID string `json:"id"`
+				}
+				json.Unmarshal([]byte(feature), &doc)
+				ids = append(ids, doc.ID)
+			}
+			if len(features) < param.Limit {
+				return ids
+			}
+			// the cursor is passed through a request
+			param.Cursor, err = ParseCursor(next.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return ids
+	}
+	for _, sortBy := range [][]Sorting{nil, {{Name: "grp"}}, {{Name: "grp", IsDesc: true}}, {{Name: "t", IsDesc: true}},
+		{{Name: "grp", IsDesc: true}, {Name: "t"}}} {
+		all := readIDs(&QueryParam{Limit: 100, Precision: -1, Columns: tbl.Columns, SortBy: sortBy})
+		testEquals(t, 23, len(all), "all features")
+		paged := readIDs(&QueryParam{Limit: 4, Precision: -1, Columns: tbl.Columns, SortBy: sortBy})
+		testEquals(t, all, paged, fmt.Sprintf("features paged by cursor sorted by %v", sortBy))
+	}
+}
+
+func TestTableFeaturesGrouped(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		// the spatial extension is not available in tests
+		"CREATE MACRO ST_AsGeoJSON(g) AS g",
+		"CREATE MACRO ST_Collect(g) AS len(g)::VARCHAR",
+		"CREATE TABLE pts (id INTEGER PRIMARY KEY, geom VARCHAR, state VARCHAR, county VARCHAR, pop INTEGER)",
+		`INSERT INTO pts VALUES (1, 'a', 'NY', 'Kings', 10), (2, 'b', 'NY', 'Kings', 20),
+			(3, 'c', 'NY', 'Queens', 5), (4, 'd', 'CA', 'Marin', 7)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cat := &catalogDB{dbconn: db}
+	tbl := &Table{ID: "memory.main.pts", Catalog: "memory", Schema: "main", Table: "pts",
+		GeometryColumn: "geom", IDColumn: "id", Columns: []string{"state", "county", "pop"},
+		DbTypes: map[string]string{"id": "INTEGER", "state": "VARCHAR", "county": "VARCHAR", "pop": "INTEGER"}}
+	tableMap := map[string]*Table{tbl.ID: tbl}
+	cat.snapshot.Store(&catalogSnapshot{tables: tablesSorted(tableMap), tableMap: tableMap})
+
+	type groupFeature struct {
+		ID    string                 `json:"id"`
+		Geom  int                    `json:"geometry"`
+		Props map[string]interface{} `json:"properties"`
+	}
+	readGroups := func(param *QueryParam) []groupFeature {
+		features, _, err := cat.TableFeatures(context.Background(), tbl.ID, param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups := make([]groupFeature, len(features))
+		for i, feature := range features {
+			json.Unmarshal([]byte(feature), &groups[i])
+		}
+		return groups
+	}
+	aggs := []Aggregate{{Function: AggregateCount, Column: AggregateAll}, {Function: AggregateSum, Column: "pop"}}
+	groups := readGroups(&QueryParam{Limit: 10, Precision: -1, Columns: []string{"state", "county"},
+		GroupBy: []string{"state", "county"}, Aggregates: aggs, SortBy: []Sorting{{Name: "sum_pop", IsDesc: true}}})
+	testEquals(t, 3, len(groups), "one feature per group")
+	testEquals(t, "", groups[0].ID, "groups have no ID")
+	testEquals(t, 2, groups[0].Geom, "group geometries collected")
+	testEquals(t, map[string]interface{}{"state": "NY", "county": "Kings", "count": float64(2), "sum_pop": float64(30)},
+		groups[0].Props, "group properties")
+
+	groups = readGroups(&QueryParam{Limit: 10, Precision: -1, Columns: []string{}, GroupBy: []string{},
+		Aggregates: []Aggregate{{Function: AggregateMax, Column: "county"}}})
+	testEquals(t, 1, len(groups), "all features in one group")
+	testEquals(t, map[string]interface{}{"max_county": "Queens"}, groups[0].Props, "aggregate of all features")
+}
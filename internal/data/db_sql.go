@@ -2,10 +2,11 @@ package data
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
 )
 
 /*
@@ -23,48 +24,224 @@ import (
 
 const forceTextTSVECTOR = "tsvector"
 
+// sqlTables discovers tables and views with geometry columns in every attached
+// catalog and schema.  Collection IDs are fully qualified as catalog.schema.table
+// The geometry columns are listed in column order; the first is the primary geometry.
+// The SRID is resolved separately, so is returned as 0 (unknown).
+// The view definition is returned to allow detecting the view source files.
+// The ID column is resolved separately, since views have no constraints or rowid.
+// The description is the table or view comment, if any.
 const sqlTables = `
+WITH rels AS (
+    SELECT database_name, schema_name, table_name, comment, FALSE AS is_view, '' AS source_sql
+    FROM duckdb_tables()
+    WHERE NOT internal
+    UNION ALL
+    SELECT database_name, schema_name, view_name AS table_name, comment, TRUE AS is_view, sql AS source_sql
+    FROM duckdb_views()
+    WHERE NOT internal
+)
 SELECT 
-    table_name AS id,
-    'main' AS schema,
-    table_name AS table,
-    '' AS description,
-    column_name AS geometry_column,
-    4326 AS srid,
+    r.database_name || '.' || r.schema_name || '.' || r.table_name AS id,
+    r.database_name AS catalog,
+    r.schema_name AS schema,
+    r.table_name AS table,
+    COALESCE(r.comment, '') AS description,
+    list(c.column_name ORDER BY c.column_index) AS geometry_columns,
+    0 AS srid,
     'GEOMETRY' AS geometry_type,
-    '' AS id_column,
-    '[]' AS props
-FROM information_schema.columns 
-WHERE data_type = 'GEOMETRY'
-ORDER BY table_name
+    r.is_view,
+    '[]' AS props,
+    COALESCE(r.source_sql, '') AS source_sql
+FROM rels r
+JOIN duckdb_columns() c
+  ON c.database_name = r.database_name
+ AND c.schema_name = r.schema_name
+ AND c.table_name = r.table_name
+WHERE c.data_type = 'GEOMETRY'
+GROUP BY r.database_name, r.schema_name, r.table_name, r.comment, r.is_view, r.source_sql
+ORDER BY r.database_name, r.schema_name, r.table_name
+`
+
+// sqlCatalogSignature computes a hash of the catalog objects which are published.
+// It is cheap to compute, so is used to detect schema changes
+// (new or dropped tables, altered columns, comments, constraints and macros)
+const sqlCatalogSignature = `
+SELECT md5(concat_ws('|',
+    (SELECT string_agg(database_name || '.' || schema_name || '.' || table_name || '.' || column_name
+            || ':' || data_type || ':' || COALESCE(comment, ''), ','
+            ORDER BY database_name, schema_name, table_name, column_index)
+     FROM duckdb_columns() WHERE NOT internal),
+    (SELECT string_agg(database_name || '.' || schema_name || '.' || table_name || ':' || COALESCE(comment, ''), ','
+            ORDER BY database_name, schema_name, table_name)
+     FROM duckdb_tables() WHERE NOT internal),
+    (SELECT string_agg(database_name || '.' || schema_name || '.' || view_name || ':' || COALESCE(comment, '') || ':' || sql, ','
+            ORDER BY database_name, schema_name, view_name)
+     FROM duckdb_views() WHERE NOT internal),
+    (SELECT string_agg(database_name || '.' || schema_name || '.' || table_name || ':' || constraint_text, ','
+            ORDER BY database_name, schema_name, table_name, constraint_index)
+     FROM duckdb_constraints()),
+    (SELECT string_agg(database_name || '.' || schema_name || '.' || function_name || ':'
+            || COALESCE(macro_definition, '') || ':' || array_to_string(parameters, ','), ','
+            ORDER BY database_name, schema_name, function_name, macro_definition)
+     FROM duckdb_functions() WHERE function_type = 'table_macro' AND NOT internal)
+))
+`
+
+// sqlGeoParquetMeta reads the GeoParquet metadata of a Parquet file (or glob)
+const sqlGeoParquetMeta = `SELECT decode(value) FROM parquet_kv_metadata($1) WHERE key = 'geo' LIMIT 1`
+
+// sqlGdalGeomFields reads the geometry fields and their CRS for the layers of a GDAL source
+const sqlGdalGeomFields = `
+WITH lyr AS (
+    SELECT unnest(layers) AS l FROM ST_Read_Meta($1)
+), fld AS (
+    SELECT l.name AS layer_name, unnest(l.geometry_fields) AS g FROM lyr
+)
+SELECT layer_name, g.name, COALESCE(g.crs.auth_name::VARCHAR, ''), COALESCE(g.crs.auth_code::VARCHAR, '')
+FROM fld
+`
+
+// sqlGlobFiles lists the files matching a path or glob
+const sqlGlobFiles = `SELECT file FROM glob($1) ORDER BY file`
+
+// sqlConnectionSettings provides the statements which apply the configured
+// DuckDB resource settings. They are global to the DuckDB instance
+func sqlConnectionSettings(db conf.Database) []string {
+	var stmts []string
+	if db.Threads > 0 {
+		stmts = append(stmts, fmt.Sprintf("SET threads = %d", db.Threads))
+	}
+	if db.MemoryLimit != "" {
+		stmts = append(stmts, "SET memory_limit = "+quoteLiteral(db.MemoryLimit))
+	}
+	if db.TempDirectory != "" {
+		stmts = append(stmts, "SET temp_directory = "+quoteLiteral(db.TempDirectory))
+	}
+	return stmts
+}
+
+// sqlAttachSources attaches the in-memory catalog which holds views over data file sources.
+// It is attached read-write so that views can be created when the database is opened read-only
+const sqlAttachSources = "ATTACH IF NOT EXISTS ':memory:' AS " + SourcesCatalog + " (READ_WRITE)"
+
+// sqlFmtSourceView creates a view over a data file source
+const sqlFmtSourceView = "CREATE OR REPLACE VIEW %s AS SELECT %s FROM %s"
+
+// sqlDescribeSource describes the columns of a data file source
+func sqlDescribeSource(scan string) string {
+	return "DESCRIBE SELECT * FROM " + scan
+}
+
+// sqlSourceScan provides the table function call which reads a data file source.
+// Parquet files (or globs) are read with read_parquet, all other formats with ST_Read.
+// Hive partition keys of Parquet datasets are read as columns,
+// so filters on them prune the files read.
+// ST_Read does not accept globs, so multiple files are combined by column name
+func sqlSourceScan(paths []string, layer string, isHive bool) string {
+	if len(paths) == 1 && isParquetPath(paths[0]) {
+		if isHive {
+			return fmt.Sprintf("read_parquet(%s, hive_partitioning = true)", quoteLiteral(paths[0]))
+		}
+		return fmt.Sprintf("read_parquet(%s)", quoteLiteral(paths[0]))
+	}
+	scans := make([]string, len(paths))
+	for i, path := range paths {
+		if layer != "" {
+			scans[i] = fmt.Sprintf("ST_Read(%s, layer := %s)", quoteLiteral(path), quoteLiteral(layer))
+		} else {
+			scans[i] = fmt.Sprintf("ST_Read(%s)", quoteLiteral(path))
+		}
+	}
+	if len(scans) == 1 {
+		return scans[0]
+	}
+	return "(SELECT * FROM " + strings.Join(scans, " UNION ALL BY NAME SELECT * FROM ") + ")"
+}
+
+// sqlSourceView creates a view over a data file source.
+// WKB geometry is converted to the GEOMETRY type
+func sqlSourceView(name string, scan string, geomCol string, isWKB bool) string {
+	viewName := quoteIdent(SourcesCatalog) + ".main." + quoteIdent(name)
+	selectList := "*"
+	if isWKB {
+		selectList = fmt.Sprintf("* REPLACE (ST_GeomFromWKB(%s) AS %s)", quoteIdent(geomCol), quoteIdent(geomCol))
+	}
+	return fmt.Sprintf(sqlFmtSourceView, viewName, selectList, scan)
+}
+
+// sqlTableKeys finds the single-column primary key or unique constraint of a table.
+// A primary key is preferred over a unique constraint
+const sqlTableKeys = `
+SELECT constraint_column_names[1]
+FROM duckdb_constraints()
+WHERE database_name = ?
+  AND schema_name = ?
+  AND table_name = ?
+  AND constraint_type IN ('PRIMARY KEY', 'UNIQUE')
+  AND len(constraint_column_names) = 1
+ORDER BY CASE constraint_type WHEN 'PRIMARY KEY' THEN 0 ELSE 1 END, constraint_index
+LIMIT 1
+`
+
+// sqlTableColumns lists the columns of a table, with their comments.
+// The primary geometry column is excluded by the caller, since it is the feature geometry.
+// No rows are returned if the table does not exist
+const sqlTableColumns = `
+SELECT column_name, data_type, COALESCE(comment, '') AS comment
+FROM duckdb_columns() 
+WHERE database_name = ? 
+  AND schema_name = ? 
+  AND table_name = ? 
+ORDER BY column_index
 `
 
+// sqlFunctionsTemplate discovers the table macros in the published schemas.
+// Macro parameters are listed in order, with positional parameters first.
+// Parameter types are NULL for untyped parameters
 const sqlFunctionsTemplate = `
-SELECT 
-    'spatial.ST_Area' AS id,
-    'spatial' AS schema,
-    'ST_Area' AS function,
-    'Calculate area of geometry' AS description,
-    '["geom"]' AS input_names,
-    '["GEOMETRY"]' AS input_types,
-    '[]' AS argdefaults,
-    '["area"]' AS output_names,
-    '["DOUBLE"]' AS output_types
-UNION ALL
-SELECT 
-    'spatial.ST_AsGeoJSON' AS id,
-    'spatial' AS schema,
-    'ST_AsGeoJSON' AS function,
-    'Convert geometry to GeoJSON' AS description,
-    '["geom"]' AS input_names,
-    '["GEOMETRY"]' AS input_types,
-    '[]' AS argdefaults,
-    '["geojson"]' AS output_names,
-    '["VARCHAR"]' AS output_types
+SELECT
+    database_name AS catalog,
+    schema_name AS schema,
+    function_name AS function,
+    COALESCE(comment, description, '') AS description,
+    parameters AS input_names,
+    parameter_types AS input_types
+FROM duckdb_functions()
+WHERE function_type = 'table_macro'
+  AND NOT internal
+  AND schema_name IN (%v)
+ORDER BY schema_name, function_name
 `
 
 func sqlFunctions() string {
-	return sqlFunctionsTemplate
+	return fmt.Sprintf(sqlFunctionsTemplate, quotedList(conf.Configuration.Database.FunctionIncludes))
+}
+
+// sqlFmtDescribeFunction describes the output columns of a table macro
+const sqlFmtDescribeFunction = "DESCRIBE SELECT * FROM %s( %s )"
+
+// sqlDescribeFunction describes a table macro called with the given number
+// of positional arguments, all NULL
+func sqlDescribeFunction(fn *Function, numPositional int) string {
+	args := make([]string, numPositional)
+	for i := range args {
+		args[i] = "NULL"
+	}
+	return fmt.Sprintf(sqlFmtDescribeFunction, sqlFunctionName(fn), strings.Join(args, ", "))
+}
+
+// sqlFunctionName provides the quoted, fully qualified name of a function
+func sqlFunctionName(fn *Function) string {
+	var parts []string
+	if fn.Catalog != "" {
+		parts = append(parts, quoteIdent(fn.Catalog))
+	}
+	if fn.Schema != "" {
+		parts = append(parts, quoteIdent(fn.Schema))
+	}
+	parts = append(parts, quoteIdent(fn.Name))
+	return strings.Join(parts, ".")
 }
 
 func quotedList(names []string) string {
@@ -72,46 +249,184 @@ func quotedList(names []string) string {
 	return "'" + itemsJoin + "'"
 }
 
+// quoteIdent quotes a SQL identifier, escaping any embedded quotes
+func quoteIdent(name string) string {
+	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+}
+
+// quoteLiteral quotes a SQL string literal, escaping any embedded quotes
+func quoteLiteral(val string) string {
+	return "'" + strings.ReplaceAll(val, "'", "''") + "'"
+}
+
+// sqlTableName provides the quoted, fully qualified name of a table.
+// Catalog and schema are omitted if not known
+func sqlTableName(tbl *Table) string {
+	var parts []string
+	if tbl.Catalog != "" {
+		parts = append(parts, quoteIdent(tbl.Catalog))
+	}
+	if tbl.Schema != "" {
+		parts = append(parts, quoteIdent(tbl.Schema))
+	}
+	parts = append(parts, quoteIdent(tbl.Table))
+	return strings.Join(parts, ".")
+}
+
 const sqlFmtExtentEst = `SELECT ST_XMin(ext.geom) AS xmin, ST_YMin(ext.geom) AS ymin, ST_XMax(ext.geom) AS xmax, ST_YMax(ext.geom) AS ymax
-FROM ( SELECT ST_Envelope_Agg("%s") AS geom FROM "%s" ) AS ext;`
+FROM ( SELECT ST_Envelope_Agg(%s) AS geom FROM %s ) AS ext;`
 
 func sqlExtentEstimated(tbl *Table) string {
-	return fmt.Sprintf(sqlFmtExtentEst, tbl.GeometryColumn, tbl.Table)
+	return fmt.Sprintf(sqlFmtExtentEst, quoteIdent(tbl.GeometryColumn), sqlTableName(tbl))
 }
 
 const sqlFmtExtentExact = `SELECT ST_XMin(ext.geom) AS xmin, ST_YMin(ext.geom) AS ymin, ST_XMax(ext.geom) AS xmax, ST_YMax(ext.geom) AS ymax
-FROM (SELECT COALESCE(ST_Envelope_Agg("%s"), ST_GeomFromText('POLYGON((-180 -90, 180 -90, 180 90, -180 90, -180 -90))', 4326)) AS geom FROM "%s" ) AS ext;`
+FROM (SELECT COALESCE(ST_Envelope_Agg(%s), ST_GeomFromText('POLYGON((-180 -90, 180 -90, 180 90, -180 90, -180 -90))', 4326)) AS geom FROM %s ) AS ext;`
 
 func sqlExtentExact(tbl *Table) string {
-	return fmt.Sprintf(sqlFmtExtentExact, tbl.GeometryColumn, tbl.Table)
+	return fmt.Sprintf(sqlFmtExtentExact, quoteIdent(tbl.GeometryColumn), sqlTableName(tbl))
 }
 
-const sqlFmtFeatures = "SELECT %v %v FROM \"%s\" %v %v %v %s;"
+const sqlFmtRowCount = "SELECT count(*) FROM %s"
+
+// sqlRowCount counts the rows of a table
+func sqlRowCount(tbl *Table) string {
+	return fmt.Sprintf(sqlFmtRowCount, sqlTableName(tbl))
+}
+
+const sqlFmtFeatures = "SELECT %v %v FROM %s %v %v %v %s;"
+
+const sqlFmtTemporalExtent = `SELECT min(%s), max(%s) FROM %s`
+
+// sqlTemporalExtent computes the time interval spanned by the features of a table
+func sqlTemporalExtent(tbl *Table) string {
+	endCol := tbl.TemporalEndColumn
+	if endCol == "" {
+		endCol = tbl.TemporalColumn
+	}
+	return fmt.Sprintf(sqlFmtTemporalExtent, quoteIdent(tbl.TemporalColumn), quoteIdent(endCol), sqlTableName(tbl))
+}
 
 func sqlFeatures(tbl *Table, param *QueryParam) (string, []interface{}) {
-	geomCol := sqlGeomCol(tbl.GeometryColumn, tbl.Srid, param)
-	propCols := sqlColList(param.Columns, tbl.DbTypes, true)
-	bboxFilter := sqlBBoxFilter(tbl.GeometryColumn, param.Bbox, param.BboxCrs)
-	attrFilter, attrVals := sqlAttrFilter(param.Filter)
-	cqlFilter := sqlCqlFilter(param.FilterSql)
-	sqlWhere := sqlWhere(bboxFilter, attrFilter, cqlFilter)
+	geomColName := tableGeomColumn(tbl, param)
+	geomCol := sqlGeomCol(geomColName, tbl.GeometrySrid(geomColName), param)
+	propCols := sqlColList(param.Columns, tbl.DbTypes, tbl.GeometrySrids, param.Crs, true)
+	filters, argValues := sqlFeaturesFilters(tbl, param)
+	cursorFilter, cursorVals := sqlCursorFilter(tbl, param, len(argValues)+1)
+	sqlWhere := sqlWhere(append(filters, cursorFilter)...)
 	sqlGroupBy := sqlGroupBy(param.GroupBy)
 	sqlOrderBy := sqlOrderBy(param.SortBy)
 	sqlLimitOffset := sqlLimitOffset(param.Limit, param.Offset)
-	sql := fmt.Sprintf(sqlFmtFeatures, geomCol, propCols, tbl.Table, sqlWhere, sqlGroupBy, sqlOrderBy, sqlLimitOffset)
-	return sql, attrVals
+	propCols += sqlAggregateCols(param.Aggregates, tbl.DbTypes, false)
+	if !param.IsGrouped() {
+		propCols += sqlIDCol(tbl.IDColumn)
+		// the feature ID makes the ordering stable
+		sqlOrderBy = sqlOrderByID(sqlOrderBy, param.SortBy, tbl.IDColumn)
+	}
+	propCols += sqlCursorKeys(cursorKeyExprs(tbl, param))
+	sql := fmt.Sprintf(sqlFmtFeatures, geomCol, propCols, sqlTableName(tbl), sqlWhere, sqlGroupBy, sqlOrderBy, sqlLimitOffset)
+	return sql, append(argValues, cursorVals...)
+}
+
+// sqlFeaturesFilters creates the conditions for the query filters, and their argument values
+func sqlFeaturesFilters(tbl *Table, param *QueryParam) ([]string, []interface{}) {
+	geomCol := tableGeomColumn(tbl, param)
+	bboxFilter := sqlBBoxFilter(geomCol, param.Bbox, param.BboxCrs, tbl.GeometrySrid(geomCol))
+	attrFilter, attrVals := sqlAttrFilter(param.Filter, 1)
+	timeFilter, timeVals := sqlDatetimeFilter(tbl, param.Datetime, len(attrVals)+1)
+	cqlFilter := sqlCqlFilter(param.FilterSql)
+	return []string{bboxFilter, attrFilter, timeFilter, cqlFilter}, append(attrVals, timeVals...)
+}
+
+// sqlCursorKeys selects the cursor key values as text, after the feature columns
+func sqlCursorKeys(keyExprs []string) string {
+	var sql string
+	for _, expr := range keyExprs {
+		sql += fmt.Sprintf(", %s::VARCHAR", expr)
+	}
+	return sql
+}
+
+// sqlCursorFilter creates the condition for the features after a cursor position,
+// in the order of the sort columns (with nulls last) followed by the ID column.
+// A feature follows the cursor if its keys equal the cursor keys up to some column,
+// and the value of that column follows the cursor key
+func sqlCursorFilter(tbl *Table, param *QueryParam, argIndex int) (string, []interface{}) {
+	keyExprs := cursorKeyExprs(tbl, param)
+	if param.Cursor == nil || len(keyExprs) == 0 {
+		return "", nil
+	}
+	if len(param.Cursor.Keys) != len(keyExprs) {
+		// the cursor is for a different ordering
+		return "FALSE", nil
+	}
+	keyTypes := cursorKeyTypes(tbl, param)
+	var alts, equalConds []string
+	var vals []interface{}
+	for i, colExpr := range keyExprs {
+		key := param.Cursor.Keys[i]
+		if key == nil {
+			// only nulls follow a null, since they are sorted last
+			equalConds = append(equalConds, colExpr+" IS NULL")
+			continue
+		}
+		keyExpr := fmt.Sprintf("$%d::%s", argIndex+len(vals), keyTypes[i])
+		vals = append(vals, *key)
+		op := ">"
+		if i < len(param.SortBy) && param.SortBy[i].IsDesc {
+			op = "<"
+		}
+		follows := fmt.Sprintf("%s %s %s", colExpr, op, keyExpr)
+		if i < len(param.SortBy) {
+			follows = fmt.Sprintf("(%s OR %s IS NULL)", follows, colExpr)
+		}
+		conds := append(append([]string{}, equalConds...), follows)
+		alts = append(alts, "("+strings.Join(conds, " AND ")+")")
+		equalConds = append(equalConds, fmt.Sprintf("%s = %s", colExpr, keyExpr))
+	}
+	return "(" + strings.Join(alts, " OR ") + ")", vals
+}
+
+const sqlFmtFeaturesCount = "SELECT count(*) FROM %s%s"
+
+const sqlFmtFeaturesCountEstimated = "SELECT count(*) * %d FROM %s TABLESAMPLE %d PERCENT (bernoulli)%s"
+
+const sqlFmtGroupsCount = "SELECT count(*) FROM (SELECT count(*) FROM %s%s %s)"
+
+// sqlCountSamplePercent is the percentage of rows sampled to estimate a feature count
+const sqlCountSamplePercent = 1
+
+// sqlFeaturesCount creates a query counting the features matching the query filters,
+// or the groups if grouping.
+// Grouping with no columns has a single group, even if no features match.
+// The count includes features before the cursor position, if any.
+// An estimated count evaluates the filters on a sample of the table rows.
+// Counts without filters are always exact, since DuckDB reads them from table
+// and Parquet metadata
+func sqlFeaturesCount(tbl *Table, param *QueryParam, isEstimated bool) (string, []interface{}) {
+	filters, argValues := sqlFeaturesFilters(tbl, param)
+	sqlWhere := sqlWhere(filters...)
+	if param.IsGrouped() {
+		return fmt.Sprintf(sqlFmtGroupsCount, sqlTableName(tbl), sqlWhere, sqlGroupBy(param.GroupBy)), argValues
+	}
+	if isEstimated && len(sqlWhere) > 0 {
+		sql := fmt.Sprintf(sqlFmtFeaturesCountEstimated, 100/sqlCountSamplePercent, sqlTableName(tbl), sqlCountSamplePercent, sqlWhere)
+		return sql, argValues
+	}
+	return fmt.Sprintf(sqlFmtFeaturesCount, sqlTableName(tbl), sqlWhere), argValues
 }
 
 // sqlColList creates a comma-separated column list, or blank if no columns
-// If addLeadingComma is true, a leading comma is added, for use when the target SQL has columns defined before
-func sqlColList(names []string, dbtypes map[string]string, addLeadingComma bool) string {
+// If addLeadingComma is true, a leading comma is added, for use when the target SQL has columns defined before.
+// Geometry columns are transformed from their SRID to the output CRS
+func sqlColList(names []string, dbtypes map[string]string, srids map[string]int, outCrs Crs, addLeadingComma bool) string {
 	if len(names) == 0 {
 		return ""
 	}
 
 	var cols []string
 	for _, col := range names {
-		colExpr := sqlColExpr(col, dbtypes[col])
+		colExpr := sqlColExpr(col, dbtypes[col], srids[col], outCrs)
 		cols = append(cols, colExpr)
 	}
 	colsStr := strings.Join(cols, ",")
@@ -122,35 +437,62 @@ func sqlColList(names []string, dbtypes map[string]string, addLeadingComma bool)
 }
 
 // makeSQLColExpr casts a column to text if type is unknown to PGX
-func sqlColExpr(name string, dbtype string) string {
+func sqlColExpr(name string, dbtype string, sourceSRID int, outCrs Crs) string {
 
-	name = strconv.Quote(name)
+	name = quoteIdent(name)
 
 	// TODO: make this more data-driven / configurable
 	switch dbtype {
 	case forceTextTSVECTOR:
 		return fmt.Sprintf("%s::text", name)
+	case DuckDBTypeGeometry:
+		// non-primary geometry columns are output as nested GeoJSON objects,
+		// in the same CRS as the primary geometry
+		return fmt.Sprintf("ST_AsGeoJSON(%s)", transformToOutCrs(name, sourceSRID, outCrs))
 	}
 
-	// for properties that will be treated as a string in the JSON response,
-	// cast to text.  This allows displaying data types that DuckDB
-	// does not support out of the box, as long as it can be cast to text.
-	if toJSONTypeFromDuckDB(dbtype) == JSONTypeString {
+	// binary data is output as base64
+	if isBlobType(duckDBBaseType(dbtype)) {
+		return fmt.Sprintf("to_base64(%s)", name)
+	}
+	// types which are not converted to JSON from Go values are cast to text.
+	// This outputs dates and times in ISO 8601 form, and allows displaying
+	// data types that are not supported out of the box, as long as they can be cast to text.
+	if !isNativeJSONType(dbtype) {
 		return fmt.Sprintf("%s::VARCHAR", name)
 	}
 
 	return name
 }
 
-const sqlFmtFeature = "SELECT %v %v FROM \"%s\" WHERE \"%v\" = $1 LIMIT 1"
+const sqlFmtFeature = "SELECT %v %v FROM %s WHERE %v = $1 LIMIT 1"
 
 func sqlFeature(tbl *Table, param *QueryParam) string {
-	geomCol := sqlGeomCol(tbl.GeometryColumn, tbl.Srid, param)
-	propCols := sqlColList(param.Columns, tbl.DbTypes, true)
-	sql := fmt.Sprintf(sqlFmtFeature, geomCol, propCols, tbl.Table, tbl.IDColumn)
+	geomColName := tableGeomColumn(tbl, param)
+	geomCol := sqlGeomCol(geomColName, tbl.GeometrySrid(geomColName), param)
+	propCols := sqlColList(param.Columns, tbl.DbTypes, tbl.GeometrySrids, param.Crs, true) + sqlIDCol(tbl.IDColumn)
+	sql := fmt.Sprintf(sqlFmtFeature, geomCol, propCols, sqlTableName(tbl), quoteIdent(tbl.IDColumn))
 	return sql
 }
 
+// tableGeomColumn is the geometry column to output and filter.
+// This is the primary geometry column unless another is requested
+func tableGeomColumn(tbl *Table, param *QueryParam) string {
+	if param.GeometryColumn != "" {
+		return param.GeometryColumn
+	}
+	return tbl.GeometryColumn
+}
+
+// sqlIDCol selects the feature ID column after the property columns,
+// so that features have an ID even when it is not a requested property
+func sqlIDCol(idColumn string) string {
+	if idColumn == "" {
+		return ""
+	}
+	return ", " + quoteIdent(idColumn)
+}
+
 func sqlCqlFilter(sql string) string {
 	//log.Debug("SQL = " + sql)
 	if len(sql) == 0 {
@@ -159,16 +501,12 @@ func sqlCqlFilter(sql string) string {
 	return "(" + sql + ")"
 }
 
-func sqlWhere(cond1 string, cond2 string, cond3 string) string {
+func sqlWhere(conds ...string) string {
 	var condList []string
-	if len(cond1) > 0 {
-		condList = append(condList, cond1)
-	}
-	if len(cond2) > 0 {
-		condList = append(condList, cond2)
-	}
-	if len(cond3) > 0 {
-		condList = append(condList, cond3)
+	for _, cond := range conds {
+		if len(cond) > 0 {
+			condList = append(condList, cond)
+		}
 	}
 	where := strings.Join(condList, " AND ")
 	if len(where) > 0 {
@@ -177,48 +515,201 @@ func sqlWhere(cond1 string, cond2 string, cond3 string) string {
 	return where
 }
 
-func sqlAttrFilter(filterConds []*PropertyFilter) (string, []interface{}) {
+// sqlAttrFilter restricts features to those whose properties satisfy the property filters.
+// Parameters are numbered from argIndex
+func sqlAttrFilter(filterConds []*PropertyFilter, argIndex int) (string, []interface{}) {
 	var vals []interface{}
+	addArg := func(val string, cast string) string {
+		vals = append(vals, val)
+		return fmt.Sprintf("$%d%s", argIndex+len(vals)-1, cast)
+	}
 	var exprItems []string
-	for i, cond := range filterConds {
-		sqlCond := fmt.Sprintf("\"%v\" = $%v", cond.Name, i+1)
+	for _, cond := range filterConds {
+		col := quoteIdent(cond.Name)
+		cast := sqlFilterCast(cond.DbType)
+		var sqlCond string
+		switch cond.Op {
+		case FilterOpIsNull, FilterOpNotNull:
+			sqlCond = fmt.Sprintf("%s %s", col, cond.Op)
+		case FilterOpIn:
+			args := make([]string, len(cond.Values))
+			for i, val := range cond.Values {
+				args[i] = addArg(val, cast)
+			}
+			sqlCond = fmt.Sprintf("%s IN (%s)", col, strings.Join(args, ", "))
+		case FilterOpRange:
+			var bounds []string
+			if cond.Values[0] != "" {
+				bounds = append(bounds, fmt.Sprintf("%s >= %s", col, addArg(cond.Values[0], cast)))
+			}
+			if cond.Values[1] != "" {
+				bounds = append(bounds, fmt.Sprintf("%s <= %s", col, addArg(cond.Values[1], cast)))
+			}
+			sqlCond = strings.Join(bounds, " AND ")
+		case FilterOpLike:
+			sqlCond = fmt.Sprintf(`%s::VARCHAR LIKE %s ESCAPE '\'`, col, addArg(sqlLikePattern(cond.Value), ""))
+		default:
+			sqlCond = fmt.Sprintf("%s = %s", col, addArg(cond.Value, cast))
+		}
 		exprItems = append(exprItems, sqlCond)
-		vals = append(vals, cond.Value)
 	}
 	sql := strings.Join(exprItems, " AND ")
 	return sql, vals
 }
 
+// sqlFilterCast is the cast of property filter values to a property type.
+// Values are only cast to scalar types, and other types are compared as text
+func sqlFilterCast(dbType string) string {
+	switch toJSONTypeFromDuckDB(dbType) {
+	case JSONTypeInteger, JSONTypeNumber, JSONTypeBoolean:
+		return "::" + dbType
+	}
+	if IsTemporalType(dbType) {
+		return "::" + dbType
+	}
+	return ""
+}
+
+// sqlLikePattern converts a property filter pattern with wildcards to a LIKE pattern,
+// escaping the LIKE special characters
+func sqlLikePattern(pattern string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, FilterWildcard, "%")
+	return escaper.Replace(pattern)
+}
+
 // DuckDB spatial doesn't support SRID parameter in ST_GeomFromText
-const sqlFmtBBoxGeoFilter = ` ST_Intersects("%v", ST_GeomFromText('POLYGON((%v %v, %v %v, %v %v, %v %v, %v %v))')) `
+const sqlFmtBBoxGeom = `ST_GeomFromText('%v')`
 
-func sqlBBoxFilter(geomCol string, bbox *Extent, bboxSRID int) string {
+const sqlFmtBBoxGeoFilter = ` ST_Intersects(%v, %v) `
+
+// sqlFmtBBoxZFilter restricts the Z range of geometries which have Z values
+const sqlFmtBBoxZFilter = `AND (NOT ST_HasZ(%[1]v) OR (ST_ZMax(%[1]v) >= %[2]v AND ST_ZMin(%[1]v) <= %[3]v)) `
+
+// sqlDatetimeFilter restricts features to those whose time (or time interval)
+// intersects the datetime parameter.
+// Parameters are numbered from argIndex, following any attribute filter parameters
+func sqlDatetimeFilter(tbl *Table, dt *TimeInterval, argIndex int) (string, []interface{}) {
+	if dt == nil || tbl.TemporalColumn == "" {
+		return "", nil
+	}
+	startCol, endCol := tbl.TemporalColumn, tbl.TemporalEndColumn
+	if endCol == "" {
+		endCol = startCol
+	}
+	var conds []string
+	var vals []interface{}
+	addCond := func(col string, op string, t *time.Time) {
+		cast, val := sqlTimeValue(tbl.DbTypes[col], *t)
+		conds = append(conds, fmt.Sprintf("%s %s $%d::%s", quoteIdent(col), op, argIndex+len(vals), cast))
+		vals = append(vals, val)
+	}
+	if dt.IsInstant() && startCol == endCol {
+		addCond(startCol, "=", dt.Start)
+	} else {
+		// the feature interval [startCol, endCol] intersects [Start, End]
+		if dt.End != nil {
+			addCond(startCol, "<=", dt.End)
+		}
+		if dt.Start != nil {
+			addCond(endCol, ">=", dt.Start)
+		}
+	}
+	return strings.Join(conds, " AND "), vals
+}
+
+// sqlTimeValue provides a time parameter value and the type to cast it to.
+// Times without a time zone are taken to be UTC.
+// A date column is compared with the date of the time,
+// so that a date matches the times during that day
+func sqlTimeValue(dbType string, t time.Time) (string, string) {
+	if isDateType(dbType) {
+		return "DATE", t.UTC().Format(time.DateOnly)
+	}
+	val := t.UTC().Format("2006-01-02 15:04:05.999999")
+	if isTimeZoneType(dbType) {
+		return "TIMESTAMPTZ", val + "+00"
+	}
+	return "TIMESTAMP", val
+}
+
+// sqlBBoxFilter restricts features to those intersecting a bbox.
+// A bbox in latitude/longitude axis order has the latitudes first,
+// and a bbox in another CRS than the source is transformed to the source CRS.
+// A bbox crossing the antimeridian is split into two envelopes, one on each side.
+// A 3D bbox also restricts the Z range of geometries which have Z values
+func sqlBBoxFilter(geomCol string, bbox *Extent, bboxCrs Crs, sourceSRID int) string {
 	if bbox == nil {
 		return ""
 	}
-	// For DuckDB, use ST_GeomFromText without SRID parameter
-	return fmt.Sprintf(sqlFmtBBoxGeoFilter, geomCol,
-		bbox.Minx, bbox.Miny, bbox.Maxx, bbox.Miny, bbox.Maxx, bbox.Maxy, bbox.Minx, bbox.Maxy, bbox.Minx, bbox.Miny)
+	xy := bbox.XY(bboxCrs)
+	var bboxWKT string
+	if bbox.CrossesAntimeridian(bboxCrs) {
+		bboxWKT = fmt.Sprintf("MULTIPOLYGON((%v),(%v))",
+			sqlEnvelopeRing(xy.Minx, xy.Miny, 180, xy.Maxy),
+			sqlEnvelopeRing(-180, xy.Miny, xy.Maxx, xy.Maxy))
+	} else {
+		bboxWKT = fmt.Sprintf("POLYGON(%v)", sqlEnvelopeRing(xy.Minx, xy.Miny, xy.Maxx, xy.Maxy))
+	}
+	bboxGeom := sqlTransform(fmt.Sprintf(sqlFmtBBoxGeom, bboxWKT), bboxCrs.Srid, sourceSRID)
+	sql := fmt.Sprintf(sqlFmtBBoxGeoFilter, quoteIdent(geomCol), bboxGeom)
+	if bbox.HasZ {
+		sql += fmt.Sprintf(sqlFmtBBoxZFilter, quoteIdent(geomCol), bbox.Minz, bbox.Maxz)
+	}
+	return sql
+}
+
+// sqlEnvelopeRing is the WKT ring of an envelope
+func sqlEnvelopeRing(minx, miny, maxx, maxy float64) string {
+	return fmt.Sprintf("(%v %v, %v %v, %v %v, %v %v, %v %v)",
+		minx, miny, maxx, miny, maxx, maxy, minx, maxy, minx, miny)
 }
 
 const sqlFmtGeomCol = `ST_AsGeoJSON( %v %v ) AS _geojson`
 
+// sqlFmtGroupGeom aggregates the geometries of a group of features into a collection
+const sqlFmtGroupGeom = "ST_Collect(list(%v))"
+
 func sqlGeomCol(geomCol string, sourceSRID int, param *QueryParam) string {
-	geomColSafe := strconv.Quote(geomCol)
+	geomColSafe := quoteIdent(geomCol)
+	if param.IsGrouped() {
+		geomColSafe = fmt.Sprintf(sqlFmtGroupGeom, geomColSafe)
+	}
 	geomExpr := applyTransform(param.TransformFuns, geomColSafe)
 	geomOutExpr := transformToOutCrs(geomExpr, sourceSRID, param.Crs)
 	sql := fmt.Sprintf(sqlFmtGeomCol, geomOutExpr, sqlPrecisionArg(param.Precision))
 	return sql
 }
 
-func transformToOutCrs(geomExpr string, sourceSRID, outSRID int) string {
-	if sourceSRID == outSRID {
-		return geomExpr
+// transformToOutCrs transforms a geometry from the source CRS to the output CRS.
+// Coordinates are flipped for an output CRS with latitude/longitude axis order
+func transformToOutCrs(geomExpr string, sourceSRID int, outCrs Crs) string {
+	geomExpr = sqlTransform(geomExpr, sourceSRID, outCrs.Srid)
+	if outCrs.IsLatLon {
+		geomExpr = fmt.Sprintf(sqlFmtFlipCoordinates, geomExpr)
 	}
-	// For DuckDB spatial, we'll return the original for now since transform support is limited
 	return geomExpr
 }
 
+const sqlFmtTransform = "ST_Transform(%v, 'EPSG:%d', 'EPSG:%d', true)"
+
+const sqlFmtFlipCoordinates = "ST_FlipCoordinates(%v)"
+
+// sqlTransform transforms a geometry between CRSs, in x/y axis order.
+// DuckDB geometries have no SRID, so the source SRID is given explicitly.
+// An unknown SRID is assumed to be 4326
+func sqlTransform(geomExpr string, fromSRID int, toSRID int) string {
+	if fromSRID <= 0 {
+		fromSRID = SRID_4326
+	}
+	if toSRID <= 0 {
+		toSRID = SRID_4326
+	}
+	if fromSRID == toSRID {
+		return geomExpr
+	}
+	return fmt.Sprintf(sqlFmtTransform, geomExpr, fromSRID, toSRID)
+}
+
 func sqlPrecisionArg(precision int) string {
 	if precision < 0 {
 		return ""
@@ -227,36 +718,114 @@ func sqlPrecisionArg(precision int) string {
 	return sqlPrecision
 }
 
-const sqlFmtOrderBy = `ORDER BY "%v" %v`
+// sqlFmtSortMeasures are the SQL expressions for the geometry measures features can be sorted by
+var sqlFmtSortMeasures = map[string]string{
+	SortMeasureArea:   "ST_Area(%s)",
+	SortMeasureLength: "ST_Length(%s)",
+}
 
+// sqlSortExpr is the SQL expression for a sort column or measure
+func sqlSortExpr(sort Sorting) string {
+	if fmtMeasure, ok := sqlFmtSortMeasures[sort.Measure]; ok {
+		return fmt.Sprintf(fmtMeasure, quoteIdent(sort.Name))
+	}
+	return quoteIdent(sort.Name)
+}
+
+// sqlOrderBy creates the ORDER BY clause for a list of sort columns.
+// Nulls are sorted last in both directions, as cursor paging expects
 func sqlOrderBy(ordering []Sorting) string {
 	if len(ordering) <= 0 {
 		return ""
 	}
-	// TODO: support more than one ordering
-	col := ordering[0].Name
-	dir := ""
-	if ordering[0].IsDesc {
-		dir = "DESC"
+	terms := make([]string, len(ordering))
+	for i, sort := range ordering {
+		dir := ""
+		if sort.IsDesc {
+			dir = " DESC"
+		}
+		terms[i] = sqlSortExpr(sort) + dir + " NULLS LAST"
 	}
-	sql := fmt.Sprintf(sqlFmtOrderBy, col, dir)
-	return sql
+	return "ORDER BY " + strings.Join(terms, ", ")
 }
 
-const sqlFmtGroupBy = `GROUP BY "%v"`
+// sqlOrderByID adds the ID column to an ordering, to order features with equal sort values
+func sqlOrderByID(sqlOrderBy string, ordering []Sorting, idColumn string) string {
+	if idColumn == "" {
+		return sqlOrderBy
+	}
+	for _, sort := range ordering {
+		if sort.Name == idColumn && sort.Measure == "" {
+			return sqlOrderBy
+		}
+	}
+	if sqlOrderBy == "" {
+		return "ORDER BY " + quoteIdent(idColumn)
+	}
+	return sqlOrderBy + ", " + quoteIdent(idColumn)
+}
 
+// sqlGroupBy creates the GROUP BY clause for a list of columns.
+// It is blank if there are no columns, so that all features form one group
 func sqlGroupBy(groupBy []string) string {
 	if len(groupBy) <= 0 {
 		return ""
 	}
-	// TODO: support more than one grouping
-	col := groupBy[0]
-	sql := fmt.Sprintf(sqlFmtGroupBy, col)
+	cols := make([]string, len(groupBy))
+	for i, col := range groupBy {
+		cols[i] = quoteIdent(col)
+	}
+	sql := "GROUP BY " + strings.Join(cols, ", ")
 	log.Debugf("group by: %s", sql)
 	return sql
 }
 
+// sqlAggregateCols creates the column list of the aggregate values of a group,
+// named by the aggregate property names.
+// A leading comma is added unless isFirst is true
+func sqlAggregateCols(aggs []Aggregate, dbTypes map[string]string, isFirst bool) string {
+	if len(aggs) == 0 {
+		return ""
+	}
+	cols := make([]string, len(aggs))
+	for i, agg := range aggs {
+		cols[i] = fmt.Sprintf("%s AS %s", sqlAggregateExpr(agg, dbTypes[agg.Column]), quoteIdent(agg.Name()))
+	}
+	sql := strings.Join(cols, ",")
+	if isFirst {
+		return sql
+	}
+	return ", " + sql
+}
+
+// sqlAggregateExpr is the SQL expression for an aggregate of a column.
+// Minimum and maximum values of types which are not converted to JSON are cast to text,
+// as the column values are
+func sqlAggregateExpr(agg Aggregate, dbType string) string {
+	if agg.Column == AggregateAll {
+		return agg.Function + "(*)"
+	}
+	expr := fmt.Sprintf("%s(%s)", agg.Function, quoteIdent(agg.Column))
+	if agg.Function == AggregateCount || isNativeJSONType(dbType) {
+		return expr
+	}
+	return expr + "::VARCHAR"
+}
+
+// ResultLimit is the number of rows a query with the given limit returns at most.
+// The limit is capped by the configured result row budget, if any.
+// A negative value is unlimited
+func ResultLimit(limit int) int {
+	if budget := conf.Configuration.Database.MaxResultRows; budget > 0 && (limit < 0 || limit > budget) {
+		return budget
+	}
+	return limit
+}
+
+// sqlLimitOffset provides the LIMIT and OFFSET clauses of a query.
+// The limit is capped by the configured result row budget, if any
 func sqlLimitOffset(limit int, offset int) string {
+	limit = ResultLimit(limit)
 	sqlLim := ""
 	if limit >= 0 {
 		sqlLim = fmt.Sprintf(" LIMIT %d", limit)
@@ -278,45 +847,64 @@ func applyTransform(funs []TransformFunction, expr string) string {
 	return expr
 }
 
-const sqlFmtGeomFunction = "SELECT %s %s FROM \"%s\"( %v ) %v %v %s;"
+const sqlFmtGeomFunction = "SELECT %s %s FROM %s( %v ) %v %v %v %s;"
 
 func sqlGeomFunction(fn *Function, args map[string]string, propCols []string, param *QueryParam) (string, []interface{}) {
-	sqlArgs, argVals := sqlFunctionArgs(args)
+	sqlArgs, argVals := sqlFunctionArgs(fn, args)
 	sqlGeomCol := sqlGeomCol(fn.GeometryColumn, SRID_UNKNOWN, param)
-	sqlPropCols := sqlColList(propCols, fn.Types, true)
+	sqlPropCols := sqlColList(propCols, fn.Types, nil, param.Crs, true) + sqlAggregateCols(param.Aggregates, fn.Types, false)
 	//-- SRS of function output is unknown, so have to assume 4326
-	bboxFilter := sqlBBoxFilter(fn.GeometryColumn, param.Bbox, param.BboxCrs)
+	bboxFilter := sqlBBoxFilter(fn.GeometryColumn, param.Bbox, param.BboxCrs, SRID_UNKNOWN)
+	attrFilter, attrVals := sqlAttrFilter(param.Filter, len(argVals)+1)
 	cqlFilter := sqlCqlFilter(param.FilterSql)
-	sqlWhere := sqlWhere(bboxFilter, cqlFilter, "")
+	sqlWhere := sqlWhere(bboxFilter, attrFilter, cqlFilter)
+	sqlGroupBy := sqlGroupBy(param.GroupBy)
 	sqlOrderBy := sqlOrderBy(param.SortBy)
 	sqlLimitOffset := sqlLimitOffset(param.Limit, param.Offset)
-	sql := fmt.Sprintf(sqlFmtGeomFunction, sqlGeomCol, sqlPropCols, fn.Name, sqlArgs, sqlWhere, sqlOrderBy, sqlLimitOffset)
-	return sql, argVals
+	sql := fmt.Sprintf(sqlFmtGeomFunction, sqlGeomCol, sqlPropCols, sqlFunctionName(fn), sqlArgs, sqlWhere, sqlGroupBy, sqlOrderBy, sqlLimitOffset)
+	return sql, append(argVals, attrVals...)
 }
 
-const sqlFmtFunction = "SELECT %v FROM \"%s\"( %v ) %v %v %s;"
+const sqlFmtFunction = "SELECT %v FROM %s( %v ) %v %v %v %s;"
 
 func sqlFunction(fn *Function, args map[string]string, propCols []string, param *QueryParam) (string, []interface{}) {
-	sqlArgs, argVals := sqlFunctionArgs(args)
-	sqlPropCols := sqlColList(propCols, fn.Types, false)
+	sqlArgs, argVals := sqlFunctionArgs(fn, args)
+	sqlPropCols := sqlColList(propCols, fn.Types, nil, param.Crs, false) + sqlAggregateCols(param.Aggregates, fn.Types, len(propCols) == 0)
+	attrFilter, attrVals := sqlAttrFilter(param.Filter, len(argVals)+1)
 	cqlFilter := sqlCqlFilter(param.FilterSql)
-	sqlWhere := sqlWhere(cqlFilter, "", "")
+	sqlWhere := sqlWhere(attrFilter, cqlFilter)
+	sqlGroupBy := sqlGroupBy(param.GroupBy)
 	sqlOrderBy := sqlOrderBy(param.SortBy)
 	sqlLimitOffset := sqlLimitOffset(param.Limit, param.Offset)
-	sql := fmt.Sprintf(sqlFmtFunction, sqlPropCols, fn.Name, sqlArgs, sqlWhere, sqlOrderBy, sqlLimitOffset)
-	return sql, argVals
+	sql := fmt.Sprintf(sqlFmtFunction, sqlPropCols, sqlFunctionName(fn), sqlArgs, sqlWhere, sqlGroupBy, sqlOrderBy, sqlLimitOffset)
+	return sql, append(argVals, attrVals...)
 }
 
-func sqlFunctionArgs(argValues map[string]string) (string, []interface{}) {
+// sqlFunctionArgs creates the argument list for a table macro call.
+// Positional parameters are required by DuckDB, so are NULL if not supplied.
+// Parameters with defaults are only passed if supplied, as named arguments.
+// Argument values are strings, so are cast if the parameter type is known
+func sqlFunctionArgs(fn *Function, argValues map[string]string) (string, []interface{}) {
 	var vals []interface{}
 	var argItems []string
-	i := 1
-	for argName := range argValues {
-		argItem := fmt.Sprintf("%v => $%v", argName, i)
+	for i, argName := range fn.InNames {
+		val, ok := argValues[argName]
+		if !ok && i >= fn.NumNoDefault {
+			continue
+		}
+		argItem := "NULL"
+		if ok {
+			vals = append(vals, val)
+			argItem = fmt.Sprintf("$%v", len(vals))
+			if typ := fn.InDbTypes[i]; typ != DuckDBTypeAny {
+				argItem = fmt.Sprintf("%v::%v", argItem, typ)
+			}
+		}
+		if i >= fn.NumNoDefault {
+			argItem = fmt.Sprintf("%v := %v", quoteIdent(argName), argItem)
+		}
 		argItems = append(argItems, argItem)
-		i++
-		vals = append(vals, argValues[argName])
 	}
-	sql := strings.Join(argItems, ",")
+	sql := strings.Join(argItems, ", ")
 	return sql, vals
 }
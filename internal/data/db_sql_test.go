@@ -0,0 +1,359 @@
+package data
+
+/*
+ Copyright 2019 - 2025 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+      http://www.apache.org/licenses/LICENSE-2.0
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/tobilg/duckdb_featureserv/internal/conf"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	testEquals(t, `"users"`, quoteIdent("users"), "plain name")
+	testEquals(t, `"Mixed Case"`, quoteIdent("Mixed Case"), "mixed case name")
+	testEquals(t, `"a""b"`, quoteIdent(`a"b`), "embedded quote")
+}
+
+func TestSqlFeaturesQuotedColumns(t *testing.T) {
+	tbl := &Table{
+		Table:          "pts",
+		GeometryColumn: `g"eom`,
+		IDColumn:       "id",
+		DbTypes:        map[string]string{`a\b`: "INTEGER", `a"b`: "VARCHAR", "id": "INTEGER"},
+	}
+	param := &QueryParam{Limit: 10, Precision: -1, Columns: []string{`a\b`, `a"b`},
+		Bbox: &Extent{Minx: 1, Miny: 2, Maxx: 3, Maxy: 4}}
+
+	sql, _ := sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON( "g""eom"  ) AS _geojson , "a\b","a""b", "id"`), "columns quoted: "+sql)
+	testEquals(t, true, strings.Contains(sql, `ST_Intersects("g""eom", `), "bbox column quoted: "+sql)
+}
+
+func TestSqlTableName(t *testing.T) {
+	tbl := &Table{Catalog: "db", Schema: "reports", Table: "monthly"}
+	testEquals(t, `"db"."reports"."monthly"`, sqlTableName(tbl), "fully qualified")
+
+	tbl = &Table{Schema: "main", Table: "users"}
+	testEquals(t, `"main"."users"`, sqlTableName(tbl), "no catalog")
+
+	tbl = &Table{Table: "users"}
+	testEquals(t, `"users"`, sqlTableName(tbl), "table only")
+}
+
+func TestSqlFeaturesQualifiedTable(t *testing.T) {
+	tbl := &Table{
+		ID:             "other.s1.pts",
+		Catalog:        "other",
+		Schema:         "s1",
+		Table:          "pts",
+		GeometryColumn: "geom",
+		IDColumn:       "id",
+		DbTypes:        map[string]string{"id": "INTEGER"},
+	}
+	param := &QueryParam{Limit: 10, Precision: -1, Columns: []string{"id"}}
+
+	sql, _ := sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `FROM "other"."s1"."pts"`), "features FROM clause: "+sql)
+
+	sql = sqlFeature(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `FROM "other"."s1"."pts" WHERE "id" = $1`), "feature FROM clause: "+sql)
+}
+
+func TestSqlFeaturesIDColumn(t *testing.T) {
+	tbl := &Table{
+		Catalog:        "db",
+		Schema:         "main",
+		Table:          "pts",
+		GeometryColumn: "geom",
+		IDColumn:       RowIDColumn,
+		DbTypes:        map[string]string{"name": "VARCHAR"},
+	}
+	param := &QueryParam{Limit: 10, Precision: -1, Columns: []string{"name"}}
+
+	sql, _ := sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `"name", "rowid", "rowid"::VARCHAR FROM`), "ID column selected after properties, then cursor key: "+sql)
+	testEquals(t, true, strings.Contains(sql, `ORDER BY "rowid"`), "ordered by ID: "+sql)
+
+	sql = sqlFeature(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `"name", "rowid" FROM "db"."main"."pts" WHERE "rowid" = $1`), "feature by rowid: "+sql)
+
+	param.GroupBy = []string{"name"}
+	sql, _ = sqlFeatures(tbl, param)
+	testEquals(t, false, strings.Contains(sql, `"rowid"`), "ID column not selected when grouping: "+sql)
+}
+
+func TestSqlFeaturesGeomColumn(t *testing.T) {
+	tbl := &Table{
+		Table:           "parcels",
+		GeometryColumn:  "geom",
+		GeometryColumns: []string{"geom", "centroid"},
+		DbTypes:         map[string]string{"geom": "GEOMETRY", "centroid": "GEOMETRY"},
+	}
+	param := &QueryParam{Limit: 10, Precision: -1, Columns: []string{"centroid"}}
+
+	sql, _ := sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON( "geom"  ) AS _geojson , ST_AsGeoJSON("centroid")`), "primary geometry output: "+sql)
+
+	param.GeometryColumn = "centroid"
+	param.Columns = []string{"geom"}
+	param.Bbox = &Extent{Minx: 1, Miny: 2, Maxx: 3, Maxy: 4}
+	sql, _ = sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON( "centroid"  ) AS _geojson , ST_AsGeoJSON("geom")`), "selected geometry output: "+sql)
+	testEquals(t, true, strings.Contains(sql, `ST_Intersects("centroid"`), "selected geometry filtered: "+sql)
+}
+
+func TestSqlFeaturesGeomColumnsCrs(t *testing.T) {
+	tbl := &Table{
+		Table:           "parcels",
+		GeometryColumn:  "geom",
+		GeometryColumns: []string{"geom", "centroid"},
+		DbTypes:         map[string]string{"geom": "GEOMETRY", "centroid": "GEOMETRY"},
+		Srid:            SRID_4326,
+		GeometrySrids:   map[string]int{"geom": SRID_4326, "centroid": SRID_4326},
+	}
+	param := &QueryParam{Limit: 10, Precision: -1, Columns: []string{"centroid"}, Crs: Crs{Srid: 3857}}
+
+	sql, _ := sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON( ST_Transform("geom", 'EPSG:4326', 'EPSG:3857', true)  ) AS _geojson`), "primary geometry transformed: "+sql)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON(ST_Transform("centroid", 'EPSG:4326', 'EPSG:3857', true))`), "other geometry transformed: "+sql)
+
+	sql = sqlFeature(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON(ST_Transform("centroid", 'EPSG:4326', 'EPSG:3857', true))`), "other geometry of feature transformed: "+sql)
+
+	tbl.Srid = 3857
+	tbl.GeometrySrids = map[string]int{"geom": 3857, "centroid": 3857}
+	param.Crs = Crs{Srid: SRID_4326, IsLatLon: true}
+	sql, _ = sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON(ST_FlipCoordinates(ST_Transform("centroid", 'EPSG:3857', 'EPSG:4326', true)))`), "other geometry flipped: "+sql)
+}
+
+func TestSqlFeaturesGeomColumnSrids(t *testing.T) {
+	tbl := &Table{
+		Table:           "parcels",
+		GeometryColumn:  "geom",
+		GeometryColumns: []string{"geom", "centroid"},
+		DbTypes:         map[string]string{"geom": "GEOMETRY", "centroid": "GEOMETRY"},
+		Srid:            SRID_4326,
+		GeometrySrids:   map[string]int{"geom": SRID_4326, "centroid": 2193},
+	}
+	param := &QueryParam{Limit: 10, Precision: -1, Columns: []string{"centroid"}, Crs: CRS84}
+
+	sql, _ := sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON( "geom"  ) AS _geojson`), "primary geometry not transformed: "+sql)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON(ST_Transform("centroid", 'EPSG:2193', 'EPSG:4326', true))`), "other geometry transformed from its SRID: "+sql)
+
+	param.GeometryColumn = "centroid"
+	param.Columns = []string{"geom"}
+	param.Bbox = &Extent{Minx: 1, Miny: 2, Maxx: 3, Maxy: 4}
+	param.BboxCrs = CRS84
+	sql, _ = sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON( ST_Transform("centroid", 'EPSG:2193', 'EPSG:4326', true)  ) AS _geojson`), "selected geometry transformed from its SRID: "+sql)
+	testEquals(t, true, strings.Contains(sql, `ST_Intersects("centroid", ST_Transform(ST_GeomFromText('POLYGON((1 2, 3 2, 3 4, 1 4, 1 2))'), 'EPSG:4326', 'EPSG:2193', true))`), "bbox transformed to SRID of selected geometry: "+sql)
+	testEquals(t, true, strings.Contains(sql, `ST_AsGeoJSON("geom")`), "primary geometry as property not transformed: "+sql)
+
+	testEquals(t, SRID_4326, (&Table{Srid: SRID_4326}).GeometrySrid("geom"), "SRID of primary column used if unknown")
+}
+
+func TestSqlLimitOffsetBudget(t *testing.T) {
+	saved := conf.Configuration.Database.MaxResultRows
+	defer func() { conf.Configuration.Database.MaxResultRows = saved }()
+
+	conf.Configuration.Database.MaxResultRows = 0
+	testEquals(t, " LIMIT 5000 OFFSET 10", sqlLimitOffset(5000, 10), "no budget")
+	testEquals(t, "", sqlLimitOffset(-1, 0), "no budget or limit")
+
+	conf.Configuration.Database.MaxResultRows = 100
+	testEquals(t, " LIMIT 100 OFFSET 10", sqlLimitOffset(5000, 10), "limit capped by budget")
+	testEquals(t, " LIMIT 20", sqlLimitOffset(20, 0), "limit within budget")
+	testEquals(t, " LIMIT 100", sqlLimitOffset(-1, 0), "unlimited query capped by budget")
+}
+
+func TestSqlConnectionSettings(t *testing.T) {
+	testEquals(t, 0, len(sqlConnectionSettings(conf.Database{})), "defaults")
+	testEquals(t, []string{
+		"SET threads = 4",
+		"SET memory_limit = '2GB'",
+		"SET temp_directory = '/tmp/duck''s'",
+	}, sqlConnectionSettings(conf.Database{Threads: 4, MemoryLimit: "2GB", TempDirectory: "/tmp/duck's"}), "settings")
+}
+
+func TestSqlFeaturesCount(t *testing.T) {
+	tbl := &Table{Catalog: "db", Schema: "main", Table: "pts", GeometryColumn: "geom"}
+	param := &QueryParam{Limit: 10, Offset: 20, Precision: -1}
+
+	sql, _ := sqlFeaturesCount(tbl, param, true)
+	testEquals(t, `SELECT count(*) FROM "db"."main"."pts"`, sql, "unfiltered count is exact")
+
+	param.Filter = []*PropertyFilter{{Name: "name", Value: "a"}}
+	sql, args := sqlFeaturesCount(tbl, param, false)
+	testEquals(t, `SELECT count(*) FROM "db"."main"."pts" WHERE "name" = $1`, sql, "filtered count")
+	testEquals(t, []interface{}{"a"}, args, "filter args")
+
+	sql, _ = sqlFeaturesCount(tbl, param, true)
+	testEquals(t, `SELECT count(*) * 100 FROM "db"."main"."pts" TABLESAMPLE 1 PERCENT (bernoulli) WHERE "name" = $1`, sql, "estimated count")
+
+	param.GroupBy = []string{"name"}
+	sql, _ = sqlFeaturesCount(tbl, param, true)
+	testEquals(t, `SELECT count(*) FROM (SELECT count(*) FROM "db"."main"."pts" WHERE "name" = $1 GROUP BY "name")`, sql, "group count")
+
+	param.GroupBy = []string{}
+	sql, _ = sqlFeaturesCount(tbl, param, true)
+	testEquals(t, `SELECT count(*) FROM (SELECT count(*) FROM "db"."main"."pts" WHERE "name" = $1 )`, sql, "single group count")
+}
+
+func TestSqlFeaturesGrouped(t *testing.T) {
+	tbl := &Table{Catalog: "db", Schema: "main", Table: "pts", GeometryColumn: "geom", IDColumn: "id",
+		DbTypes: map[string]string{"id": "INTEGER", "state": "VARCHAR", "county": "VARCHAR", "pop": "BIGINT", "founded": "DATE"}}
+	param := &QueryParam{Limit: 10, Precision: -1, Columns: []string{"state", "county"},
+		GroupBy: []string{"state", "county"},
+		Aggregates: []Aggregate{
+			{Function: AggregateCount, Column: AggregateAll},
+			{Function: AggregateSum, Column: "pop"},
+			{Function: AggregateMin, Column: "founded"},
+		},
+		SortBy: []Sorting{{Name: "sum_pop", IsDesc: true}}}
+
+	sql, _ := sqlFeatures(tbl, param)
+	testEquals(t, `SELECT ST_AsGeoJSON( ST_Collect(list("geom"))  ) AS _geojson , "state","county", count(*) AS "count",sum("pop") AS "sum_pop",min("founded")::VARCHAR AS "min_founded" FROM "db"."main"."pts"  GROUP BY "state", "county" ORDER BY "sum_pop" DESC NULLS LAST  LIMIT 10;`, sql, "grouped features")
+
+	param.GroupBy = []string{}
+	param.Columns = []string{}
+	param.SortBy = nil
+	sql, _ = sqlFeatures(tbl, param)
+	testEquals(t, true, strings.Contains(sql, `AS _geojson , count(*) AS "count"`), "aggregates of all features: "+sql)
+	testEquals(t, false, strings.Contains(sql, `"id"`), "no ID column for groups: "+sql)
+	testEquals(t, false, strings.Contains(sql, "GROUP BY"), "no group columns: "+sql)
+}
+
+func TestSqlFunctionGrouped(t *testing.T) {
+	fn := &Function{Schema: "postgisftw", Name: "pts", GeometryColumn: "geom",
+		Types: map[string]string{"state": "VARCHAR", "pop": "BIGINT"}}
+	param := &QueryParam{Limit: 10, Precision: -1, GroupBy: []string{"state"},
+		Aggregates: []Aggregate{{Function: AggregateAvg, Column: "pop"}}}
+
+	sql, _ := sqlGeomFunction(fn, nil, []string{"state"}, param)
+	testEquals(t, true, strings.Contains(sql, `ST_Collect(list("geom"))`), "function geometry aggregated: "+sql)
+	testEquals(t, true, strings.Contains(sql, `, "state", avg("pop") AS "avg_pop" FROM "postgisftw"."pts"(  )  GROUP BY "state"`), "function groups: "+sql)
+
+	sql, _ = sqlFunction(fn, nil, nil, param)
+	testEquals(t, true, strings.HasPrefix(sql, `SELECT avg("pop") AS "avg_pop" FROM`), "function data aggregates: "+sql)
+}
+
+func TestSqlFunctionFilter(t *testing.T) {
+	fn := &Function{Schema: "postgisftw", Name: "pts", InNames: []string{"n"}, InDbTypes: []string{"INTEGER"},
+		NumNoDefault: 1, Types: map[string]string{"n": "INTEGER", "pop": "BIGINT"}}
+	param := &QueryParam{Limit: 10, Precision: -1,
+		Filter: []*PropertyFilter{{Name: "pop", Op: FilterOpIn, Values: []string{"1", "2"}, DbType: "BIGINT"}}}
+
+	sql, args := sqlFunction(fn, map[string]string{"n": "5"}, []string{"pop"}, param)
+	testEquals(t, true, strings.Contains(sql, `"pts"( $1::INTEGER )  WHERE "pop" IN ($2::BIGINT, $3::BIGINT)`), "function filter: "+sql)
+	testEquals(t, []interface{}{"5", "1", "2"}, args, "function and filter args")
+}
+
+func TestSqlCursorFilter(t *testing.T) {
+	tbl := &Table{Table: "pts", IDColumn: "id", DbTypes: map[string]string{"id": "INTEGER", "name": "VARCHAR"}}
+	sortBy := []Sorting{{Name: "name", IsDesc: true}}
+	param := &QueryParam{SortBy: sortBy, Cursor: NewCursor(sortBy, []interface{}{"b", 7})}
+
+	sql, args := sqlCursorFilter(tbl, param, 2)
+	testEquals(t, `((("name" < $2::VARCHAR OR "name" IS NULL)) OR ("name" = $2::VARCHAR AND "id" > $3::INTEGER))`, sql, "cursor filter")
+	testEquals(t, []interface{}{"b", "7"}, args, "cursor args")
+
+	param.Cursor = NewCursor(sortBy, []interface{}{nil, 7})
+	sql, args = sqlCursorFilter(tbl, param, 1)
+	testEquals(t, `(("name" IS NULL AND "id" > $1::INTEGER))`, sql, "cursor filter after null")
+	testEquals(t, []interface{}{"7"}, args, "cursor args after null")
+
+	param.GroupBy = []string{"name"}
+	sql, _ = sqlCursorFilter(tbl, param, 1)
+	testEquals(t, "", sql, "no cursor filter when grouping")
+}
+
+func TestSqlOrderBy(t *testing.T) {
+	sortBy := []Sorting{{Name: "pop", IsDesc: true}, {Name: "Name"}, {Name: "geom", Measure: SortMeasureArea, IsDesc: true}}
+	testEquals(t, `ORDER BY "pop" DESC NULLS LAST, "Name" NULLS LAST, ST_Area("geom") DESC NULLS LAST`, sqlOrderBy(sortBy), "multiple columns")
+	testEquals(t, "", sqlOrderBy(nil), "no sorting")
+
+	testEquals(t, `ORDER BY "Name" NULLS LAST, "id"`, sqlOrderByID(sqlOrderBy(sortBy[1:2]), sortBy[1:2], "id"), "ID tiebreaker")
+	testEquals(t, `ORDER BY "id"`, sqlOrderByID("", nil, "id"), "ID order")
+	idSort := []Sorting{{Name: "id", IsDesc: true}}
+	testEquals(t, `ORDER BY "id" DESC NULLS LAST`, sqlOrderByID(sqlOrderBy(idSort), idSort, "id"), "sorted by ID")
+}
+
+func TestSqlTransformCrs(t *testing.T) {
+	testEquals(t, `"geom"`, transformToOutCrs(`"geom"`, 4326, CRS84), "no transform to storage CRS")
+	testEquals(t, `ST_Transform("geom", 'EPSG:4326', 'EPSG:3857', true)`, transformToOutCrs(`"geom"`, 4326, Crs{Srid: 3857}), "transform to output CRS")
+	testEquals(t, `ST_FlipCoordinates(ST_Transform("geom", 'EPSG:2193', 'EPSG:4326', true))`,
+		transformToOutCrs(`"geom"`, 2193, Crs{Srid: 4326, IsLatLon: true}), "latitude/longitude output")
+	testEquals(t, `"geom"`, transformToOutCrs(`"geom"`, SRID_UNKNOWN, Crs{}), "unknown SRIDs are 4326")
+
+	bbox := &Extent{Minx: 40, Miny: -120, Maxx: 50, Maxy: -74}
+	testEquals(t, ` ST_Intersects("geom", ST_GeomFromText('POLYGON((-120 40, -74 40, -74 50, -120 50, -120 40))')) `,
+		sqlBBoxFilter("geom", bbox, Crs{Srid: 4326, IsLatLon: true}, 4326), "latitude/longitude bbox")
+	testEquals(t, ` ST_Intersects("geom", ST_Transform(ST_GeomFromText('POLYGON((40 -120, 50 -120, 50 -74, 40 -74, 40 -120))'), 'EPSG:4326', 'EPSG:3857', true)) `,
+		sqlBBoxFilter("geom", bbox, CRS84, 3857), "bbox transformed to storage CRS")
+}
+
+func TestSqlBBoxFilterAntimeridian(t *testing.T) {
+	bbox := &Extent{Minx: 170, Miny: -50, Maxx: -170, Maxy: -30}
+	testEquals(t, ` ST_Intersects("geom", ST_GeomFromText('MULTIPOLYGON(((170 -50, 180 -50, 180 -30, 170 -30, 170 -50)),((-180 -50, -170 -50, -170 -30, -180 -30, -180 -50)))')) `,
+		sqlBBoxFilter("geom", bbox, CRS84, 4326), "antimeridian bbox")
+	latLon := &Extent{Minx: -50, Miny: 170, Maxx: -30, Maxy: -170}
+	testEquals(t, sqlBBoxFilter("geom", bbox, CRS84, 4326),
+		sqlBBoxFilter("geom", latLon, Crs{Srid: 4326, IsLatLon: true}, 4326), "latitude/longitude antimeridian bbox")
+	testEquals(t, false, strings.Contains(sqlBBoxFilter("geom", bbox, Crs{Srid: 3857}, 3857), "MULTIPOLYGON"), "projected bbox is not split")
+}
+
+func TestSqlBBoxFilter3D(t *testing.T) {
+	bbox := &Extent{Minx: 1, Miny: 2, Minz: -10, Maxx: 3, Maxy: 4, Maxz: 100, HasZ: true}
+	testEquals(t, ` ST_Intersects("geom", ST_GeomFromText('POLYGON((1 2, 3 2, 3 4, 1 4, 1 2))')) AND (NOT ST_HasZ("geom") OR (ST_ZMax("geom") >= -10 AND ST_ZMin("geom") <= 100)) `,
+		sqlBBoxFilter("geom", bbox, CRS84, 4326), "3D bbox")
+	testEquals(t, true, strings.Contains(sqlBBoxFilter(`g"eom`, bbox, CRS84, 4326),
+		`AND (NOT ST_HasZ("g""eom") OR (ST_ZMax("g""eom") >= -10 AND ST_ZMin("g""eom") <= 100))`), "3D bbox quoted column")
+}
+
+func TestSqlAttrFilter(t *testing.T) {
+	conds := []*PropertyFilter{
+		{Name: "pop", Op: FilterOpRange, Values: []string{"100", ""}, DbType: "INTEGER"},
+		{Name: "name", Op: FilterOpLike, Value: "a_*", DbType: "VARCHAR"},
+		{Name: "code", Op: FilterOpIn, Values: []string{"1", "2"}, DbType: "BIGINT"},
+		{Name: "note", Op: FilterOpIsNull},
+		{Name: "day", Op: FilterOpEq, Value: "2020-01-01", DbType: "DATE"},
+	}
+	where, vals := sqlAttrFilter(conds, 3)
+	testEquals(t, `"pop" >= $3::INTEGER AND "name"::VARCHAR LIKE $4 ESCAPE '\' AND "code" IN ($5::BIGINT, $6::BIGINT) AND "note" IS NULL AND "day" = $7::DATE`,
+		where, "filter SQL")
+	testEquals(t, []interface{}{"100", `a\_%`, "1", "2", "2020-01-01"}, vals, "filter values")
+
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE t AS SELECT * FROM (VALUES
+		(100, 'a_1', 1, NULL, DATE '2020-01-01'),
+		(200, 'ab', 2, NULL, DATE '2020-01-01'),
+		(300, 'a_2', 3, NULL, DATE '2020-01-01')) v(pop, name, code, note, day)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the pattern only matches an underscore, and values are cast to the column types
+	where, vals = sqlAttrFilter(conds, 1)
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM t WHERE "+where, vals...).Scan(&count)
+	testEquals(t, nil, err, "filter query error")
+	testEquals(t, 1, count, "filtered rows")
+}
@@ -18,9 +18,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
 	"github.com/tobilg/duckdb_featureserv/internal/api"
 	"github.com/tobilg/duckdb_featureserv/internal/conf"
 	"github.com/tobilg/duckdb_featureserv/internal/data"
@@ -58,6 +61,9 @@ func initRouter(basePath string) *mux.Router {
 	addRoute(router, "/collections/{id}/items", handleCollectionItems)
 	addRoute(router, "/collections/{id}/items.{fmt}", handleCollectionItems)
 
+	addRoute(router, "/collections/{id}/queryables", handleQueryables)
+	addRoute(router, "/collections/{id}/queryables.{fmt}", handleQueryables)
+
 	addRoute(router, "/collections/{id}/items/{fid}", handleItem)
 	addRoute(router, "/collections/{id}/items/{fid}.{fmt}", handleItem)
 
@@ -102,6 +108,15 @@ func doRoot(w http.ResponseWriter, r *http.Request, format string) *appError {
 
 	switch format {
 	case api.FormatHTML:
+		colls, err := catalogInstance.Tables()
+		if err != nil {
+			return appErrorInternal(err, api.ErrMsgLoadCollections)
+		}
+		content.Collections = api.NewCollectionsInfo(colls).Collections
+		for _, coll := range content.Collections {
+			addCollectionURLs(coll, urlBase)
+		}
+
 		context := ui.NewPageData()
 		context.URLHome = urlPathFormat(urlBase, "", api.FormatHTML)
 		context.URLJSON = urlPathFormat(urlBase, api.RootPageName, api.FormatJSON)
@@ -171,7 +186,7 @@ func handleCollections(w http.ResponseWriter, r *http.Request) *appError {
 		case api.FormatHTML:
 			addCollectionURLs(coll, urlBase)
 		default:
-			coll.Links = linksCollection(coll.Name, urlBase, true)
+			coll.Links = append(linksCollection(coll.Name, urlBase, true), coll.Links...)
 		}
 	}
 
@@ -226,6 +241,12 @@ func linksCollection(name string, urlBase string, isSummary bool) []*api.Link {
 		Type:  api.ContentTypeGeoJSON,
 		Title: api.TitleFeatuuresGeoJSON})
 
+	links = append(links, &api.Link{
+		Href:  urlPath(urlBase, api.PathCollectionQueryables(name)),
+		Rel:   api.RelQueryables,
+		Type:  api.ContentTypeSchemaJSON,
+		Title: api.TitleQueryables})
+
 	return links
 }
 
@@ -245,10 +266,10 @@ func handleCollection(w http.ResponseWriter, r *http.Request) *appError {
 	if tbl == nil && err == nil {
 		return appErrorNotFoundFmt(err, api.ErrMsgCollectionNotFound, name)
 	}
-	catalogInstance.TableReload(name)
 	content := api.NewCollectionInfo(tbl)
 	content.GeometryType = &tbl.GeometryType
 	content.Properties = api.TableProperties(tbl)
+	content.Partitions = api.TablePartitions(tbl)
 
 	// --- encoding
 	switch format {
@@ -261,17 +282,57 @@ func handleCollection(w http.ResponseWriter, r *http.Request) *appError {
 		context.URLJSON = urlPathFormat(urlBase, api.PathCollection(name), api.FormatJSON)
 		context.URLItems = urlPathFormat(urlBase, pathItems, api.FormatHTML)
 		context.URLItemsJSON = urlPathFormat(urlBase, pathItems, api.FormatJSON)
+		context.URLQueryables = urlPathFormat(urlBase, api.PathCollectionQueryables(name), api.FormatHTML)
 		context.Title = tbl.Title
 		context.Table = tbl
 		context.IDColumn = tbl.IDColumn
 
 		return writeHTML(w, content, context, ui.PageCollection())
 	default:
-		content.Links = linksCollection(name, urlBase, false)
+		content.Links = append(linksCollection(name, urlBase, false), content.Links...)
 		return writeJSON(w, api.ContentTypeJSON, content)
 	}
 }
 
+func handleQueryables(w http.ResponseWriter, r *http.Request) *appError {
+	format := api.RequestedFormat(r)
+
+	// Check if HTML UI is disabled
+	if err := checkUIDisabled(format); err != nil {
+		return err
+	}
+
+	urlBase := serveURLBase(r)
+
+	name := getRequestVar(routeVarID, r)
+
+	tbl, err := catalogInstance.TableByName(name)
+	if err != nil {
+		return appErrorInternalFmt(err, api.ErrMsgCollectionAccess, name)
+	}
+	if tbl == nil {
+		return appErrorNotFoundFmt(err, api.ErrMsgCollectionNotFound, name)
+	}
+	pathQueryables := api.PathCollectionQueryables(name)
+	content := api.NewQueryables(tbl, urlPath(urlBase, pathQueryables))
+
+	// --- encoding
+	switch format {
+	case api.FormatHTML:
+		context := ui.NewPageData()
+		context.URLHome = urlPathFormat(urlBase, "", api.FormatHTML)
+		context.URLCollections = urlPathFormat(urlBase, api.TagCollections, api.FormatHTML)
+		context.URLCollection = urlPathFormat(urlBase, api.PathCollection(name), api.FormatHTML)
+		context.URLJSON = urlPathFormat(urlBase, pathQueryables, api.FormatJSON)
+		context.Title = tbl.Title
+		context.Table = tbl
+
+		return writeHTML(w, content, context, ui.PageQueryables())
+	default:
+		return writeJSON(w, api.ContentTypeSchemaJSON, content)
+	}
+}
+
 func handleCollectionItems(w http.ResponseWriter, r *http.Request) *appError {
 	// TODO: determine content from request header?
 	format := api.RequestedFormat(r)
@@ -281,6 +342,9 @@ func handleCollectionItems(w http.ResponseWriter, r *http.Request) *appError {
 		return err
 	}
 
+	if err := applyRequestBody(r); err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
 	urlBase := serveURLBase(r)
 	query := api.URLQuery(r.URL)
 
@@ -298,16 +362,39 @@ func handleCollectionItems(w http.ResponseWriter, r *http.Request) *appError {
 	if tbl == nil {
 		return appErrorNotFoundFmt(err1, api.ErrMsgCollectionNotFound, name)
 	}
-	param, err := createQueryParams(&reqParam, tbl.Columns, tbl.Srid)
+	err = checkCrs(&reqParam, tbl.Srid)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	param, err := createQueryParams(&reqParam, tbl.Columns, tbl.QueryableNames(), tbl.Srid)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	err = applyGeomColumn(param, reqParam.GeomColumn, tbl)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	err = applyGrouping(param, tbl.Columns, tbl.DbTypes)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	err = resolveSortBy(param.SortBy, querySortables(param, tableSortables(tbl)))
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	err = checkCursor(param, tbl)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	param.Filter, err = parseFilter(reqParam.Values, tableFilterTypes(tbl))
 	if err != nil {
 		return appErrorBadRequest(err, err.Error())
 	}
-	param.Filter = parseFilter(reqParam.Values, tbl.DbTypes)
 
 	ctx := r.Context()
 	switch format {
 	case api.FormatJSON:
-		return writeItemsJSON(ctx, w, name, param, urlBase)
+		return writeItemsJSON(ctx, w, name, param, urlBase, r.URL.Query())
 	case api.FormatHTML:
 		return writeItemsHTML(w, tbl, name, query, urlBase)
 	}
@@ -333,11 +420,19 @@ func writeItemsHTML(w http.ResponseWriter, tbl *data.Table, name string, query s
 	return writeHTML(w, nil, context, ui.PageItems())
 }
 
-func writeItemsJSON(ctx context.Context, w http.ResponseWriter, name string, param *data.QueryParam, urlBase string) *appError {
+func writeItemsJSON(ctx context.Context, w http.ResponseWriter, name string, param *data.QueryParam, urlBase string, query url.Values) *appError {
+	//--- count matching features concurrently with the features query
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	countChan := make(chan int64, 1)
+	go func() {
+		countChan <- queryFeatureCount(ctx, name, param)
+	}()
+
 	//--- query features data
-	features, err := catalogInstance.TableFeatures(ctx, name, param)
+	features, next, err := catalogInstance.TableFeatures(ctx, name, param)
 	if err != nil {
-		return appErrorInternalFmt(err, api.ErrMsgDataReadError, name)
+		return appErrorQuery(err, api.ErrMsgDataReadError, name)
 	}
 	if features == nil {
 		return appErrorNotFoundFmt(err, api.ErrMsgCollectionNotFound, name)
@@ -345,21 +440,111 @@ func writeItemsJSON(ctx context.Context, w http.ResponseWriter, name string, par
 
 	//--- assemble resonse
 	content := api.NewFeatureCollectionInfo(features)
-	content.Links = linksItems(name, urlBase)
+	count := <-countChan
+	isEstimated := conf.Configuration.NumberMatched(name) != conf.NumberMatchedExact
+	// an estimated count is at least the number of features up to the end of this page
+	if isEstimated && count >= 0 {
+		count = max(count, int64(param.Offset+len(features)))
+	}
+	if count >= 0 {
+		numberMatched := count
+		content.NumberMatched = &numberMatched
+	}
+	// an estimated count cannot determine whether there is a next page
+	if isEstimated {
+		count = -1
+	}
+	content.Links = linksItems(api.PathCollectionItems(name), urlBase, query, param, len(features), count, next)
 
+	setContentCrs(w, param.Crs)
 	return writeJSON(w, api.ContentTypeGeoJSON, content)
 }
 
-func linksItems(name string, urlBase string) []*api.Link {
-	path := api.PathCollectionItems(name)
-
-	var links []*api.Link
-	links = append(links, linkSelf(urlBase, path, api.TitleDocument))
-	links = append(links, linkAlt(urlBase, path, api.TitleDocument))
+// setContentCrs sets the response header giving the CRS of feature geometries
+func setContentCrs(w http.ResponseWriter, crs data.Crs) {
+	w.Header().Set(api.HeaderContentCrs, "<"+api.CrsURI(crs)+">")
+}
 
+// queryFeatureCount returns the number of features matching a query,
+// or -1 if it is not available.
+// A failed count does not fail the request, since numberMatched is optional
+func queryFeatureCount(ctx context.Context, name string, param *data.QueryParam) int64 {
+	count, err := catalogInstance.TableFeatureCount(ctx, name, param)
+	if err != nil {
+		log.Warnf("Unable to count features of %s: %v", name, err)
+		return -1
+	}
+	return count
+}
+
+// linksItems provides the links for a page of features.
+// The links keep the request query parameters.
+// The next link continues from the cursor after the last feature, if there is one,
+// and otherwise from the offset of the next page.
+// It is omitted on the last page, which is known from the number of features matched
+// if it is exact (non-negative), or otherwise from a page which is not full.
+// There is no prev link for a page after a cursor, since cursors only page forwards
+func linksItems(path string, urlBase string, query url.Values, param *data.QueryParam,
+	numReturned int, numMatched int64, next *data.Cursor) []*api.Link {
+	self := linkSelf(urlBase, path, api.TitleDocument)
+	alt := linkAlt(urlBase, path, api.TitleDocument)
+	if len(query) > 0 {
+		self.Href += "?" + query.Encode()
+		alt.Href += "?" + query.Encode()
+	}
+	links := []*api.Link{self, alt}
+
+	limit := data.ResultLimit(param.Limit)
+	if limit <= 0 {
+		return links
+	}
+	end := param.Offset + numReturned
+	isLastPage := numReturned < limit
+	if numMatched >= 0 && param.Cursor == nil {
+		isLastPage = int64(end) >= numMatched
+	}
+	if !isLastPage {
+		page := url.Values{}
+		if next != nil {
+			page.Set(api.ParamCursor, next.Encode())
+		} else {
+			page.Set(api.ParamOffset, strconv.Itoa(end))
+		}
+		links = append(links, linkPage(urlBase, path, query, page, api.RelNext, api.TitleNextPage))
+	}
+	if param.Offset > 0 && param.Cursor == nil {
+		page := url.Values{}
+		if prevOffset := param.Offset - limit; prevOffset > 0 {
+			page.Set(api.ParamOffset, strconv.Itoa(prevOffset))
+		}
+		links = append(links, linkPage(urlBase, path, query, page, api.RelPrev, api.TitlePrevPage))
+	}
 	return links
 }
 
+// linkPage provides a link to another page of features.
+// The paging parameters of the query are replaced by those of the page
+func linkPage(urlBase string, path string, query url.Values, page url.Values, rel string, title string) *api.Link {
+	pageQuery := url.Values{}
+	for key, vals := range query {
+		if !strings.EqualFold(key, api.ParamOffset) && !strings.EqualFold(key, api.ParamCursor) {
+			pageQuery[key] = vals
+		}
+	}
+	for key, vals := range page {
+		pageQuery[key] = vals
+	}
+	href := urlPath(urlBase, path)
+	if len(pageQuery) > 0 {
+		href += "?" + pageQuery.Encode()
+	}
+	return &api.Link{
+		Href:  href,
+		Rel:   rel,
+		Type:  api.ContentTypeGeoJSON,
+		Title: title}
+}
+
 func handleItem(w http.ResponseWriter, r *http.Request) *appError {
 	// TODO: determine content from request header?
 	format := api.RequestedFormat(r)
@@ -387,21 +572,28 @@ func handleItem(w http.ResponseWriter, r *http.Request) *appError {
 	if tbl == nil {
 		return appErrorNotFoundFmt(err1, api.ErrMsgCollectionNotFound, name)
 	}
-	param, errQuery := createQueryParams(&reqParam, tbl.Columns, tbl.Srid)
-
-	if errQuery == nil {
-		ctx := r.Context()
-		switch format {
-		case api.FormatJSON:
-			return writeItemJSON(ctx, w, name, fid, param, urlBase)
-		case api.FormatHTML:
-			return writeItemHTML(w, tbl, name, fid, query, urlBase)
-		default:
-			return nil
-		}
-	} else {
+	err = checkCrs(&reqParam, tbl.Srid)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	param, errQuery := createQueryParams(&reqParam, tbl.Columns, tbl.QueryableNames(), tbl.Srid)
+	if errQuery != nil {
 		return appErrorInternalFmt(errQuery, api.ErrMsgInvalidQuery)
 	}
+	err = applyGeomColumn(param, reqParam.GeomColumn, tbl)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+
+	ctx := r.Context()
+	switch format {
+	case api.FormatJSON:
+		return writeItemJSON(ctx, w, name, fid, param, urlBase)
+	case api.FormatHTML:
+		return writeItemHTML(w, tbl, name, fid, query, urlBase)
+	default:
+		return nil
+	}
 }
 
 func writeItemHTML(w http.ResponseWriter, tbl *data.Table, name string, fid string, query string, urlBase string) *appError {
@@ -428,7 +620,7 @@ func writeItemJSON(ctx context.Context, w http.ResponseWriter, name string, fid
 	//--- query data for request
 	feature, err := catalogInstance.TableFeature(ctx, name, fid, param)
 	if err != nil {
-		return appErrorInternalFmt(err, api.ErrMsgDataReadError, name)
+		return appErrorQuery(err, api.ErrMsgDataReadError, name)
 	}
 	if len(feature) == 0 {
 		return appErrorNotFoundFmt(nil, api.ErrMsgFeatureNotFound, fid)
@@ -439,6 +631,7 @@ func writeItemJSON(ctx context.Context, w http.ResponseWriter, name string, fid
 	// for now can't add links to feature JSON
 	//content.Links = linksItems(name, urlBase, api.FormatJSON)
 	encodedContent := []byte(feature)
+	setContentCrs(w, param.Crs)
 	writeResponse(w, api.ContentTypeGeoJSON, encodedContent)
 	return nil
 }
@@ -639,6 +832,9 @@ func handleFunctionItems(w http.ResponseWriter, r *http.Request) *appError {
 		return err
 	}
 
+	if err := applyRequestBody(r); err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
 	urlBase := serveURLBase(r)
 
 	//--- extract request parameters
@@ -653,7 +849,27 @@ func handleFunctionItems(w http.ResponseWriter, r *http.Request) *appError {
 	if fn == nil && err == nil {
 		return appErrorNotFoundFmt(err, api.ErrMsgFunctionNotFound, name)
 	}
-	param, err := createQueryParams(&reqParam, fn.OutNames, data.SRID_4326)
+	err = checkCrs(&reqParam, data.SRID_4326)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	param, err := createQueryParams(&reqParam, fn.OutNames, nil, data.SRID_4326)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	var geomCols []string
+	if fn.GeometryColumn != "" {
+		geomCols = []string{fn.GeometryColumn}
+	}
+	err = applyGrouping(param, fn.OutNames, fn.Types)
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	err = resolveSortBy(param.SortBy, querySortables(param, sortables(fn.OutNames, fn.Types, geomCols)))
+	if err != nil {
+		return appErrorBadRequest(err, err.Error())
+	}
+	param.Filter, err = parseFilter(reqParam.Values, functionFilterTypes(fn))
 	if err != nil {
 		return appErrorBadRequest(err, err.Error())
 	}
@@ -664,7 +880,7 @@ func handleFunctionItems(w http.ResponseWriter, r *http.Request) *appError {
 	switch format {
 	case api.FormatJSON:
 		if fn.IsGeometryFunction() {
-			return writeFunItemsGeoJSON(ctx, w, name, fnArgs, param, urlBase)
+			return writeFunItemsGeoJSON(ctx, w, name, fnArgs, param, urlBase, r.URL.Query())
 		}
 		return writeFunItemsJSON(ctx, w, name, fnArgs, param)
 	case api.FormatHTML:
@@ -702,11 +918,11 @@ func writeFunItemsHTML(w http.ResponseWriter, name string, query string, urlBase
 	return writeHTML(w, nil, context, ui.PageFunctionItems())
 }
 
-func writeFunItemsGeoJSON(ctx context.Context, w http.ResponseWriter, name string, args map[string]string, param *data.QueryParam, urlBase string) *appError {
+func writeFunItemsGeoJSON(ctx context.Context, w http.ResponseWriter, name string, args map[string]string, param *data.QueryParam, urlBase string, query url.Values) *appError {
 	//--- query features data
 	features, err := catalogInstance.FunctionFeatures(ctx, name, args, param)
 	if err != nil {
-		return appErrorInternalFmt(err, api.ErrMsgDataReadError, name)
+		return appErrorQuery(err, api.ErrMsgDataReadError, name)
 	}
 	if features == nil {
 		return appErrorNotFoundFmt(err, api.ErrMsgNoDataRead, name)
@@ -714,8 +930,9 @@ func writeFunItemsGeoJSON(ctx context.Context, w http.ResponseWriter, name strin
 
 	//--- assemble resonse
 	content := api.NewFeatureCollectionInfo(features)
-	content.Links = linksItems(name, urlBase)
+	content.Links = linksItems(api.PathFunctionItems(name), urlBase, query, param, len(features), -1, nil)
 
+	setContentCrs(w, param.Crs)
 	return writeJSON(w, api.ContentTypeGeoJSON, content)
 }
 
@@ -723,7 +940,7 @@ func writeFunItemsJSON(ctx context.Context, w http.ResponseWriter, name string,
 	//--- query features data
 	features, err := catalogInstance.FunctionData(ctx, name, args, param)
 	if err != nil {
-		return appErrorInternalFmt(err, api.ErrMsgFunctionAccess, name)
+		return appErrorQuery(err, api.ErrMsgFunctionAccess, name)
 	}
 	if features == nil {
 		return appErrorNotFoundFmt(err, api.ErrMsgNoDataRead, name)
@@ -735,7 +952,7 @@ func writeFunItemsText(ctx context.Context, w http.ResponseWriter, contentType s
 	//--- query features data
 	features, err := catalogInstance.FunctionData(ctx, name, args, param)
 	if err != nil {
-		return appErrorInternalFmt(err, api.ErrMsgFunctionAccess, name)
+		return appErrorQuery(err, api.ErrMsgFunctionAccess, name)
 	}
 	if features == nil {
 		return appErrorNotFoundFmt(err, api.ErrMsgNoDataRead, name)
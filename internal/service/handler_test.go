@@ -14,17 +14,20 @@ package service
 */
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/tobilg/duckdb_featureserv/internal/api"
@@ -78,6 +81,7 @@ func setup(path string) {
 				"ST_Centroid",
 				"ST_PointOnSurface",
 			},
+			CrsSrids: []int{3857},
 		},
 		Paging: conf.Paging{
 			LimitDefault: 10,
@@ -148,7 +152,10 @@ func TestCollectionResponse(t *testing.T) {
 	equals(t, tbl.Extent.Miny, v.Extent.Spatial.Extent[0][1], "Extent Minxy")
 	equals(t, tbl.Extent.Maxx, v.Extent.Spatial.Extent[0][2], "Extent Maxx")
 	equals(t, tbl.Extent.Maxy, v.Extent.Spatial.Extent[0][3], "Extent Maxy")
-	equals(t, "http://www.opengis.net/def/crs/EPSG/0/4326", v.Extent.Spatial.Crs, "Extent Crs")
+	equals(t, api.CrsURICRS84, v.Extent.Spatial.Crs, "Extent Crs")
+	equals(t, []string{api.CrsURICRS84, "http://www.opengis.net/def/crs/EPSG/0/4326", "http://www.opengis.net/def/crs/EPSG/0/3857"},
+		v.Crs, "supported CRSs")
+	equals(t, api.CrsURICRS84, v.StorageCrs, "storage CRS")
 	// check properties
 	equals(t, len(tbl.Columns), len(v.Properties), "Properties len")
 	for i := 0; i < len(v.Properties); i++ {
@@ -160,6 +167,18 @@ func TestCollectionResponse(t *testing.T) {
 	checkLink(t, v.Links[0], api.RelSelf, api.ContentTypeJSON, urlBase+path)
 	checkLink(t, v.Links[1], api.RelAlt, api.ContentTypeHTML, urlBase+path+".html")
 	checkLink(t, v.Links[2], api.RelItems, api.ContentTypeGeoJSON, urlBase+path+"/items")
+	checkLink(t, v.Links[3], api.RelQueryables, api.ContentTypeSchemaJSON, urlBase+path+"/queryables")
+
+	// check configured metadata
+	equals(t, tbl.Keywords, v.Keywords, "Keywords")
+	equals(t, tbl.License, v.License, "License")
+	equals(t, tbl.Attribution, v.Attribution, "Attribution")
+	checkLink(t, v.Links[4], "describedby", "text/html", "http://example.com/mock_a")
+
+	// check temporal extent, with an open end
+	equals(t, "2020-01-01T00:00:00Z", *v.Extent.Temporal.Interval[0][0], "Temporal extent start")
+	equals(t, (*string)(nil), v.Extent.Temporal.Interval[0][1], "Temporal extent end")
+	equals(t, api.TrsGregorian, v.Extent.Temporal.Trs, "Temporal extent Trs")
 }
 
 func TestCollectionItemsResponse(t *testing.T) {
@@ -176,6 +195,102 @@ func TestCollectionItemsResponse(t *testing.T) {
 	checkLink(t, v.Links[1], api.RelAlt, api.ContentTypeHTML, urlBase+path+".html")
 }
 
+func TestNumberMatched(t *testing.T) {
+	rr := doRequest(t, "/collections/mock_a/items?limit=2")
+	var v api.FeatureCollectionRaw
+	errUnMarsh := json.Unmarshal(readBody(rr), &v)
+	assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+	equals(t, 2, len(v.Features), "# features")
+	equals(t, int64(9), *v.NumberMatched, "numberMatched")
+
+	rr = doRequest(t, "/collections/mock_a/items?prop_b=1&prop_a=x")
+	var vNone api.FeatureCollectionRaw
+	errUnMarsh = json.Unmarshal(readBody(rr), &vNone)
+	assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+	assert(t, vNone.NumberMatched != nil, "numberMatched present")
+	equals(t, int64(0), *vNone.NumberMatched, "numberMatched is reported when zero")
+}
+
+// underCountCatalog reports fewer matching features than are returned,
+// as an estimated count can
+type underCountCatalog struct {
+	data.Catalog
+}
+
+func (cat underCountCatalog) TableFeatureCount(ctx context.Context, name string, param *data.QueryParam) (int64, error) {
+	return 0, nil
+}
+
+func TestNumberMatchedEstimated(t *testing.T) {
+	savedMode := conf.Configuration.Paging.NumberMatched
+	defer func() { conf.Configuration.Paging.NumberMatched = savedMode }()
+	conf.Configuration.Paging.NumberMatched = conf.NumberMatchedEstimated
+	catalogInstance = underCountCatalog{catalogMock}
+	defer func() { catalogInstance = catalogMock }()
+
+	rr := doRequest(t, "/collections/mock_a/items?limit=2&offset=3")
+	var v api.FeatureCollectionRaw
+	errUnMarsh := json.Unmarshal(readBody(rr), &v)
+	assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+	equals(t, 2, len(v.Features), "# features")
+	equals(t, int64(5), *v.NumberMatched, "estimate includes the features returned")
+}
+
+func TestPagingLinks(t *testing.T) {
+	path := "/collections/mock_a/items"
+	links := readItemsLinks(t, path+"?limit=4&properties=prop_a")
+	equals(t, 3, len(links), "# links on first page")
+	checkLink(t, links[0], api.RelSelf, api.ContentTypeJSON, urlBase+path+"?limit=4&properties=prop_a")
+	checkLink(t, links[2], api.RelNext, api.ContentTypeGeoJSON, urlBase+path+"?limit=4&offset=4&properties=prop_a")
+
+	links = readItemsLinks(t, path+"?limit=4&OFFSET=4&properties=prop_a")
+	equals(t, 4, len(links), "# links on middle page")
+	checkLink(t, links[2], api.RelNext, api.ContentTypeGeoJSON, urlBase+path+"?limit=4&offset=8&properties=prop_a")
+	checkLink(t, links[3], api.RelPrev, api.ContentTypeGeoJSON, urlBase+path+"?limit=4&properties=prop_a")
+
+	// last page, known from the number matched
+	links = readItemsLinks(t, path+"?limit=3&offset=6")
+	equals(t, 3, len(links), "# links on last page")
+	checkLink(t, links[2], api.RelPrev, api.ContentTypeGeoJSON, urlBase+path+"?limit=3&offset=3")
+}
+
+func TestCursorPaging(t *testing.T) {
+	path := "/collections/mock_b/items"
+	links := readItemsLinks(t, path+"?limit=40&offset=10&properties=prop_a")
+	equals(t, 4, len(links), "# links")
+	equals(t, api.RelNext, links[2].Rel, "next link")
+	nextURL, _ := url.Parse(links[2].Href)
+	nextQuery := nextURL.Query()
+	equals(t, "", nextQuery.Get(api.ParamOffset), "next page has no offset")
+	equals(t, "prop_a", nextQuery.Get(api.ParamProperties), "next page keeps properties")
+
+	// the next page follows the last feature, ID 50
+	var v api.FeatureCollectionRaw
+	rr := doRequest(t, path+"?limit=40&properties=prop_a&cursor="+nextQuery.Get(api.ParamCursor))
+	errUnMarsh := json.Unmarshal(readBody(rr), &v)
+	assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+	equals(t, 40, len(v.Features), "# features")
+	var first struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(*v.Features[0], &first)
+	equals(t, "51", first.ID, "first feature after cursor")
+	equals(t, 3, len(v.Links), "no prev link after cursor")
+	equals(t, api.RelNext, v.Links[2].Rel, "next link after cursor")
+
+	doRequestStatus(t, path+"?cursor=xyz", http.StatusBadRequest)
+	doRequestStatus(t, path+"?offset=10&cursor="+nextQuery.Get(api.ParamCursor), http.StatusBadRequest)
+	doRequestStatus(t, path+"?sortby=prop_b&cursor="+nextQuery.Get(api.ParamCursor), http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?cursor="+nextQuery.Get(api.ParamCursor), http.StatusBadRequest)
+}
+
+func readItemsLinks(t *testing.T, url string) []*api.Link {
+	var v api.FeatureCollectionRaw
+	errUnMarsh := json.Unmarshal(readBody(doRequest(t, url)), &v)
+	assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+	return v.Links
+}
+
 func TestFilterB(t *testing.T) {
 	rr := doRequest(t, "/collections/mock_a/items?prop_b=1")
 
@@ -206,6 +321,170 @@ func TestFilterBD(t *testing.T) {
 	equals(t, 1, len(v.Features), "# features")
 }
 
+func TestQueryables(t *testing.T) {
+	rr := doRequest(t, "/collections/mock_a/queryables")
+	equals(t, api.ContentTypeSchemaJSON, rr.Header().Get("Content-Type"), "content type")
+
+	var v api.Queryables
+	errUnMarsh := json.Unmarshal(readBody(rr), &v)
+	assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+	equals(t, api.QueryablesSchemaURI, v.Schema, "$schema")
+	equals(t, urlBase+"/collections/mock_a/queryables", v.ID, "$id")
+	equals(t, "object", v.Type, "type")
+	equals(t, 6, len(v.Properties), "# queryables")
+	equals(t, "geometry-point", v.Properties["geom"].Format, "geometry format")
+	equals(t, "primary-geometry", v.Properties["geom"].Role, "geometry role")
+	equals(t, "geometry-any", v.Properties["centroid"].Format, "secondary geometry format")
+	equals(t, catalogMock.TableDefs[0].JSONTypes[1], v.Properties["prop_b"].Type, "property type")
+	equals(t, catalogMock.TableDefs[0].ColDesc[1], v.Properties["prop_b"].Description, "property description")
+
+	doRequestStatus(t, "/collections/missing/queryables", http.StatusNotFound)
+}
+
+func TestQueryablesRestricted(t *testing.T) {
+	tbl, _ := catalogMock.TableByName("mock_a")
+	tbl.Queryables = []string{"geom", "prop_b"}
+	defer func() { tbl.Queryables = nil }()
+
+	var v api.Queryables
+	errUnMarsh := json.Unmarshal(readBody(doRequest(t, "/collections/mock_a/queryables")), &v)
+	assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+	equals(t, 2, len(v.Properties), "# queryables")
+
+	doRequest(t, "/collections/mock_a/items?filter=prop_b>1")
+	doRequestStatus(t, "/collections/mock_a/items?filter=prop_a='x'", http.StatusBadRequest)
+}
+
+func TestFilterLang(t *testing.T) {
+	path := "/collections/mock_a/items"
+	filterJSON := url.QueryEscape(`{"op":">","args":[{"property":"prop_b"},1]}`)
+	doRequest(t, path+"?filter-lang=cql2-json&filter="+filterJSON)
+	doRequest(t, path+"?filter-lang=CQL2-TEXT&filter=prop_b>1")
+	doRequestStatus(t, path+"?filter-lang=cql2-text&filter="+filterJSON, http.StatusBadRequest)
+	doRequestStatus(t, path+"?filter-lang=cql2-json&filter=prop_b>1", http.StatusBadRequest)
+	doRequestStatus(t, path+"?filter-lang=ecql&filter=prop_b>1", http.StatusBadRequest)
+}
+
+func TestPostItems(t *testing.T) {
+	path := "/collections/mock_a/items"
+	filterJSON := `{"op":">","args":[{"property":"prop_b"},1]}`
+	resp := doPostStatus(t, path+"?limit=4", `{"filter": `+filterJSON+`}`, http.StatusOK)
+	var v FeatureCollection
+	errUnMarsh := json.Unmarshal(readBody(resp), &v)
+	assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+	// links to other pages include the filter from the body
+	next, _ := url.Parse(v.Links[2].Href)
+	equals(t, api.RelNext, v.Links[2].Rel, "next link")
+	equals(t, filterJSON, next.Query().Get(api.ParamFilter), "next link filter")
+	equals(t, api.FilterLangCQL2JSON, next.Query().Get(api.ParamFilterLang), "next link filter-lang")
+
+	doPostStatus(t, path, `{"filter": "prop_b > 1", "limit": 2}`, http.StatusOK)
+	doPostStatus(t, path, `{"filter": "prop_b > 1", "filter-lang": "cql2-text"}`, http.StatusOK)
+	doPostStatus(t, path, ``, http.StatusOK)
+	doPostStatus(t, path, `{"filter": "prop_b > 1", "filter-lang": "cql2-json"}`, http.StatusBadRequest)
+	doPostStatus(t, path, `{"filter": {"op": "=="}}`, http.StatusBadRequest)
+	doPostStatus(t, path, `{"filter": `, http.StatusBadRequest)
+}
+
+func TestFilterOperators(t *testing.T) {
+	for url, num := range map[string]int{
+		"prop_b=1,3,5":             3,
+		"prop_b=2..4":              3,
+		"prop_b=7..":               3,
+		"prop_b=..2":               2,
+		"prop_a=prop*":             9,
+		"prop_a=x*":                0,
+		"prop_a=notnull":           9,
+		"prop_b=null":              0,
+		"prop_b=1..9&prop_a=propA": 9,
+	} {
+		var v FeatureCollection
+		errUnMarsh := json.Unmarshal(readBody(doRequest(t, "/collections/mock_a/items?"+url)), &v)
+		assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+		equals(t, num, len(v.Features), "# features for "+url)
+	}
+	doRequestStatus(t, "/collections/mock_a/items?prop_b=x", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?prop_b=1,x", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?prop_b=..", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?prop_b=1.5", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?prop_b=", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?prop_b=1,", http.StatusBadRequest)
+}
+
+func TestParsePropertyFilterValues(t *testing.T) {
+	for _, tc := range []struct {
+		dbType  string
+		val     string
+		isValid bool
+	}{
+		{"INTEGER", "-5", true},
+		{"INTEGER", "1..", true},
+		{"INTEGER", "..2", true},
+		{"INTEGER", "1.5", false},
+		{"INTEGER", "1e3", false},
+		{"INTEGER", "nan", false},
+		{"INTEGER", "inf", false},
+		{"INTEGER", "99999999999", false},
+		{"UTINYINT", "-1", false},
+		{"BIGINT", "99999999999", true},
+		{"INTEGER", "", false},
+		{"INTEGER", "1,", false},
+		{"INTEGER", "1,,2", false},
+		{"VARCHAR", "", false},
+		{"VARCHAR", "a,,b", false},
+		{"DOUBLE", "1e3", true},
+		{"DOUBLE", "nan", false},
+		{"DOUBLE", "-Inf", false},
+		{"DATE", "2020-01-01", true},
+		{"DATE", "2020-01-01..2020-12-31", true},
+		{"DATE", "2020-13-01", false},
+		{"DATE", "yesterday", false},
+		{"TIMESTAMP", "2020-01-01T12:00:00Z", true},
+		{"TIMESTAMP", "2020-01-01 12:00", false},
+		{"TIMESTAMPTZ", "2020-01-01T12:00:00+02:00,2021-01-01", true},
+	} {
+		_, err := parsePropertyFilter("p", tc.val, tc.dbType)
+		equals(t, tc.isValid, err == nil, fmt.Sprintf("%s value %q", tc.dbType, tc.val))
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	types := map[string]string{"name": "VARCHAR", "pop": "INTEGER", "geom": "GEOMETRY"}
+	conds, err := parseFilter(api.NameValMap{"pop": "100..", "name": "a*", "geom": "x", "limit": "1"}, types)
+	equals(t, nil, err, "filter error")
+	equals(t, []*data.PropertyFilter{
+		{Name: "name", Op: data.FilterOpLike, Value: "a*", DbType: "VARCHAR"},
+		{Name: "pop", Op: data.FilterOpRange, Value: "100..", Values: []string{"100", ""}, DbType: "INTEGER"},
+	}, conds, "filter conditions")
+
+	conds, _ = parseFilter(api.NameValMap{"name": "a,b", "pop": "notnull"}, types)
+	equals(t, []string{"a", "b"}, conds[0].Values, "IN values")
+	equals(t, data.FilterOpNotNull, conds[1].Op, "null check")
+
+	// parameter names are lower case, and matched to columns ignoring case
+	types = map[string]string{"RoadName": "VARCHAR", "Pop": "INTEGER", "pop": "INTEGER"}
+	conds, _ = parseFilter(api.NameValMap{"roadname": "x", "pop": "1"}, types)
+	equals(t, 2, len(conds), "# mixed case conditions")
+	equals(t, "RoadName", conds[0].Name, "mixed case column")
+	equals(t, "pop", conds[1].Name, "exact match preferred")
+}
+
+func TestParsePropertyFilterText(t *testing.T) {
+	cond, err := parsePropertyFilter("file", "a..b", "VARCHAR")
+	equals(t, nil, err, "text with range separator")
+	equals(t, &data.PropertyFilter{Name: "file", Op: data.FilterOpEq, Value: "a..b", DbType: "VARCHAR"}, cond, "text is not a range")
+
+	cond, _ = parsePropertyFilter("name", `Smith\, John`, "VARCHAR")
+	equals(t, &data.PropertyFilter{Name: "name", Op: data.FilterOpEq, Value: "Smith, John", DbType: "VARCHAR"}, cond, "escaped comma")
+
+	cond, _ = parsePropertyFilter("name", `Smith\, John,Doe\\,C:\dir`, "VARCHAR")
+	equals(t, data.FilterOpIn, cond.Op, "list with escapes")
+	equals(t, []string{"Smith, John", `Doe\`, `C:\dir`}, cond.Values, "list values with escapes")
+
+	cond, _ = parsePropertyFilter("name", `a\,*`, "VARCHAR")
+	equals(t, &data.PropertyFilter{Name: "name", Op: data.FilterOpLike, Value: "a,*", DbType: "VARCHAR"}, cond, "pattern with escaped comma")
+}
+
 func TestFilterBDNone(t *testing.T) {
 	rr := doRequest(t, "/collections/mock_c/items?prop_b=1&prop_d=2")
 
@@ -246,6 +525,105 @@ func TestSortByAsc(t *testing.T) {
 	equals(t, 9, len(v.Features), "# features")
 }
 
+func TestSortByMultiple(t *testing.T) {
+	doRequest(t, "/collections/mock_a/items?sortby=-prop_b,+PROP_A,-area(geom)")
+
+	rr := doRequestStatus(t, "/collections/mock_a/items?sortby=prop_b,nosuch", http.StatusBadRequest)
+	body := string(readBody(rr))
+	assert(t, strings.Contains(body, "nosuch"), "error names the column: "+body)
+	assert(t, strings.Contains(body, "prop_a, prop_b, prop_c, prop_d, area(geom), length(geom)"), "error lists sortables: "+body)
+
+	doRequestStatus(t, "/collections/mock_a/items?sortby=area(prop_a)", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?sortby=prop_a,", http.StatusBadRequest)
+}
+
+func TestParseSortBy(t *testing.T) {
+	sortBy, err := parseSortBy(api.NameValMap{api.ParamSortBy: "-Pop, +name,id,-length(geom)"})
+	equals(t, nil, err, "sortby error")
+	equals(t, []data.Sorting{
+		{Name: "Pop", IsDesc: true},
+		{Name: "name"},
+		{Name: "id"},
+		{Name: "geom", IsDesc: true, Measure: data.SortMeasureLength},
+	}, sortBy, "sortby columns")
+
+	sortables := []data.Sorting{{Name: "Pop"}, {Name: "pop"}, {Name: "Name"}}
+	sortBy = []data.Sorting{{Name: "pop"}, {Name: "POP"}, {Name: "name"}}
+	equals(t, nil, resolveSortBy(sortBy, sortables), "resolve error")
+	equals(t, []data.Sorting{{Name: "pop"}, {Name: "Pop"}, {Name: "Name"}}, sortBy, "resolved names")
+}
+
+func TestGroupByAggregate(t *testing.T) {
+	doRequest(t, "/collections/mock_a/items?groupby=prop_c,PROP_A&aggregate=count(*),sum(prop_b),max(prop_a)&sortby=-sum_prop_b")
+	doRequest(t, "/collections/mock_a/items?aggregate=avg(prop_d)")
+
+	rr := doRequestStatus(t, "/collections/mock_a/items?groupby=prop_c&sortby=prop_b", http.StatusBadRequest)
+	body := string(readBody(rr))
+	assert(t, strings.Contains(body, "Sortables are: prop_c"), "grouped features are sorted by group columns: "+body)
+
+	doRequestStatus(t, "/collections/mock_a/items?groupby=nosuch", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?groupby=centroid", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?groupby=prop_c&aggregate=sum(prop_a)", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?groupby=prop_c&aggregate=sum(nosuch)", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_b/items?groupby=prop_c&cursor="+data.NewCursor(nil, []interface{}{1}).Encode(), http.StatusBadRequest)
+
+	rr = doRequestStatus(t, "/collections/mock_a/items?aggregate=median(prop_b)", http.StatusBadRequest)
+	body = string(readBody(rr))
+	assert(t, strings.Contains(body, "count, sum, avg, min, max"), "error lists aggregate functions: "+body)
+}
+
+func TestParseAggregate(t *testing.T) {
+	aggs, err := parseAggregate(api.NameValMap{api.ParamAggregate: `count(*), SUM(pop),avg("Area")`})
+	equals(t, nil, err, "aggregate error")
+	equals(t, []data.Aggregate{
+		{Function: data.AggregateCount, Column: data.AggregateAll},
+		{Function: data.AggregateSum, Column: "pop"},
+		{Function: data.AggregateAvg, Column: "Area"},
+	}, aggs, "aggregates")
+	equals(t, "sum_pop", aggs[1].Name(), "aggregate property name")
+
+	for _, val := range []string{"sum(*)", "count", "count()", "sum(pop", "st_union(geom)"} {
+		_, err = parseAggregate(api.NameValMap{api.ParamAggregate: val})
+		assert(t, err != nil, "invalid aggregate: "+val)
+	}
+}
+
+func TestCrs(t *testing.T) {
+	rr := doRequest(t, "/collections/mock_a/items")
+	equals(t, "<"+api.CrsURICRS84+">", rr.Header().Get(api.HeaderContentCrs), "default Content-Crs")
+
+	rr = doRequest(t, "/collections/mock_a/items?crs=http://www.opengis.net/def/crs/EPSG/0/3857&bbox-crs=EPSG:4326&bbox=40,-120,50,-74")
+	equals(t, "<http://www.opengis.net/def/crs/EPSG/0/3857>", rr.Header().Get(api.HeaderContentCrs), "Content-Crs")
+	rr = doRequest(t, "/collections/mock_a/items/1?crs=[EPSG:4326]")
+	equals(t, "<http://www.opengis.net/def/crs/EPSG/0/4326>", rr.Header().Get(api.HeaderContentCrs), "feature Content-Crs")
+	doRequest(t, "/collections/mock_a/items?crs=4326&filter-crs=OGC:CRS84")
+
+	rr = doRequestStatus(t, "/collections/mock_a/items?crs=EPSG:2193", http.StatusBadRequest)
+	body := string(readBody(rr))
+	assert(t, strings.Contains(body, "EPSG/0/2193"), "error names the CRS: "+body)
+	doRequestStatus(t, "/collections/mock_a/items?bbox-crs=nosuch", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items/1?filter-crs=2193", http.StatusBadRequest)
+}
+
+func TestParseCrs(t *testing.T) {
+	for val, crs := range map[string]data.Crs{
+		"http://www.opengis.net/def/crs/OGC/1.3/CRS84": data.CRS84,
+		"OGC:CRS84":   data.CRS84,
+		"[OGC:CRS84]": data.CRS84,
+		"https://www.opengis.net/def/crs/EPSG/0/4326": {Srid: 4326, IsLatLon: true},
+		"EPSG:3857": {Srid: 3857},
+		"4326":      {Srid: 4326},
+	} {
+		actual, err := api.ParseCrs(val)
+		equals(t, nil, err, "CRS error")
+		equals(t, crs, actual, "CRS "+val)
+	}
+	for _, val := range []string{"", "EPSG:", "EPSG:x", "http://www.opengis.net/def/crs/OGC/1.3/CRS83", "-1"} {
+		_, err := api.ParseCrs(val)
+		assert(t, err != nil, "invalid CRS: "+val)
+	}
+}
+
 func TestLimit(t *testing.T) {
 	rr := doRequest(t, "/collections/mock_a/items?limit=3")
 
@@ -316,6 +694,17 @@ func TestTransformInvalid(t *testing.T) {
 	doRequestStatus(t, "/collections/mock_a/items?transform=centroid|envelope", http.StatusBadRequest)
 }
 
+func TestGeomColumn(t *testing.T) {
+	doRequest(t, "/collections/mock_a/items?geom-column=centroid")
+	doRequest(t, "/collections/mock_a/items?geom-column=geom")
+	doRequest(t, "/collections/mock_a/items/1?geom-column=centroid")
+}
+
+func TestGeomColumnInvalid(t *testing.T) {
+	doRequestStatus(t, "/collections/mock_a/items?geom-column=prop_a", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items/1?geom-column=nogeom", http.StatusBadRequest)
+}
+
 func TestBBox(t *testing.T) {
 	doRequest(t, "/collections/mock_a/items?bbox=1,2,3,4")
 	// TODO: add some tests
@@ -323,6 +712,60 @@ func TestBBox(t *testing.T) {
 
 func TestBBoxInvalid(t *testing.T) {
 	doRequestStatus(t, "/collections/mock_a/items?bbox=1,2,3,x", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?bbox=1,2,3,4,5", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?bbox=1,4,3,2", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?bbox=1,2,200,4", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?bbox=1,2,3,4,5,1", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?bbox=3000,0,1000,1000&bbox-crs=EPSG:3857", http.StatusBadRequest)
+}
+
+func TestParseBbox(t *testing.T) {
+	bbox, err := parseBbox(api.NameValMap{api.ParamBbox: "170,-50,-170,-30"})
+	equals(t, nil, err, "bbox error")
+	equals(t, &data.Extent{Minx: 170, Miny: -50, Maxx: -170, Maxy: -30}, bbox, "bbox")
+	equals(t, nil, checkBbox(bbox, data.CRS84), "antimeridian bbox")
+	assert(t, checkBbox(bbox, data.Crs{Srid: 4326, IsLatLon: true}) != nil, "latitudes out of order")
+
+	bbox, err = parseBbox(api.NameValMap{api.ParamBbox: "1,2,-10,3,4,100"})
+	equals(t, nil, err, "3D bbox error")
+	equals(t, &data.Extent{Minx: 1, Miny: 2, Minz: -10, Maxx: 3, Maxy: 4, Maxz: 100, HasZ: true}, bbox, "3D bbox")
+	equals(t, nil, checkBbox(bbox, data.CRS84), "3D bbox valid")
+}
+
+func TestDatetime(t *testing.T) {
+	doRequest(t, "/collections/mock_a/items?datetime=2020-01-01T00:00:00Z")
+	doRequest(t, "/collections/mock_a/items?datetime=2020-01-01/2020-06-30")
+	doRequest(t, "/collections/mock_a/items?datetime=../2020-06-30T00:00:00Z")
+	doRequest(t, "/collections/mock_a/items?datetime=2020-01-01T00:00:00%2B12:00/..")
+}
+
+func TestDatetimeInvalid(t *testing.T) {
+	doRequestStatus(t, "/collections/mock_a/items?datetime=2020-13-01", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?datetime=../..", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?datetime=2020-06-30/2020-01-01", http.StatusBadRequest)
+	doRequestStatus(t, "/collections/mock_a/items?datetime=2020-01-01/2020-02-01/2020-03-01", http.StatusBadRequest)
+}
+
+func TestParseDatetime(t *testing.T) {
+	dt, err := parseDatetime(api.NameValMap{api.ParamDatetime: "2020-01-01T10:00:00+02:00"})
+	equals(t, nil, err, "instant error")
+	equals(t, true, dt.IsInstant(), "instant")
+	equals(t, "2020-01-01T08:00:00Z", dt.Start.UTC().Format(time.RFC3339), "instant time")
+
+	dt, _ = parseDatetime(api.NameValMap{api.ParamDatetime: "2020-01-01"})
+	equals(t, false, dt.IsInstant(), "date is the whole day")
+	equals(t, "2020-01-01T00:00:00Z", dt.Start.Format(time.RFC3339), "date start")
+	equals(t, "2020-01-01T23:59:59.999999Z", dt.End.Format(time.RFC3339Nano), "date end")
+
+	dt, _ = parseDatetime(api.NameValMap{api.ParamDatetime: "../2020-06-30"})
+	equals(t, (*time.Time)(nil), dt.Start, "open start")
+	equals(t, "2020-06-30T23:59:59.999999Z", dt.End.Format(time.RFC3339Nano), "end date includes the day")
+
+	dt, _ = parseDatetime(api.NameValMap{api.ParamDatetime: "2020-01-01T00:00:00Z/"})
+	equals(t, (*time.Time)(nil), dt.End, "empty end is open")
+
+	dt, _ = parseDatetime(api.NameValMap{})
+	equals(t, (*data.TimeInterval)(nil), dt, "no datetime")
 }
 
 func TestProperties(t *testing.T) {
@@ -420,6 +863,11 @@ func TestHTMLCollections(t *testing.T) {
 func TestHTMLCollection(t *testing.T) {
 	doRequest(t, "/collections/mock_a.html")
 }
+func TestHTMLQueryables(t *testing.T) {
+	rr := doRequest(t, "/collections/mock_a/queryables.html")
+	assert(t, strings.Contains(rr.Body.String(), "geometry-point"), "queryables page lists geometry")
+	assert(t, strings.Contains(rr.Body.String(), "prop_b"), "queryables page lists properties")
+}
 func TestHTMLItems(t *testing.T) {
 	doRequest(t, "/collections/mock_a/items.html")
 }
@@ -468,6 +916,24 @@ func doRequestStatus(t *testing.T, url string,
 	return rr
 }
 
+func doPostStatus(t *testing.T, url string, body string,
+	statusExpected int) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", basePath+url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", api.ContentTypeJSON)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != statusExpected {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, statusExpected)
+	}
+	return rr
+}
+
 func checkCollection(tb testing.TB, coll *api.CollectionInfo, name string, title string) {
 	equals(tb, name, coll.Name, "Collection name")
 	equals(tb, title, coll.Title, "Collection title")
@@ -478,6 +944,7 @@ func checkCollection(tb testing.TB, coll *api.CollectionInfo, name string, title
 
 	pathItems := path + "/items"
 	checkLink(tb, coll.Links[2], api.RelItems, api.ContentTypeGeoJSON, urlBase+pathItems)
+	checkLink(tb, coll.Links[3], api.RelQueryables, api.ContentTypeSchemaJSON, urlBase+path+"/queryables")
 }
 func checkLink(tb testing.TB, link *api.Link, rel string, conType string, href string) {
 	equals(tb, rel, link.Rel, "Link rel")
@@ -898,3 +1365,48 @@ func TestCORSHeadersJSONEndpoints(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryErrorException(t *testing.T) {
+	handler := func(err error) appHandler {
+		return func(w http.ResponseWriter, r *http.Request) *appError {
+			return appErrorQuery(fmt.Errorf("reading: %w", err), api.ErrMsgDataReadError, "mock_a")
+		}
+	}
+	tests := []struct {
+		err    error
+		path   string
+		status int
+		code   string
+	}{
+		{context.DeadlineExceeded, "/collections/mock_a/items.html", http.StatusGatewayTimeout, "GatewayTimeout"},
+		{context.Canceled, "/collections/mock_a/items", http.StatusServiceUnavailable, "ServiceUnavailable"},
+		{fmt.Errorf("Binder Error"), "/collections/mock_a/items.json", http.StatusInternalServerError, "InternalServerError"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		handler(tt.err).ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		equals(t, tt.status, rr.Code, "status")
+		equals(t, api.ContentTypeJSON, rr.Header().Get("Content-Type"), "content type")
+
+		var ex api.Exception
+		errUnMarsh := json.Unmarshal(readBody(rr), &ex)
+		assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+		equals(t, tt.code, ex.Code, "exception code")
+		assert(t, strings.Contains(ex.Description, "mock_a"), "exception description: "+ex.Description)
+	}
+}
+
+// TestErrorFormat tests that other errors are only returned as exceptions for JSON requests
+func TestErrorFormat(t *testing.T) {
+	rr := doRequestStatus(t, "/collections/missing/items", http.StatusNotFound)
+	assert(t, strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain"), "plain text error")
+	rr = doRequestStatus(t, "/collections/mock_a/items.html?limit=x", http.StatusBadRequest)
+	assert(t, strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain"), "plain text error for HTML")
+
+	rr = doRequestStatus(t, "/collections/missing/items.json", http.StatusNotFound)
+	equals(t, api.ContentTypeJSON, rr.Header().Get("Content-Type"), "exception for JSON request")
+	var ex api.Exception
+	errUnMarsh := json.Unmarshal(readBody(rr), &ex)
+	assert(t, errUnMarsh == nil, fmt.Sprintf("%v", errUnMarsh))
+	equals(t, "NotFound", ex.Code, "exception code")
+}
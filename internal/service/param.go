@@ -14,11 +14,17 @@ package service
 */
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tobilg/duckdb_featureserv/internal/api"
 	"github.com/tobilg/duckdb_featureserv/internal/conf"
@@ -31,17 +37,19 @@ func parseRequestParams(r *http.Request) (api.RequestParam, error) {
 	paramValues := extractSingleArgs(queryValues)
 
 	param := api.RequestParam{
-		Crs:       data.SRID_4326,
-		Limit:     conf.Configuration.Paging.LimitDefault,
-		Offset:    0,
-		Precision: -1,
-		BboxCrs:   data.SRID_4326,
-		Filter:    "",
-		Values:    paramValues,
+		Crs:        data.CRS84,
+		Limit:      conf.Configuration.Paging.LimitDefault,
+		Offset:     0,
+		Precision:  -1,
+		BboxCrs:    data.CRS84,
+		FilterCrs:  data.CRS84,
+		FilterLang: api.FilterLangCQL2Text,
+		Filter:     "",
+		Values:     paramValues,
 	}
 
 	// --- crs parameter
-	crs, err := parseInt(paramValues, api.ParamCrs, 0, 99999999, data.SRID_4326)
+	crs, err := parseCrs(paramValues, api.ParamCrs)
 	if err != nil {
 		return param, err
 	}
@@ -61,6 +69,13 @@ func parseRequestParams(r *http.Request) (api.RequestParam, error) {
 	}
 	param.Offset = offset
 
+	// --- cursor parameter
+	cursor, err := parseCursor(paramValues)
+	if err != nil {
+		return param, err
+	}
+	param.Cursor = cursor
+
 	// --- bbox parameter
 	bbox, err := parseBbox(paramValues)
 	if err != nil {
@@ -69,22 +84,42 @@ func parseRequestParams(r *http.Request) (api.RequestParam, error) {
 	param.Bbox = bbox
 
 	// --- bbox-crs parameter
-	bboxcrs, err := parseInt(paramValues, api.ParamBboxCrs, 0, 99999999, data.SRID_4326)
+	bboxcrs, err := parseCrs(paramValues, api.ParamBboxCrs)
 	if err != nil {
 		return param, err
 	}
 	param.BboxCrs = bboxcrs
+	if err := checkBbox(bbox, bboxcrs); err != nil {
+		return param, err
+	}
+
+	// --- datetime parameter
+	datetime, err := parseDatetime(paramValues)
+	if err != nil {
+		return param, err
+	}
+	param.Datetime = datetime
 
 	// --- filter parameter
 	param.Filter = parseString(paramValues, api.ParamFilter)
 
 	// --- filter-crs parameter
-	filterCrs, err := parseInt(paramValues, api.ParamFilterCrs, 0, 99999999, data.SRID_4326)
+	filterCrs, err := parseCrs(paramValues, api.ParamFilterCrs)
 	if err != nil {
 		return param, err
 	}
 	param.FilterCrs = filterCrs
 
+	// --- filter-lang parameter
+	filterLang, err := parseFilterLang(paramValues)
+	if err != nil {
+		return param, err
+	}
+	param.FilterLang = filterLang
+
+	// --- geom-column parameter
+	param.GeomColumn = parseString(paramValues, api.ParamGeomColumn)
+
 	// --- properties parameter
 	props, err := parseProperties(paramValues)
 	if err != nil {
@@ -92,13 +127,20 @@ func parseRequestParams(r *http.Request) (api.RequestParam, error) {
 	}
 	param.Properties = props
 
-	// --- orderBy parameter
+	// --- groupBy parameter
 	groupBy, err := parseGroupBy(paramValues)
 	if err != nil {
 		return param, err
 	}
 	param.GroupBy = groupBy
 
+	// --- aggregate parameter
+	aggregates, err := parseAggregate(paramValues)
+	if err != nil {
+		return param, err
+	}
+	param.Aggregates = aggregates
+
 	// --- orderBy parameter (DEPRECATED)
 	orderBy, err := parseOrderBy(paramValues)
 	if err != nil {
@@ -129,6 +171,42 @@ func parseRequestParams(r *http.Request) (api.RequestParam, error) {
 	return param, nil
 }
 
+// applyRequestBody adds the members of the JSON body of a POST request to its query parameters,
+// so they are handled in the same way (including in links to other pages).
+// Non-string members such as CQL2-JSON filters are added as JSON text.
+// A filter given as an object is CQL2-JSON, unless filter-lang is provided
+func applyRequestBody(r *http.Request) error {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return nil
+	}
+	var body map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf(api.ErrMsgInvalidRequestBody, err)
+	}
+	query := r.URL.Query()
+	for key, raw := range body {
+		var val string
+		if json.Unmarshal(raw, &val) != nil {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, raw); err != nil {
+				return fmt.Errorf(api.ErrMsgInvalidRequestBody, err)
+			}
+			val = buf.String()
+		}
+		query.Set(key, val)
+	}
+	filter := bytes.TrimSpace(body[api.ParamFilter])
+	if len(filter) > 0 && filter[0] == '{' && query.Get(api.ParamFilterLang) == "" {
+		query.Set(api.ParamFilterLang, api.FilterLangCQL2JSON)
+	}
+	r.URL.RawQuery = query.Encode()
+	return nil
+}
+
 func extractSingleArgs(queryArgs url.Values) api.NameValMap {
 	vals := make(map[string]string)
 	for keyRaw := range queryArgs {
@@ -174,6 +252,45 @@ func parseInt(values api.NameValMap, key string, minVal int, maxVal int, default
 	return val, nil
 }
 
+// parseCrs parses a CRS parameter, which is CRS84 if not present
+func parseCrs(values api.NameValMap, key string) (data.Crs, error) {
+	val := values[key]
+	if len(val) < 1 {
+		return data.CRS84, nil
+	}
+	crs, err := api.ParseCrs(val)
+	if err != nil {
+		return crs, fmt.Errorf(api.ErrMsgInvalidParameterValue, key, val)
+	}
+	return crs, nil
+}
+
+// parseFilterLang parses the filter-lang parameter, which is CQL2 text if not present
+func parseFilterLang(values api.NameValMap) (string, error) {
+	val := values[api.ParamFilterLang]
+	if len(val) < 1 {
+		return api.FilterLangCQL2Text, nil
+	}
+	lang := strings.ToLower(val)
+	if lang != api.FilterLangCQL2Text && lang != api.FilterLangCQL2JSON {
+		return "", fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamFilterLang, val)
+	}
+	return lang, nil
+}
+
+// parseCursor decodes the cursor of a keyset page
+func parseCursor(values api.NameValMap) (*data.Cursor, error) {
+	val := values[api.ParamCursor]
+	if len(val) < 1 {
+		return nil, nil
+	}
+	cursor, err := data.ParseCursor(val)
+	if err != nil {
+		return nil, fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamCursor, val)
+	}
+	return cursor, nil
+}
+
 func parseLimit(values api.NameValMap) (int, error) {
 	val := values[api.ParamLimit]
 	if len(val) < 1 {
@@ -191,7 +308,8 @@ func parseLimit(values api.NameValMap) (int, error) {
 
 /*
 parseBbox parses the bbox query parameter, if present, or nll if not
-This has the format bbox=minLon,minLat,maxLon,maxLat.
+This has the format bbox=minx,miny,maxx,maxy,
+or bbox=minx,miny,minz,maxx,maxy,maxz for a 3D bbox.
 */
 func parseBbox(values api.NameValMap) (*data.Extent, error) {
 	val := values[api.ParamBbox]
@@ -199,31 +317,120 @@ func parseBbox(values api.NameValMap) (*data.Extent, error) {
 		return nil, nil
 	}
 	nums := strings.Split(val, ",")
-	var isErr = false
-	if len(nums) != 4 {
+	if len(nums) != 4 && len(nums) != 6 {
 		return nil, fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamBbox, val)
 	}
-	minLon, err := strconv.ParseFloat(nums[0], 64)
-	if err != nil {
-		isErr = true
+	coords := make([]float64, len(nums))
+	for i, num := range nums {
+		coord, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+		if err != nil || math.IsNaN(coord) || math.IsInf(coord, 0) {
+			return nil, fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamBbox, val)
+		}
+		coords[i] = coord
 	}
-	minLat, err := strconv.ParseFloat(nums[1], 64)
-	if err != nil {
-		isErr = true
+	if len(coords) == 6 {
+		return &data.Extent{Minx: coords[0], Miny: coords[1], Minz: coords[2],
+			Maxx: coords[3], Maxy: coords[4], Maxz: coords[5], HasZ: true}, nil
 	}
-	maxLon, err := strconv.ParseFloat(nums[2], 64)
-	if err != nil {
-		isErr = true
+	var bbox = data.Extent{Minx: coords[0], Miny: coords[1], Maxx: coords[2], Maxy: coords[3]}
+	return &bbox, nil
+}
+
+/*
+checkBbox checks that a bbox is valid in its CRS.
+The minimums must not be greater than the maximums,
+except for the longitudes of a bbox crossing the antimeridian.
+Geographic coordinates must be valid longitudes and latitudes.
+*/
+func checkBbox(bbox *data.Extent, crs data.Crs) error {
+	if bbox == nil {
+		return nil
 	}
-	maxLat, err := strconv.ParseFloat(nums[3], 64)
-	if err != nil {
-		isErr = true
+	xy := bbox.XY(crs)
+	isValid := xy.Miny <= xy.Maxy && (xy.Minx <= xy.Maxx || bbox.CrossesAntimeridian(crs))
+	if bbox.HasZ {
+		isValid = isValid && bbox.Minz <= bbox.Maxz
 	}
-	if isErr {
-		return nil, fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamBbox, val)
+	if crs.IsGeographic() {
+		isValid = isValid && isLongitude(xy.Minx) && isLongitude(xy.Maxx) &&
+			isLatitude(xy.Miny) && isLatitude(xy.Maxy)
 	}
-	var bbox = data.Extent{Minx: minLon, Miny: minLat, Maxx: maxLon, Maxy: maxLat}
-	return &bbox, nil
+	if !isValid {
+		return fmt.Errorf(api.ErrMsgInvalidBbox, api.CrsURI(crs))
+	}
+	return nil
+}
+
+func isLongitude(val float64) bool {
+	return val >= -180 && val <= 180
+}
+
+func isLatitude(val float64) bool {
+	return val >= -90 && val <= 90
+}
+
+/*
+parseDatetime parses the datetime query parameter, if present, or nil if not.
+This is an instant, or an interval with ".." or an empty value for an open end:
+datetime=2020-01-01T00:00:00Z, datetime=2020-01-01/2020-06-30, datetime=../2020-06-30.
+A date is the whole day, so as an interval end it includes that day
+*/
+func parseDatetime(values api.NameValMap) (*data.TimeInterval, error) {
+	val := values[api.ParamDatetime]
+	if len(val) < 1 {
+		return nil, nil
+	}
+	errInvalid := fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamDatetime, val)
+	parts := strings.Split(val, "/")
+	if len(parts) > 2 {
+		return nil, errInvalid
+	}
+	if len(parts) == 1 {
+		start, end, err := parseTime(parts[0])
+		if err != nil {
+			return nil, errInvalid
+		}
+		return &data.TimeInterval{Start: &start, End: &end}, nil
+	}
+	interval := &data.TimeInterval{}
+	if !isOpenTime(parts[0]) {
+		start, _, err := parseTime(parts[0])
+		if err != nil {
+			return nil, errInvalid
+		}
+		interval.Start = &start
+	}
+	if !isOpenTime(parts[1]) {
+		_, end, err := parseTime(parts[1])
+		if err != nil {
+			return nil, errInvalid
+		}
+		interval.End = &end
+	}
+	if interval.Start == nil && interval.End == nil {
+		return nil, errInvalid
+	}
+	if interval.Start != nil && interval.End != nil && interval.Start.After(*interval.End) {
+		return nil, errInvalid
+	}
+	return interval, nil
+}
+
+// parseTime parses an RFC 3339 date-time, or a date.
+// It returns the start and end of the time, which differ for a date
+func parseTime(val string) (time.Time, time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return t, t, nil
+	}
+	day, err := time.Parse(time.DateOnly, val)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return day, day.Add(24*time.Hour - time.Microsecond), nil
+}
+
+func isOpenTime(val string) bool {
+	return val == "" || val == ".."
 }
 
 // parseProperties extracts an array of raw property names to be included
@@ -263,35 +470,134 @@ func parseGroupBy(values api.NameValMap) ([]string, error) {
 	if !ok || len(val) < 1 {
 		return []string{}, nil
 	}
-	// TODO: normalize col names
-	// return array of raw col names
-	namesRaw := strings.Split(val, ",")
-	return namesRaw, nil
+	// col names are resolved against the query columns
+	var names []string
+	for _, name := range strings.Split(val, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names, nil
+}
+
+// parseAggregate determines the aggregates to compute for groups of features,
+// from a list such as count(*),sum(pop),avg(area).
+// Functions must be in the aggregate function allow-list
+func parseAggregate(values api.NameValMap) ([]data.Aggregate, error) {
+	val := values[api.ParamAggregate]
+	if len(val) < 1 {
+		return nil, nil
+	}
+	var aggs []data.Aggregate
+	for _, spec := range strings.Split(val, ",") {
+		spec = strings.TrimSpace(spec)
+		open := strings.Index(spec, "(")
+		if open <= 0 || !strings.HasSuffix(spec, ")") {
+			return nil, fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamAggregate, spec)
+		}
+		fun := strings.ToLower(strings.TrimSpace(spec[:open]))
+		col := strings.TrimSpace(spec[open+1 : len(spec)-1])
+		col = strings.Trim(col, `"`)
+		isAll := col == data.AggregateAll
+		if !toNameSet(data.AggregateFunctions)[fun] || (isAll && fun != data.AggregateCount) {
+			return nil, fmt.Errorf(api.ErrMsgInvalidAggregate, spec, strings.Join(data.AggregateFunctions, ", "))
+		}
+		if col == "" {
+			return nil, fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamAggregate, spec)
+		}
+		aggs = append(aggs, data.Aggregate{Function: fun, Column: col})
+	}
+	return aggs, nil
 }
 
-// parseSortBy determines an Sorting array
+// parseSortBy determines a Sorting array from a list of columns,
+// each optionally prefixed by + (ascending) or - (descending).
+// A geometry measure is given as measure(column), for example sortby=-area(geom)
 func parseSortBy(values api.NameValMap) ([]data.Sorting, error) {
 	var sorting []data.Sorting
 	val := values[api.ParamSortBy]
 	if len(val) < 1 {
 		return sorting, nil
 	}
-	valLow := strings.ToLower(val)
-	sortCols := strings.Split(valLow, ",")
-	sortCol := sortCols[0]
-	isDesc := false
-	name := strings.TrimSpace(sortCol)
-	if strings.HasPrefix(name, "+") {
-		name = strings.TrimSpace(name[1:])
-		isDesc = false
-	} else if strings.HasPrefix(name, "-") {
-		name = strings.TrimSpace(name[1:])
-		isDesc = true
-	}
-	sorting = append(sorting, data.Sorting{Name: name, IsDesc: isDesc})
+	for _, spec := range strings.Split(val, ",") {
+		name := strings.TrimSpace(spec)
+		isDesc := false
+		if strings.HasPrefix(name, "+") {
+			name = strings.TrimSpace(name[1:])
+		} else if strings.HasPrefix(name, "-") {
+			name = strings.TrimSpace(name[1:])
+			isDesc = true
+		}
+		sort := data.Sorting{Name: name, IsDesc: isDesc}
+		if open := strings.Index(name, "("); open > 0 && strings.HasSuffix(name, ")") {
+			sort.Measure = strings.ToLower(strings.TrimSpace(name[:open]))
+			sort.Name = strings.TrimSpace(name[open+1 : len(name)-1])
+		}
+		if sort.Name == "" {
+			return nil, fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamSortBy, val)
+		}
+		sorting = append(sorting, sort)
+	}
 	return sorting, nil
 }
 
+// sortables lists what features can be sorted by:
+// the non-geometry columns, and the measures of the geometry columns
+func sortables(columns []string, dbTypes map[string]string, geomColumns []string) []data.Sorting {
+	geomSet := toNameSet(geomColumns)
+	var sorts []data.Sorting
+	for _, col := range columns {
+		if !geomSet[col] && !isGeometryType(dbTypes[col]) {
+			sorts = append(sorts, data.Sorting{Name: col})
+		}
+	}
+	for _, col := range geomColumns {
+		for _, measure := range data.SortMeasures {
+			sorts = append(sorts, data.Sorting{Name: col, Measure: measure})
+		}
+	}
+	return sorts
+}
+
+// tableSortables lists what the features of a table can be sorted by,
+// including the ID column
+func tableSortables(tbl *data.Table) []data.Sorting {
+	cols := tbl.Columns
+	if _, ok := toNameSet(cols)[tbl.IDColumn]; tbl.IDColumn != "" && !ok {
+		cols = append([]string{tbl.IDColumn}, cols...)
+	}
+	geomCols := tbl.GeometryColumns
+	if len(geomCols) == 0 && tbl.GeometryColumn != "" {
+		geomCols = []string{tbl.GeometryColumn}
+	}
+	return sortables(cols, tbl.DbTypes, geomCols)
+}
+
+// resolveSortBy checks that sort columns are sortable, and resolves their names to the column names.
+// Names are matched exactly, or otherwise ignoring case.
+// The error for an unknown column lists the sortables
+func resolveSortBy(sortBy []data.Sorting, sortables []data.Sorting) error {
+	for i, sort := range sortBy {
+		match := -1
+		for j, sortable := range sortables {
+			if sortable.Measure != sort.Measure || !strings.EqualFold(sortable.Name, sort.Name) {
+				continue
+			}
+			if match < 0 || sortable.Name == sort.Name {
+				match = j
+			}
+		}
+		if match < 0 {
+			specs := make([]string, len(sortables))
+			for j, sortable := range sortables {
+				specs[j] = sortable.String()
+			}
+			spec := data.Sorting{Name: sort.Name, Measure: sort.Measure}
+			return fmt.Errorf(api.ErrMsgInvalidSortBy, spec, strings.Join(specs, ", "))
+		}
+		sortBy[i].Name = sortables[match].Name
+	}
+	return nil
+}
+
 // parseOrderBy determines an order by array (DEPRECATED)
 func parseOrderBy(values api.NameValMap) ([]data.Sorting, error) {
 	var orderBy []data.Sorting
@@ -425,55 +731,346 @@ func parseTransformFun(def string) data.TransformFunction {
 	return data.TransformFunction{Name: name, Arg: args}
 }
 
-// parseFilter creates a filter list from applicable query parameters
-func parseFilter(paramMap map[string]string, colNameMap map[string]string) []*data.PropertyFilter {
+/*
+parseFilter creates a filter list from the query parameters which are property names.
+The value of a parameter may be:
+  - a value, which the property is equal to
+  - a comma-separated list of values, one of which the property is equal to.
+    A comma in a value is escaped as \, and a backslash before a comma as \\
+  - for numeric and temporal properties, a range low..high, inclusive,
+    which may be open by omitting either bound
+  - a pattern with * wildcards, matching any characters
+  - null or notnull, to test whether the property has a value
+
+Values must be valid for the property type, given by colTypes.
+Parameter names are matched to property names exactly, or otherwise ignoring case.
+Geometry properties cannot be filtered.
+*/
+func parseFilter(paramMap map[string]string, colTypes map[string]string) ([]*data.PropertyFilter, error) {
+	colNames := make([]string, 0, len(colTypes))
+	for name := range colTypes {
+		colNames = append(colNames, name)
+	}
+	// a stable choice of column among names differing only in case
+	sort.Strings(colNames)
+	paramNames := make(map[string]string)
+	var names []string
+	for param := range paramMap {
+		name := resolveColumnName(param, colNames)
+		if name != "" && !api.IsParameterReservedName(param) && !isGeometryType(colTypes[name]) {
+			paramNames[name] = param
+			names = append(names, name)
+		}
+	}
+	// a stable order of conditions
+	sort.Strings(names)
 	var conds []*data.PropertyFilter
-	for name, val := range paramMap {
-		//log.Debugf("testing request param %v", name)
-		if api.IsParameterReservedName(name) {
+	for _, name := range names {
+		val := paramMap[paramNames[name]]
+		cond, err := parsePropertyFilter(name, val, colTypes[name])
+		if err != nil {
+			return nil, fmt.Errorf(api.ErrMsgInvalidParameterValue, name, val)
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+// tableFilterTypes are the types of the queryable columns of a table
+func tableFilterTypes(tbl *data.Table) map[string]string {
+	types := make(map[string]string)
+	for _, name := range tbl.QueryableNames() {
+		types[name] = tbl.DbTypes[name]
+	}
+	return types
+}
+
+// functionFilterTypes are the types of the function output columns which can be filtered.
+// A column with the same name as a function argument cannot be,
+// since the query parameter is the argument value
+func functionFilterTypes(fn *data.Function) map[string]string {
+	types := make(map[string]string, len(fn.Types))
+	for name, dbType := range fn.Types {
+		types[name] = dbType
+	}
+	removeNames(types, fn.InNames)
+	return types
+}
+
+const (
+	filterNull      = "null"
+	filterNotNull   = "notnull"
+	filterRangeSep  = ".."
+	filterValuesSep = ','
+	filterEscape    = '\\'
+)
+
+// parsePropertyFilter parses the filter condition for the value of a property parameter
+func parsePropertyFilter(name string, val string, dbType string) (*data.PropertyFilter, error) {
+	cond := &data.PropertyFilter{Name: name, Op: data.FilterOpEq, Value: val, DbType: dbType}
+	switch {
+	case val == filterNull:
+		cond.Op = data.FilterOpIsNull
+		return cond, nil
+	case val == filterNotNull:
+		cond.Op = data.FilterOpNotNull
+		return cond, nil
+	case isRangeType(dbType) && strings.Contains(val, filterRangeSep):
+		low, high, _ := strings.Cut(val, filterRangeSep)
+		if low == "" && high == "" {
+			return nil, fmt.Errorf("range has no bounds")
+		}
+		cond.Op = data.FilterOpRange
+		cond.Values = []string{low, high}
+	default:
+		values := splitFilterValues(val)
+		if len(values) > 1 {
+			cond.Op = data.FilterOpIn
+			cond.Values = values
+			break
+		}
+		cond.Value = values[0]
+		if strings.Contains(cond.Value, data.FilterWildcard) {
+			// a pattern is matched against the text of the value
+			cond.Op = data.FilterOpLike
+			return cond, nil
+		}
+	}
+	values := cond.Values
+	if values == nil {
+		values = []string{cond.Value}
+	}
+	for _, value := range values {
+		// only the bounds of a range may be omitted
+		if value == "" && cond.Op == data.FilterOpRange {
 			continue
 		}
-		if _, ok := colNameMap[name]; ok {
-			cond := &data.PropertyFilter{Name: name, Value: val}
-			conds = append(conds, cond)
-			//log.Debugf("Adding filter %v = %v ", name, val)
+		if value == "" || !isValidValue(value, dbType) {
+			return nil, fmt.Errorf("invalid value for type %v: %q", dbType, value)
 		}
 	}
-	return conds
+	return cond, nil
 }
 
-// createQueryParams applies any cross-parameter logic
-func createQueryParams(param *api.RequestParam, colNames []string, sourceSRID int) (*data.QueryParam, error) {
+// isRangeType tests whether a property type is ordered so that it can be filtered by a range.
+// Ranges of text values are not supported, so that text containing .. can be matched
+func isRangeType(dbType string) bool {
+	return data.IsNumericType(dbType) || data.IsTemporalType(dbType)
+}
+
+// splitFilterValues splits a comma-separated list of filter values.
+// An escaped comma is part of a value, as is an escaped backslash
+// (which allows a value to end with a backslash).
+// Other backslashes are kept as they are
+func splitFilterValues(val string) []string {
+	var values []string
+	var value strings.Builder
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		switch {
+		case c == filterEscape && i+1 < len(val) && (val[i+1] == filterValuesSep || val[i+1] == filterEscape):
+			i++
+			value.WriteByte(val[i])
+		case c == filterValuesSep:
+			values = append(values, value.String())
+			value.Reset()
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return append(values, value.String())
+}
+
+// isValidValue tests whether a value can be converted to a numeric, boolean or temporal property type.
+// Values for other types are compared as text
+func isValidValue(val string, dbType string) bool {
+	switch {
+	case data.IsIntegerType(dbType):
+		return data.IsIntegerValue(val, dbType)
+	case data.IsNumericType(dbType):
+		num, err := strconv.ParseFloat(val, 64)
+		return err == nil && !math.IsNaN(num) && !math.IsInf(num, 0)
+	case data.IsBooleanType(dbType):
+		_, err := strconv.ParseBool(val)
+		return err == nil
+	case data.IsTemporalType(dbType):
+		// the same forms as the datetime parameter
+		_, _, err := parseTime(val)
+		return err == nil
+	}
+	return true
+}
+
+// applyGeomColumn sets the geometry column to output and filter.
+// If it is not the primary geometry column,
+// the primary geometry is output as a property in its place
+func applyGeomColumn(query *data.QueryParam, name string, tbl *data.Table) error {
+	if name == "" || name == tbl.GeometryColumn {
+		return nil
+	}
+	if _, ok := toNameSet(tbl.GeometryColumns)[name]; !ok {
+		return fmt.Errorf(api.ErrMsgInvalidParameterValue, api.ParamGeomColumn, name)
+	}
+	query.GeometryColumn = name
+	// copy the columns, since they may be the table column list
+	cols := make([]string, len(query.Columns))
+	for i, col := range query.Columns {
+		if col == name {
+			col = tbl.GeometryColumn
+		}
+		cols[i] = col
+	}
+	query.Columns = cols
+	return nil
+}
+
+// applyGrouping checks the group columns and aggregates of a query against the columns of a table or function,
+// and resolves their names to the column names.
+// Names are matched exactly, or otherwise ignoring case.
+// The properties of grouped features are the group columns, followed by the aggregate values
+func applyGrouping(query *data.QueryParam, columns []string, dbTypes map[string]string) error {
+	if !query.IsGrouped() {
+		return nil
+	}
+	groupBy := make([]string, len(query.GroupBy))
+	for i, name := range query.GroupBy {
+		col := resolveColumnName(name, columns)
+		if col == "" || isGeometryType(dbTypes[col]) {
+			return fmt.Errorf(api.ErrMsgInvalidGroupBy, name)
+		}
+		groupBy[i] = col
+	}
+	aggs := make([]data.Aggregate, len(query.Aggregates))
+	for i, agg := range query.Aggregates {
+		if agg.Column != data.AggregateAll {
+			col := resolveColumnName(agg.Column, columns)
+			if col == "" || !isAggregable(agg.Function, dbTypes[col]) {
+				return fmt.Errorf(api.ErrMsgInvalidAggregateCol, agg)
+			}
+			agg.Column = col
+		}
+		aggs[i] = agg
+	}
+	query.GroupBy = groupBy
+	query.Aggregates = aggs
+	query.Columns = groupBy
+	return nil
+}
+
+// isAggregable tests whether an aggregate function can be computed for a column type.
+// Any column can be counted, but only numbers can be summed or averaged
+func isAggregable(fun string, dbType string) bool {
+	switch fun {
+	case data.AggregateCount:
+		return true
+	case data.AggregateSum, data.AggregateAvg:
+		return data.IsNumericType(dbType)
+	}
+	return !isGeometryType(dbType)
+}
+
+func isGeometryType(dbType string) bool {
+	return strings.EqualFold(dbType, data.DuckDBTypeGeometry)
+}
+
+// resolveColumnName finds the column with a name, matched exactly or otherwise ignoring case.
+// It is blank if there is no such column
+func resolveColumnName(name string, columns []string) string {
+	match := ""
+	for _, col := range columns {
+		if col == name {
+			return col
+		}
+		if match == "" && strings.EqualFold(col, name) {
+			match = col
+		}
+	}
+	return match
+}
+
+// querySortables lists what the features of a query can be sorted by.
+// Grouped features can be sorted by their properties, which are the group columns and aggregate values
+func querySortables(query *data.QueryParam, sorts []data.Sorting) []data.Sorting {
+	if !query.IsGrouped() {
+		return sorts
+	}
+	var groupSorts []data.Sorting
+	for _, name := range query.PropertyNames() {
+		groupSorts = append(groupSorts, data.Sorting{Name: name})
+	}
+	return groupSorts
+}
+
+// checkCrs checks that the CRSs of a request are supported for a storage SRID
+func checkCrs(param *api.RequestParam, storageSrid int) error {
+	supported := api.SupportedCrs(storageSrid)
+	for _, crs := range []data.Crs{param.Crs, param.BboxCrs, param.FilterCrs} {
+		isSupported := false
+		for _, supportedCrs := range supported {
+			isSupported = isSupported || supportedCrs.Srid == crs.Srid
+		}
+		if !isSupported {
+			uris := make([]string, len(supported))
+			for i, supportedCrs := range supported {
+				uris[i] = api.CrsURI(supportedCrs)
+			}
+			return fmt.Errorf(api.ErrMsgUnsupportedCrs, api.CrsURI(crs), strings.Join(uris, ", "))
+		}
+	}
+	return nil
+}
+
+// checkCursor checks that a query of a table can be paged with its cursor
+func checkCursor(query *data.QueryParam, tbl *data.Table) error {
+	if query.Cursor == nil {
+		return nil
+	}
+	if !data.IsKeysetPaging(tbl, query) {
+		return fmt.Errorf(api.ErrMsgCursorNotSupported, tbl.ID)
+	}
+	if !query.Cursor.Matches(query.SortBy) {
+		return fmt.Errorf(api.ErrMsgCursorMismatch, query.Cursor.SortBy)
+	}
+	// the cursor gives the position of the page, so an offset would skip features
+	if query.Offset > 0 {
+		return fmt.Errorf(api.ErrMsgCursorOffset)
+	}
+	return nil
+}
+
+// createQueryParams applies any cross-parameter logic.
+// The filter may only use the queryables, unless they are nil
+func createQueryParams(param *api.RequestParam, colNames []string, queryables []string, sourceSRID int) (*data.QueryParam, error) {
 	query := data.QueryParam{
 		Crs:           param.Crs,
 		Limit:         param.Limit,
 		Offset:        param.Offset,
+		Cursor:        param.Cursor,
 		Bbox:          param.Bbox,
 		BboxCrs:       param.BboxCrs,
+		Datetime:      param.Datetime,
 		GroupBy:       param.GroupBy,
+		Aggregates:    param.Aggregates,
 		SortBy:        param.SortBy,
 		Precision:     param.Precision,
 		TransformFuns: param.TransformFuns,
 	}
 	cols := param.Properties
-	// --- if groupby is present it replaces properties (it may be empty)
-	if param.GroupBy != nil {
-		cols = param.GroupBy
-		// ensure a aggregating transform is set to avoid error
-		if len(param.TransformFuns) == 0 {
-			query.TransformFuns = []data.TransformFunction{
-				{
-					Name: "st_collect",
-				},
-				{
-					Name: "st_envelope",
-				},
-			}
-		}
+	// --- aggregates without groupby are computed for all features as one group
+	if query.GroupBy == nil && len(param.Aggregates) > 0 {
+		query.GroupBy = []string{}
+	}
+	// --- if grouping the group columns replace properties (they may be empty)
+	if query.IsGrouped() {
+		cols = query.GroupBy
 	}
 	query.Columns = normalizePropNames(cols, colNames)
 	//-- convert filter CQL
-	sql, err := cql.TranspileToSQL(param.Filter, param.FilterCrs, sourceSRID)
+	transpile := cql.TranspileToSQL
+	if param.FilterLang == api.FilterLangCQL2JSON {
+		transpile = cql.TranspileJSONToSQL
+	}
+	sql, err := transpile(param.Filter, param.FilterCrs, sourceSRID, queryables)
 	if err != nil {
 		return &query, err
 	}
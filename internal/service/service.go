@@ -71,10 +71,9 @@ func createServers() {
 
 	// Use a TimeoutHandler to ensure a request does not run past the WriteTimeout duration.
 	// This provides a context that allows cancellation to be propagated
-	// down to the database driver.
-	//(Unfortunately this does not propagate to the database itself.
-	// That will require another mechanism such as session config statement_timeout)
-	// If timeout expires, service returns 503 and a text message
+	// down to the database driver, which interrupts the running DuckDB query.
+	// If timeout expires, service returns 503 and a text message.
+	// A shorter Database.QueryTimeoutSec returns a 504 OGC exception instead
 	timeoutHandler := http.TimeoutHandler(compressHandler,
 		time.Duration(timeoutSecRequest)*time.Second,
 		api.ErrMsgRequestTimeout)
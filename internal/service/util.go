@@ -16,11 +16,13 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -45,6 +47,8 @@ type appError struct {
 	Error   error
 	Message string
 	Code    int
+	// IsException is set for errors which are always returned as OGC API exceptions
+	IsException bool
 }
 
 // appHandler is a named function type which is augmented
@@ -92,10 +96,13 @@ func (fn appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		// should log attached error?
 		// panic on severe error?
 		log.Debugf("Request processing error: %v (%v)\n", e.Message, e.Code)
-		if e.Message == "" {
+		switch {
+		case e.Message == "":
 			// Return just the status code without a response body
 			w.WriteHeader(e.Code)
-		} else {
+		case e.IsException || isJSONRequest(r):
+			writeException(w, e)
+		default:
 			http.Error(w, e.Message, e.Code)
 		}
 	}
@@ -119,30 +126,73 @@ func FatalAfter(delaySec int, msg string) chan struct{} {
 	return chanCancel
 }
 
+// isJSONRequest tests whether a request explicitly asks for a JSON response,
+// by a .json path or the Accept header
+func isJSONRequest(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.EscapedPath(), ".json") ||
+		strings.Contains(r.Header.Get("Accept"), "json")
+}
+
+// writeException writes an error as an OGC API exception
+func writeException(w http.ResponseWriter, e *appError) {
+	encoded, err := json.Marshal(api.NewException(e.Code, e.Message))
+	if err != nil {
+		http.Error(w, e.Message, e.Code)
+		return
+	}
+	w.Header().Set("Content-Type", api.ContentTypeJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Code)
+	w.Write(encoded)
+}
+
+// queryTimeouts and queryCancels count the queries ended by a timeout or cancellation
+var queryTimeouts, queryCancels atomic.Int64
+
+// appErrorQuery provides the error for a failed data query.
+// A query which times out is a 504 error, and a cancelled query is a 503 error.
+// These are returned as OGC API exceptions, and are counted and logged, to help in tuning the timeouts.
+// Other errors are internal errors with the given message
+func appErrorQuery(err error, format string, name string) *appError {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Warnf("Query for %v timed out (%v timeouts)", name, queryTimeouts.Add(1))
+		return appErrorException(err, fmt.Sprintf(api.ErrMsgQueryTimeout, name), http.StatusGatewayTimeout)
+	case errors.Is(err, context.Canceled):
+		log.Infof("Query for %v cancelled (%v cancellations)", name, queryCancels.Add(1))
+		return appErrorException(err, fmt.Sprintf(api.ErrMsgQueryCancelled, name), http.StatusServiceUnavailable)
+	}
+	return appErrorInternalFmt(err, format, name)
+}
+
 func appErrorMsg(err error, msg string, code int) *appError {
-	return &appError{err, msg, code}
+	return &appError{Error: err, Message: msg, Code: code}
+}
+
+func appErrorException(err error, msg string, code int) *appError {
+	return &appError{Error: err, Message: msg, Code: code, IsException: true}
 }
 
 func appErrorInternal(err error, msg string) *appError {
-	return &appError{err, msg, http.StatusInternalServerError}
+	return &appError{Error: err, Message: msg, Code: http.StatusInternalServerError}
 }
 
 func appErrorBadRequest(err error, msg string) *appError {
-	return &appError{err, msg, http.StatusBadRequest}
+	return &appError{Error: err, Message: msg, Code: http.StatusBadRequest}
 }
 
 func appErrorInternalFmt(err error, format string, v ...interface{}) *appError {
 	msg := fmt.Sprintf(format, v...)
-	return &appError{err, msg, http.StatusInternalServerError}
+	return &appError{Error: err, Message: msg, Code: http.StatusInternalServerError}
 }
 
 func appErrorNotFoundFmt(err error, format string, v string) *appError {
 	msg := fmt.Sprintf(format, v)
-	return &appError{err, msg, http.StatusNotFound}
+	return &appError{Error: err, Message: msg, Code: http.StatusNotFound}
 }
 
 func appErrorNotFound(err error, msg string) *appError {
-	return &appError{err, msg, http.StatusNotFound}
+	return &appError{Error: err, Message: msg, Code: http.StatusNotFound}
 }
 
 //========================
@@ -258,8 +308,6 @@ func restrict(inMap map[string]string, names []string) map[string]string {
 }
 
 // removeNames removes a list of names from a map (map is modified)
-//
-//nolint:unused
 func removeNames(inMap map[string]string, names []string) {
 	for _, name := range names {
 		delete(inMap, name)
@@ -36,6 +36,8 @@ type PageData struct {
 	URLItems string
 	// URLItemsJSON is url for items JSON
 	URLItemsJSON string
+	// URLQueryables is url for the queryables HTML page
+	URLQueryables string
 	// URLJSON is the url for the current page in JSON
 	URLJSON         string
 	Group           string
@@ -53,6 +55,7 @@ var htmlTemp struct {
 	api           *template.Template
 	collections   *template.Template
 	collection    *template.Template
+	queryables    *template.Template
 	items         *template.Template
 	item          *template.Template
 	functions     *template.Template
@@ -130,6 +133,10 @@ func PageCollection() *template.Template {
 	htmlTemp.collection = loadPageTemplate(htmlTemp.collection, "collection.gohtml")
 	return htmlTemp.collection
 }
+func PageQueryables() *template.Template {
+	htmlTemp.queryables = loadPageTemplate(htmlTemp.queryables, "queryables.gohtml")
+	return htmlTemp.queryables
+}
 func PageItems() *template.Template {
 	htmlTemp.items = loadMapPageTemplate(htmlTemp.items, "items.gohtml")
 	return htmlTemp.items